@@ -35,7 +35,6 @@ type PolicySetSpec struct {
 //+kubebuilder:object:root=true
 //+kubebuilder:printcolumn:name="Mode",type=string,JSONPath=`.spec.mode`
 //+kubebuilder:resource:scope=Cluster
-//+kubebuilder:storageversion
 
 // PolicySet is the Schema for the policysets API
 type PolicySet struct {
@@ -94,7 +93,6 @@ func (ps *PolicySet) Match(policy Policy) bool {
 
 // +kubebuilder:object:root=true
 // +kubebuilder:resource:scope=Cluster
-// +kubebuilder:storageversion
 
 // PolicySetList contains a list of PolicySet
 type PolicySetList struct {
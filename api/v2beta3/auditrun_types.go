@@ -0,0 +1,99 @@
+package v2beta3
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	AuditRunResourceName = "auditruns"
+	AuditRunKind         = "AuditRun"
+	AuditRunListKind     = "AuditRunList"
+
+	AuditRunPhasePending   = "Pending"
+	AuditRunPhaseRunning   = "Running"
+	AuditRunPhaseSucceeded = "Succeeded"
+	AuditRunPhaseFailed    = "Failed"
+
+	// AuditRunConditionComplete is true when the audit run finishes successfully
+	AuditRunConditionComplete = "Complete"
+	// AuditRunConditionFailed is true when the audit run could not finish
+	AuditRunConditionFailed = "Failed"
+)
+
+var (
+	AuditRunGroupVersionResource = GroupVersion.WithResource(AuditRunResourceName)
+)
+
+// AuditRunSpec defines the scope of the audit run, an empty field matches everything
+type AuditRunSpec struct {
+	// Policies are the ids of the policies to audit
+	//+optional
+	Policies []string `json:"policies,omitempty"`
+	// Namespaces are the namespaces of the entities to audit, cluster scoped entities are audited when empty
+	//+optional
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Kinds are the kinds of the entities to audit
+	//+optional
+	Kinds []string `json:"kinds,omitempty"`
+}
+
+// AuditRunStatus reports the progress and the result of the audit run
+type AuditRunStatus struct {
+	//+kubebuilder:validation:Enum=Pending;Running;Succeeded;Failed
+	//+optional
+	Phase string `json:"phase,omitempty"`
+	//+optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	//+optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Duration is the time taken by the audit run
+	//+optional
+	Duration string `json:"duration,omitempty"`
+	// Entities is the number of entities validated so far
+	//+optional
+	Entities int `json:"entities"`
+	// Violations is the number of violations found so far
+	//+optional
+	Violations int `json:"violations"`
+	// Errors are the errors faced while listing and validating entities
+	//+optional
+	Errors []string `json:"errors,omitempty"`
+	//+optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:storageversion
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Entities",type=integer,JSONPath=`.status.entities`
+// +kubebuilder:printcolumn:name="Violations",type=integer,JSONPath=`.status.violations`
+// +kubebuilder:printcolumn:name="Duration",type=string,JSONPath=`.status.duration`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// AuditRun is the Schema for the auditruns API
+type AuditRun struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              AuditRunSpec   `json:"spec,omitempty"`
+	Status            AuditRunStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:storageversion
+
+// AuditRunList contains a list of AuditRun
+type AuditRunList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AuditRun `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(
+		&AuditRun{},
+		&AuditRunList{},
+	)
+}
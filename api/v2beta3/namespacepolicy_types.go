@@ -0,0 +1,56 @@
+package v2beta3
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	NamespacePolicyResourceName = "namespacepolicies"
+	NamespacePolicyKind         = "NamespacePolicy"
+	NamespacePolicyListKind     = "NamespacePolicyList"
+)
+
+var (
+	NamespacePolicyGroupVersionResource = GroupVersion.WithResource(NamespacePolicyResourceName)
+)
+
+//+kubebuilder:object:root=true
+//+kubebuilder:printcolumn:name="Severity",type=string,JSONPath=`.spec.severity`
+//+kubebuilder:printcolumn:name="Category",type=string,JSONPath=`.spec.category`
+//+kubebuilder:printcolumn:name="Enforced",type=string,JSONPath=`.spec.enforce`
+//+kubebuilder:printcolumn:name="Suspended",type=boolean,JSONPath=`.spec.suspend`
+//+kubebuilder:resource:scope=Namespaced
+//+kubebuilder:subresource:status
+//+kubebuilder:storageversion
+
+// NamespacePolicy is a kubernetes policy created by a tenant that applies only to the resources of its namespace,
+// it is evaluated in addition to the cluster policies and can not change them
+type NamespacePolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              PolicySpec            `json:"spec,omitempty"`
+	Status            NamespacePolicyStatus `json:"status,omitempty"`
+}
+
+// NamespacePolicyStatus reports the expired exclusion entries of the namespace policy
+type NamespacePolicyStatus struct {
+	// ExpiredExclusions are the expired exclusion entries of the spec, an event is emitted when an entry is added
+	//+optional
+	ExpiredExclusions []PolicyExclusionEntry `json:"expiredExclusions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// NamespacePolicyList contains a list of NamespacePolicy
+type NamespacePolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []NamespacePolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(
+		&NamespacePolicy{},
+		&NamespacePolicyList{},
+	)
+}
@@ -28,6 +28,19 @@ const (
 	TenancyTag               = "tenancy"
 	PolicyKubernetesProvider = "kubernetes"
 	PolicyTerraformProvider  = "terraform"
+
+	// PolicyConditionReady is true when the policy code compiles and defines the violation rule
+	PolicyConditionReady = "Ready"
+
+	// PolicyStateActive is the state of the policies evaluated in all modes
+	PolicyStateActive = "Active"
+	// PolicyStateSuspended is the state of the policies not evaluated in any mode
+	PolicyStateSuspended = "Suspended"
+	// PolicyStatePartiallySuspended is the state of the policies not evaluated in some modes
+	PolicyStatePartiallySuspended = "PartiallySuspended"
+
+	// PolicyMutationMode is the mode mutating the resources violating the policies, the other modes are the policy set modes
+	PolicyMutationMode = "mutation"
 )
 
 var (
@@ -49,7 +62,8 @@ type PolicyParameters struct {
 
 // PolicyTargets are filters used to determine which resources should be evaluated against a policy
 type PolicyTargets struct {
-	// Kinds is a list of Kubernetes kinds that are supported by this policy
+	// Kinds is a list of Kubernetes kinds that are supported by this policy,
+	// a kind can be qualified by its api version such as apps/v1/Deployment
 	Kinds []string `json:"kinds"`
 	// +optional
 	// Labels is a list of Kubernetes labels that are needed to evaluate the policy against a resource
@@ -58,6 +72,23 @@ type PolicyTargets struct {
 	// +optional
 	// Namespaces is a list of Kubernetes namespaces that a resource needs to be a part of to evaluate against this policy
 	Namespaces []string `json:"namespaces"`
+	// +optional
+	// NamespaceLabels is a list of labels that the namespace of a resource needs to have to evaluate the policy against the resource
+	// this filter is statisfied if only one label existed, using * for value make it so it will match if the key exists regardless of its value
+	NamespaceLabels []map[string]string `json:"namespaceLabels,omitempty"`
+	// +optional
+	// LabelSelector is a Kubernetes label selector the labels of a resource need to match, it is evaluated in addition to labels
+	LabelSelector *metav1.LabelSelector `json:"labelSelector,omitempty"`
+	// +optional
+	// APIGroups is a list of api groups that a resource needs to be a part of, "" is the core group and "*" matches all groups
+	APIGroups []string `json:"apiGroups,omitempty"`
+	// +optional
+	// Names is a list of glob patterns, such as frontend-*, that the name of a resource needs to match one of
+	Names []string `json:"names,omitempty"`
+	// +optional
+	// +kubebuilder:validation:Enum=Cluster;Namespaced;"*"
+	// Scope limits the policy to cluster scoped or namespaced resources, all resources are evaluated when empty or *
+	Scope string `json:"scope,omitempty"`
 }
 
 type PolicyStandard struct {
@@ -70,15 +101,40 @@ type PolicyStandard struct {
 // PolicyExclusions are the structure which resources should not be evaluated against the policy
 type PolicyExclusions struct {
 	// +optional
-	// Namespaces is a list of Kubernetes namespaces that a resource needs to be a part of to excluded from this policy
+	// Namespaces is a list of Kubernetes namespaces that a resource needs to be a part of to excluded from this policy,
+	// a namespace is a glob pattern or a regular expression prefixed with "regex:"
 	Namespaces []string `json:"namespaces"`
 	// +optional
-	// Resources is a list of Kubernetes resources that are excluded by this policy (namespace/name)
+	// Resources is a list of Kubernetes resources that are excluded by this policy (namespace/name or kind/namespace/name),
+	// each part is a glob pattern or a regular expression prefixed with "regex:"
 	Resources []string `json:"resources"`
 	// +optional
 	// Labels is a list of Kubernetes labels that are needed to excluded the policy against a resource
 	// this filter is statisfied if only one label existed, using * for value make it so it will match if the key exists regardless of its value
 	Labels map[string]string `json:"labels"`
+	// +optional
+	// Entries is a list of exclusions that can expire, such as temporary waivers
+	Entries []PolicyExclusionEntry `json:"entries,omitempty"`
+}
+
+// PolicyExclusionEntry excludes the resources matching all of its patterns until it expires,
+// a pattern is a glob pattern or a regular expression prefixed with "regex:" and an empty pattern matches all resources
+type PolicyExclusionEntry struct {
+	// +optional
+	// Kind is the pattern of the kind of the resources
+	Kind string `json:"kind,omitempty"`
+	// +optional
+	// Namespace is the pattern of the namespace of the resources
+	Namespace string `json:"namespace,omitempty"`
+	// +optional
+	// Name is the pattern of the name of the resources
+	Name string `json:"name,omitempty"`
+	// +optional
+	// ExpiresAt is the time the exclusion stops applying, the exclusion never expires when not set
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+	// +optional
+	// Reason describes why the resources are excluded
+	Reason string `json:"reason,omitempty"`
 }
 
 // PolicySpec defines the desired state of Policy
@@ -132,6 +188,111 @@ type PolicySpec struct {
 	// Exclude describes the policy exclusions on (Namespaces, Labels, Resources)
 	// Select one or more by defining the exclusion list
 	Exclude PolicyExclusions `json:"exclude,omitempty"`
+
+	// +optional
+	// Suspend stops evaluating the policy in all modes without deleting it
+	Suspend bool `json:"suspend,omitempty"`
+
+	// +optional
+	// Modes toggles the evaluation of the policy in each mode, a mode is enabled unless set to false
+	Modes PolicyModes `json:"modes,omitempty"`
+}
+
+// PolicyModes toggles the evaluation of a policy in each mode, a mode is enabled when not set
+type PolicyModes struct {
+	// +optional
+	// Audit toggles the evaluation of the policy by the audit
+	Audit *bool `json:"audit,omitempty"`
+	// +optional
+	// Admission toggles the evaluation of the policy by the admission controller
+	Admission *bool `json:"admission,omitempty"`
+	// +optional
+	// Mutation toggles the mutation of the resources violating the policy by the admission controller
+	Mutation *bool `json:"mutation,omitempty"`
+	// +optional
+	// Terraform toggles the evaluation of the policy by the terraform admission
+	Terraform *bool `json:"terraform,omitempty"`
+}
+
+// SuspendedModes returns the modes the policy is not evaluated in, the policy set modes or the mutation mode
+func (s PolicySpec) SuspendedModes() []string {
+	var modes []string
+	for _, mode := range []struct {
+		name    string
+		enabled *bool
+	}{
+		{PolicySetAuditMode, s.Modes.Audit},
+		{PolicySetAdmissionMode, s.Modes.Admission},
+		{PolicyMutationMode, s.Modes.Mutation},
+		{PolicySetTFAdmissionMode, s.Modes.Terraform},
+	} {
+		if s.Suspend || (mode.enabled != nil && !*mode.enabled) {
+			modes = append(modes, mode.name)
+		}
+	}
+	return modes
+}
+
+// EnabledIn checks if the policy is evaluated in the mode of a policy set, suspended policies are disabled in all modes
+// and an empty mode only checks the policy is not suspended
+func (s PolicySpec) EnabledIn(policySetMode string) bool {
+	if s.Suspend {
+		return false
+	}
+	var enabled *bool
+	switch policySetMode {
+	case PolicySetAuditMode:
+		enabled = s.Modes.Audit
+	case PolicySetAdmissionMode:
+		enabled = s.Modes.Admission
+	case PolicySetTFAdmissionMode:
+		enabled = s.Modes.Terraform
+	}
+	return enabled == nil || *enabled
+}
+
+// MutationEnabled checks if the resources violating the policy are mutated
+func (s PolicySpec) MutationEnabled() bool {
+	return s.Mutate && !s.Suspend && (s.Modes.Mutation == nil || *s.Modes.Mutation)
+}
+
+// PolicyStatus reports the compile state of the policy code and the policy results in the last audit
+type PolicyStatus struct {
+	// ObservedGeneration is the generation of the policy spec the status was computed from
+	//+optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// CompileError is the error found compiling the policy code
+	//+optional
+	CompileError string `json:"compileError,omitempty"`
+	// Rule is the rule of the policy code evaluated by the agent
+	//+optional
+	Rule string `json:"rule,omitempty"`
+	// Kinds are the target kinds served by the cluster
+	//+optional
+	Kinds []string `json:"kinds,omitempty"`
+	// UnknownKinds are the target kinds not served by the cluster, they match no entities
+	//+optional
+	UnknownKinds []string `json:"unknownKinds,omitempty"`
+	// ViolatingEntities is the number of entities violating the policy in the last audit
+	//+optional
+	ViolatingEntities int `json:"violatingEntities"`
+	// CompliantEntities is the number of entities compliant with the policy in the last audit
+	//+optional
+	CompliantEntities int `json:"compliantEntities"`
+	// LastAuditTime is the completion time of the last audit
+	//+optional
+	LastAuditTime *metav1.Time `json:"lastAuditTime,omitempty"`
+	// State is Active, Suspended or PartiallySuspended when the policy is not evaluated in some modes
+	//+optional
+	State string `json:"state,omitempty"`
+	// SuspendedModes are the modes the policy is not evaluated in
+	//+optional
+	SuspendedModes []string `json:"suspendedModes,omitempty"`
+	// ExpiredExclusions are the expired exclusion entries of the spec, an event is emitted when an entry is added
+	//+optional
+	ExpiredExclusions []PolicyExclusionEntry `json:"expiredExclusions,omitempty"`
+	//+optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -139,14 +300,19 @@ type PolicySpec struct {
 //+kubebuilder:printcolumn:name="Category",type=string,JSONPath=`.spec.category`
 //+kubebuilder:printcolumn:name="Provider",type=string,JSONPath=`.spec.provider`
 //+kubebuilder:printcolumn:name="Enforced",type=string,JSONPath=`.spec.enforce`
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Violations",type=integer,JSONPath=`.status.violatingEntities`
+//+kubebuilder:printcolumn:name="State",type=string,JSONPath=`.status.state`
 //+kubebuilder:resource:scope=Cluster
 //+kubebuilder:storageversion
+//+kubebuilder:subresource:status
 
 // Policy is the Schema for the policies API
 type Policy struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
-	Spec              PolicySpec `json:"spec,omitempty"`
+	Spec              PolicySpec   `json:"spec,omitempty"`
+	Status            PolicyStatus `json:"status,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -55,6 +55,12 @@ type PolicyConfigTarget struct {
 	Applications []PolicyTargetApplication `json:"apps,omitempty"`
 	//+optional
 	Resources []PolicyTargetResource `json:"resources,omitempty"`
+	// NamespaceSelector matches the resources of the namespaces with labels matching the selector
+	//+optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// ObjectSelector matches the resources with labels matching the selector
+	//+optional
+	ObjectSelector *metav1.LabelSelector `json:"objectSelector,omitempty"`
 }
 
 type PolicyConfigConfig struct {
@@ -119,8 +125,28 @@ func (c *PolicyConfig) Validate() error {
 		target = "resources"
 	}
 
+	if c.Spec.Match.NamespaceSelector != nil {
+		if target != "" {
+			return fmt.Errorf("cannot target %s and namespaceSelector in same policy config", target)
+		}
+		if _, err := metav1.LabelSelectorAsSelector(c.Spec.Match.NamespaceSelector); err != nil {
+			return fmt.Errorf("invalid namespaceSelector: %w", err)
+		}
+		target = "namespaceSelector"
+	}
+
+	if c.Spec.Match.ObjectSelector != nil {
+		if target != "" {
+			return fmt.Errorf("cannot target %s and objectSelector in same policy config", target)
+		}
+		if _, err := metav1.LabelSelectorAsSelector(c.Spec.Match.ObjectSelector); err != nil {
+			return fmt.Errorf("invalid objectSelector: %w", err)
+		}
+		target = "objectSelector"
+	}
+
 	if target == "" {
-		return fmt.Errorf("policy config must target namespace, application or resource")
+		return fmt.Errorf("policy config must target namespace, application, resource, namespace selector or object selector")
 	}
 
 	return nil
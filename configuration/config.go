@@ -3,6 +3,7 @@ package configuration
 import (
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 	"github.com/weaveworks/policy-agent/pkg/logger"
@@ -13,18 +14,28 @@ type SinksConfig struct {
 	FluxNotificationSink *FluxNotificationSink
 	K8sEventsSink        *K8sEventsSink
 	ElasticSink          *ElasticSink
+	PolicyReportSink     *PolicyReportSink
 }
 
 type K8sEventsSink struct {
 	Enabled bool
+	// Deltas limits the audit results written to the sink to the given violation deltas, requires audit state
+	Deltas []string
+}
+
+// PolicyReportSink writes audit results to wgpolicyk8s.io PolicyReport and ClusterPolicyReport resources
+type PolicyReportSink struct {
+	Enabled bool
 }
 
 type FileSystemSink struct {
 	FileName string
+	Deltas   []string
 }
 
 type FluxNotificationSink struct {
 	Address string
+	Deltas  []string
 }
 
 type AdmissionWebhook struct {
@@ -38,6 +49,7 @@ type ElasticSink struct {
 	Username      string
 	Password      string
 	InsertionMode string
+	Deltas        []string
 }
 
 type AdmissionConfig struct {
@@ -47,11 +59,103 @@ type AdmissionConfig struct {
 	Mutate  bool
 }
 
+// AuditScheduleOverride audits the matching kinds and namespaces on a different schedule
+type AuditScheduleOverride struct {
+	Schedule   string
+	Kinds      []string
+	Namespaces []string
+}
+
+// AuditFilterConfig selects the audited entities by their kinds and namespaces
+type AuditFilterConfig struct {
+	// Kinds are kinds, resources, group resources (deployments.apps) or group version resources (apps/v1/deployments)
+	Kinds             []string
+	Namespaces        []string
+	NamespaceSelector string
+}
+
+// AuditStateConfig persists the last known status of each policy and entity pair between audits
+type AuditStateConfig struct {
+	Enabled bool
+	// ConfigMap is the name of the config map in the agent namespace that stores the state
+	ConfigMap string
+	// File stores the state in a local file instead of a config map
+	File string
+	// StillViolatingAfter is the period after which a violation that is still violating is reported again
+	StillViolatingAfter time.Duration
+}
+
+type AuditDiscoveryConfig struct {
+	// Interval is the period between entities sources discoveries, 0 disables periodic discovery
+	Interval time.Duration
+	// WatchCRDs discovers entities sources when custom resource definitions change
+	WatchCRDs bool
+}
+
+type AuditGitConfig struct {
+	// Repository is the path of a local git repository checkout
+	Repository string
+	// Ref is the branch, tag or commit whose manifests are audited
+	Ref string
+	// Path limits the audited manifests to a directory of the repository
+	Path string
+}
+
 type AuditConfig struct {
 	WriteCompliance bool
 	Enabled         bool
 	Sinks           SinksConfig
-	Interval        uint
+	// Interval is the audit interval in hours, ignored when schedule is set
+	Interval uint
+	// Schedule is a cron expression or a descriptor such as "@every 30m"
+	Schedule  string
+	Jitter    time.Duration
+	Overrides []AuditScheduleOverride
+	// Workers is the number of entities validated concurrently
+	Workers int
+	// PageSize is the number of entities retrieved per list request
+	PageSize int
+	// MetadataPrefilter lists the entities metadata first and retrieves only the entities targeted by a policy
+	MetadataPrefilter bool
+	// MaxManifestSize skips the entities with bigger manifests in bytes, zero keeps all entities
+	MaxManifestSize int
+	// QPS and Burst limit the list requests sent to the API server
+	QPS   float64
+	Burst int
+	// EvaluateOwnedEntities audits entities that have owners such as pods and replicasets and attributes their results to the top level owner
+	EvaluateOwnedEntities bool
+	State                 AuditStateConfig
+	// Include and Exclude limit the audited kinds and namespaces, excludes take precedence
+	Include AuditFilterConfig
+	Exclude AuditFilterConfig
+	// LabelSelector limits the audited entities to the matching labels
+	LabelSelector string
+	Discovery     AuditDiscoveryConfig
+	// ManifestsDir audits the manifests of the directory instead of the cluster entities
+	ManifestsDir string
+	// Git audits the manifests of a git repository instead of the cluster entities
+	Git AuditGitConfig
+	// HistorySize is the number of audit run summaries served by the audit status endpoint
+	HistorySize int
+}
+
+// ClusterConfig is a remote cluster audited by the agent with the policies of the cluster running the agent
+type ClusterConfig struct {
+	// ID is the cluster id of the validation results of the cluster
+	ID             string
+	KubeConfigFile string
+	// Context is the kubeconfig context of the cluster, the current context is used when empty
+	Context string
+	// PolicySet limits the audited policies to the policies matching the policy set
+	PolicySet string
+}
+
+// PoliciesConfig loads the policies, policy configs and policy sets from files instead of the policy resources
+type PoliciesConfig struct {
+	// Path is a directory of manifests or an OCI image layout
+	Path string
+	// ReloadInterval is the period between checks for changed files, 0 disables reloading
+	ReloadInterval time.Duration
 }
 
 type TFAdmissionConfig struct {
@@ -72,6 +176,11 @@ type Config struct {
 	Admission   AdmissionConfig
 	Audit       AuditConfig
 	TFAdmission TFAdmissionConfig
+	Policies    PoliciesConfig
+	// Clusters are remote clusters audited in addition to the cluster running the agent
+	Clusters []ClusterConfig
+	// ClusterContextInterval is the interval of collecting the cluster version, provider and nodes count
+	ClusterContextInterval time.Duration
 }
 
 func GetAgentConfiguration(filePath string) Config {
@@ -93,9 +202,21 @@ func GetAgentConfiguration(filePath string) Config {
 	viper.SetDefault("metricsAddress", ":8080")
 	viper.SetDefault("probesListen", ":9000")
 	viper.SetDefault("logLevel", "info")
+	viper.SetDefault("clusterContextInterval", time.Hour)
+	viper.SetDefault("policies.reloadInterval", 10*time.Second)
 	viper.SetDefault("admission.webhook.listen", 8443)
 	viper.SetDefault("admission.webhook.certDir", "/certs")
 	viper.SetDefault("audit.interval", 24)
+	viper.SetDefault("audit.workers", 5)
+	viper.SetDefault("audit.pageSize", 50)
+	viper.SetDefault("audit.qps", 20)
+	viper.SetDefault("audit.burst", 40)
+	viper.SetDefault("audit.historySize", 10)
+	viper.SetDefault("audit.discovery.interval", 10*time.Minute)
+	viper.SetDefault("audit.discovery.watchCRDs", true)
+	viper.SetDefault("audit.git.ref", "HEAD")
+	viper.SetDefault("audit.state.configMap", "policy-agent-audit-state")
+	viper.SetDefault("audit.state.stillViolatingAfter", 7*24*time.Hour)
 
 	checkRequiredFields()
 
@@ -0,0 +1,230 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	pacv2 "github.com/weaveworks/policy-agent/api/v2beta3"
+	"github.com/weaveworks/policy-agent/internal/auditor"
+	crd "github.com/weaveworks/policy-agent/internal/policies"
+	"github.com/weaveworks/policy-agent/pkg/logger"
+	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+	"github.com/weaveworks/policy-agent/pkg/policy-core/validation"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// auditRunStatusInterval is the minimum interval between progress updates of an audit run status
+	auditRunStatusInterval = 5 * time.Second
+	auditRunStatusTimeout  = 10 * time.Second
+)
+
+// AuditRunController triggers audits of the created AuditRun resources and reports their progress in their status
+type AuditRunController struct {
+	Client         client.Client
+	Auditor        *auditor.AuditorController
+	PoliciesSource domain.PoliciesSource
+	// NewValidator returns an audit validator of a cluster with the given policies source, used to audit specific policies
+	NewValidator func(clusterID string, policiesSource domain.PoliciesSource) validation.Validator
+
+	lock sync.Mutex
+	// running holds the audit runs triggered by this process until their final status is observed
+	running map[string]struct{}
+}
+
+func (c *AuditRunController) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	run := pacv2.AuditRun{}
+	if err := c.Client.Get(ctx, req.NamespacedName, &run); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if !run.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	switch run.Status.Phase {
+	case pacv2.AuditRunPhaseSucceeded, pacv2.AuditRunPhaseFailed:
+		c.setRunning(run.Name, false)
+		return ctrl.Result{}, nil
+	case pacv2.AuditRunPhasePending, pacv2.AuditRunPhaseRunning:
+		if c.isRunning(run.Name) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, c.fail(ctx, &run, "Interrupted", "audit run was interrupted by agent restart")
+	}
+	// the cache may not reflect the pending status of a triggered run yet
+	if c.isRunning(run.Name) {
+		return ctrl.Result{}, nil
+	}
+
+	logger.Infow("reconciling audit run", "audit run", req.Name)
+
+	event := auditor.AuditEvent{
+		Type: auditor.AuditEventTypeAuditRun,
+		Data: run.Name,
+		Scope: auditor.AuditScope{
+			Kinds:      run.Spec.Kinds,
+			Namespaces: run.Spec.Namespaces,
+		},
+		Report: c.reporter(run.Name),
+	}
+	if len(run.Spec.Policies) > 0 {
+		missing, err := c.missingPolicies(ctx, run.Spec.Policies)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if len(missing) > 0 {
+			return ctrl.Result{}, c.fail(ctx, &run, "PolicyNotFound", fmt.Sprintf("policies not found: %s", strings.Join(missing, ", ")))
+		}
+		policiesSource := crd.NewPoliciesFilter(c.PoliciesSource, run.Spec.Policies)
+		event.Policies = run.Spec.Policies
+		event.Validators = make(map[string]validation.Validator)
+		for _, clusterID := range c.Auditor.ClusterIDs() {
+			event.Validators[clusterID] = c.NewValidator(clusterID, policiesSource)
+		}
+	}
+
+	patch := client.MergeFrom(run.DeepCopy())
+	run.Status.Phase = pacv2.AuditRunPhasePending
+	if err := c.Client.Status().Patch(ctx, &run, patch); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	c.setRunning(run.Name, true)
+	c.Auditor.Trigger(event)
+	logger.Infow("triggered audit run", "audit run", run.Name)
+	return ctrl.Result{}, nil
+}
+
+// reporter returns a function that updates the status of the audit run with the audit progress
+func (c *AuditRunController) reporter(name string) func(result auditor.AuditResult) {
+	var lastUpdate time.Time
+	return func(result auditor.AuditResult) {
+		done := !result.EndTime.IsZero()
+		if !done && time.Since(lastUpdate) < auditRunStatusInterval {
+			return
+		}
+		lastUpdate = time.Now()
+
+		ctx, cancel := context.WithTimeout(context.Background(), auditRunStatusTimeout)
+		defer cancel()
+		err := c.updateStatus(ctx, name, func(status *pacv2.AuditRunStatus) {
+			setAuditRunResult(status, result)
+		})
+		if err != nil {
+			logger.Errorw("failed to update audit run status", "audit run", name, "error", err)
+		}
+	}
+}
+
+// setAuditRunResult sets the progress or the final result of the audit to the audit run status
+func setAuditRunResult(status *pacv2.AuditRunStatus, result auditor.AuditResult) {
+	status.StartTime = &metav1.Time{Time: result.StartTime}
+	status.Entities = result.Entities
+	status.Violations = result.Violations
+	status.Errors = result.Errors
+
+	if result.EndTime.IsZero() {
+		status.Phase = pacv2.AuditRunPhaseRunning
+		status.Duration = time.Since(result.StartTime).Round(time.Second).String()
+		return
+	}
+
+	status.CompletionTime = &metav1.Time{Time: result.EndTime}
+	status.Duration = result.EndTime.Sub(result.StartTime).Round(time.Millisecond).String()
+	if result.Cancelled {
+		status.Phase = pacv2.AuditRunPhaseFailed
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:    pacv2.AuditRunConditionFailed,
+			Status:  metav1.ConditionTrue,
+			Reason:  "Cancelled",
+			Message: "audit run was cancelled",
+		})
+		return
+	}
+	status.Phase = pacv2.AuditRunPhaseSucceeded
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:    pacv2.AuditRunConditionComplete,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Completed",
+		Message: fmt.Sprintf("audited %d entities and found %d violations", result.Entities, result.Violations),
+	})
+}
+
+// fail marks the audit run as failed
+func (c *AuditRunController) fail(ctx context.Context, run *pacv2.AuditRun, reason, message string) error {
+	logger.Warnw("audit run failed", "audit run", run.Name, "reason", reason, "message", message)
+	patch := client.MergeFrom(run.DeepCopy())
+	run.Status.Phase = pacv2.AuditRunPhaseFailed
+	run.Status.CompletionTime = &metav1.Time{Time: time.Now()}
+	meta.SetStatusCondition(&run.Status.Conditions, metav1.Condition{
+		Type:    pacv2.AuditRunConditionFailed,
+		Status:  metav1.ConditionTrue,
+		Reason:  reason,
+		Message: message,
+	})
+	return c.Client.Status().Patch(ctx, run, patch)
+}
+
+func (c *AuditRunController) updateStatus(ctx context.Context, name string, update func(status *pacv2.AuditRunStatus)) error {
+	run := pacv2.AuditRun{}
+	if err := c.Client.Get(ctx, types.NamespacedName{Name: name}, &run); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	patch := client.MergeFrom(run.DeepCopy())
+	update(&run.Status)
+	return c.Client.Status().Patch(ctx, &run, patch)
+}
+
+func (c *AuditRunController) missingPolicies(ctx context.Context, ids []string) ([]string, error) {
+	policies, err := c.PoliciesSource.GetAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get policies: %w", err)
+	}
+	found := make(map[string]struct{}, len(policies))
+	for i := range policies {
+		found[policies[i].ID] = struct{}{}
+	}
+	var missing []string
+	for _, id := range ids {
+		if _, ok := found[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	sort.Strings(missing)
+	return missing, nil
+}
+
+func (c *AuditRunController) isRunning(name string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	_, ok := c.running[name]
+	return ok
+}
+
+func (c *AuditRunController) setRunning(name string, running bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.running == nil {
+		c.running = make(map[string]struct{})
+	}
+	if running {
+		c.running[name] = struct{}{}
+	} else {
+		delete(c.running, name)
+	}
+}
+
+func (c *AuditRunController) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&pacv2.AuditRun{}).
+		Complete(c)
+}
@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pacv2 "github.com/weaveworks/policy-agent/api/v2beta3"
+	"github.com/weaveworks/policy-agent/internal/auditor"
+	entitiesmock "github.com/weaveworks/policy-agent/internal/entities/mock"
+	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+	"github.com/weaveworks/policy-agent/pkg/policy-core/validation"
+	validationmock "github.com/weaveworks/policy-agent/pkg/policy-core/validation/mock"
+	"k8s.io/apimachinery/pkg/api/meta"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	controllerruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+type fakePoliciesSource struct {
+	policies []domain.Policy
+}
+
+func (f *fakePoliciesSource) GetAll(_ context.Context) ([]domain.Policy, error) {
+	return f.policies, nil
+}
+
+func (f *fakePoliciesSource) GetPolicyConfig(_ context.Context, _ domain.Entity) (*domain.PolicyConfig, error) {
+	return nil, nil
+}
+
+func newAuditRun(name string, spec pacv2.AuditRunSpec) *pacv2.AuditRun {
+	return &pacv2.AuditRun{
+		TypeMeta: v1.TypeMeta{
+			APIVersion: pacv2.GroupVersion.Identifier(),
+			Kind:       pacv2.AuditRunKind,
+		},
+		ObjectMeta: v1.ObjectMeta{
+			Name: name,
+		},
+		Spec: spec,
+	}
+}
+
+func TestAuditRunController(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, pacv2.AddToScheme(scheme))
+	client := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		newAuditRun("scoped", pacv2.AuditRunSpec{Namespaces: []string{"prod"}, Policies: []string{"policy-1"}}),
+		newAuditRun("missing-policy", pacv2.AuditRunSpec{Policies: []string{"policy-2"}}),
+		newAuditRun("interrupted", pacv2.AuditRunSpec{}),
+	).Build()
+
+	entitiesSource := entitiesmock.NewMockEntitiesSource(ctrl)
+	entitiesSource.EXPECT().Kind().AnyTimes().Return("Deployment")
+	entitiesSource.EXPECT().List(gomock.Any(), gomock.Any()).AnyTimes().Return(&domain.EntitiesList{
+		Data: []domain.Entity{
+			{Name: "app", Kind: "Deployment", Namespace: "prod"},
+			{Name: "app", Kind: "Deployment", Namespace: "dev"},
+		},
+	}, nil)
+
+	defaultValidator := validationmock.NewMockValidator(ctrl)
+	defaultValidator.EXPECT().Validate(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+	runValidator := validationmock.NewMockValidator(ctrl)
+	runValidator.EXPECT().Validate(gomock.Any(), gomock.Any(), string(auditor.AuditEventTypeAuditRun)).Times(1).
+		Return(&domain.PolicyValidationSummary{Violations: []domain.PolicyValidation{{}}}, nil)
+
+	auditController := auditor.NewAuditController(defaultValidator, auditor.NewIntervalSchedule(time.Hour), entitiesSource)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go auditController.Start(ctx)
+
+	var validatorPolicies []domain.Policy
+	controller := &AuditRunController{
+		Client:         client,
+		Auditor:        auditController,
+		PoliciesSource: &fakePoliciesSource{policies: []domain.Policy{{ID: "policy-1"}, {ID: "policy-3"}}},
+		NewValidator: func(_ string, policiesSource domain.PoliciesSource) validation.Validator {
+			validatorPolicies, _ = policiesSource.GetAll(ctx)
+			return runValidator
+		},
+	}
+
+	getRun := func(name string) pacv2.AuditRun {
+		run := pacv2.AuditRun{}
+		require.NoError(t, client.Get(ctx, types.NamespacedName{Name: name}, &run))
+		return run
+	}
+
+	_, err := controller.Reconcile(ctx, controllerruntime.Request{NamespacedName: types.NamespacedName{Name: "scoped"}})
+	require.NoError(t, err)
+	assert.Equal(t, []domain.Policy{{ID: "policy-1"}}, validatorPolicies)
+	require.Eventually(t, func() bool {
+		return getRun("scoped").Status.Phase == pacv2.AuditRunPhaseSucceeded
+	}, 5*time.Second, 10*time.Millisecond)
+
+	run := getRun("scoped")
+	assert.Equal(t, 1, run.Status.Entities)
+	assert.Equal(t, 1, run.Status.Violations)
+	assert.NotNil(t, run.Status.CompletionTime)
+	assert.NotEmpty(t, run.Status.Duration)
+	assert.True(t, meta.IsStatusConditionTrue(run.Status.Conditions, pacv2.AuditRunConditionComplete))
+
+	// finished runs are not triggered again
+	_, err = controller.Reconcile(ctx, controllerruntime.Request{NamespacedName: types.NamespacedName{Name: "scoped"}})
+	require.NoError(t, err)
+
+	_, err = controller.Reconcile(ctx, controllerruntime.Request{NamespacedName: types.NamespacedName{Name: "missing-policy"}})
+	require.NoError(t, err)
+	run = getRun("missing-policy")
+	assert.Equal(t, pacv2.AuditRunPhaseFailed, run.Status.Phase)
+	condition := meta.FindStatusCondition(run.Status.Conditions, pacv2.AuditRunConditionFailed)
+	require.NotNil(t, condition)
+	assert.Equal(t, "PolicyNotFound", condition.Reason)
+
+	// runs left running by a previous process are failed
+	run = getRun("interrupted")
+	run.Status.Phase = pacv2.AuditRunPhaseRunning
+	require.NoError(t, client.Status().Update(ctx, &run))
+	_, err = controller.Reconcile(ctx, controllerruntime.Request{NamespacedName: types.NamespacedName{Name: "interrupted"}})
+	require.NoError(t, err)
+	run = getRun("interrupted")
+	assert.Equal(t, pacv2.AuditRunPhaseFailed, run.Status.Phase)
+	assert.Equal(t, "Interrupted", meta.FindStatusCondition(run.Status.Conditions, pacv2.AuditRunConditionFailed).Reason)
+}
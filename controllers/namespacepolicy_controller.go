@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	pacv2 "github.com/weaveworks/policy-agent/api/v2beta3"
+	crd "github.com/weaveworks/policy-agent/internal/policies"
+	"github.com/weaveworks/policy-agent/pkg/logger"
+	"github.com/weaveworks/policy-agent/pkg/policy-core/validation"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// NamespacePolicyController validates the namespace policies written by the tenants of the namespaces
+// and reports their expired exclusion entries in their status
+type NamespacePolicyController struct {
+	Client client.Client
+	// Recorder emits a warning event on the namespace policy when one of its exclusion entries expires
+	Recorder record.EventRecorder
+	decoder  *admission.Decoder
+}
+
+// validateNamespacePolicy checks the namespace policy is a kubernetes policy whose code compiles in the sandbox
+// of the namespace policies and that its spec is well defined
+func validateNamespacePolicy(policy *pacv2.NamespacePolicy) error {
+	if policy.Spec.Provider != pacv2.PolicyKubernetesProvider {
+		return fmt.Errorf("spec.provider: namespace policies support only the '%s' provider", pacv2.PolicyKubernetesProvider)
+	}
+	if err := validation.CompileSandboxed(policy.Spec.Code); err != nil {
+		return fmt.Errorf("invalid policy code: %w", err)
+	}
+	return validatePolicySpec(policy.Spec)
+}
+
+func (c *NamespacePolicyController) Handle(ctx context.Context, req admission.Request) admission.Response {
+	policy := &pacv2.NamespacePolicy{}
+	if err := c.decoder.Decode(req, policy); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if err := validateNamespacePolicy(policy); err != nil {
+		return admission.Denied(err.Error())
+	}
+	return admission.Allowed("")
+}
+
+func (c *NamespacePolicyController) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	policy := pacv2.NamespacePolicy{}
+	if err := c.Client.Get(ctx, req.NamespacedName, &policy); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if !policy.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	logger.Infow("reconciling namespace policy", "policy", req.Name, "namespace", req.Namespace)
+
+	patch := client.MergeFrom(policy.DeepCopy())
+	expired, nextExpiry := crd.ExpiredExclusions(policy.Spec.Exclude.Entries, time.Now())
+	reported := unreportedExclusions(expired, policy.Status.ExpiredExclusions)
+	policy.Status.ExpiredExclusions = expired
+	if err := c.Client.Status().Patch(ctx, &policy, patch); err != nil {
+		return ctrl.Result{}, err
+	}
+	for _, entry := range reported {
+		crd.ReportExpiredExclusion(c.Recorder, &policy, req.String(), entry)
+	}
+	return requeueOnExpiry(nextExpiry), nil
+}
+
+func (c *NamespacePolicyController) SetupWithManager(mgr ctrl.Manager) error {
+	mgr.GetWebhookServer().Register(
+		"/validate-v2beta3-namespacepolicy",
+		&webhook.Admission{Handler: c},
+	)
+
+	// status updates do not change the generation and are not reconciled
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&pacv2.NamespacePolicy{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(c)
+}
+
+// InjectDecoder injects the decoder.
+func (c *NamespacePolicyController) InjectDecoder(d *admission.Decoder) error {
+	c.decoder = d
+	return nil
+}
@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pacv2 "github.com/weaveworks/policy-agent/api/v2beta3"
+	admissionv1 "k8s.io/api/admission/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	controllerruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestNamespacePolicyController(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, pacv2.AddToScheme(scheme))
+	decoder, err := admission.NewDecoder(scheme)
+	require.NoError(t, err)
+	validator := &NamespacePolicyController{}
+	require.NoError(t, validator.InjectDecoder(decoder))
+
+	newNamespacePolicy := func(provider, code string) *pacv2.NamespacePolicy {
+		policy := newPolicy("tenant-policy", provider, code)
+		return &pacv2.NamespacePolicy{
+			TypeMeta:   v1.TypeMeta{APIVersion: pacv2.GroupVersion.Identifier(), Kind: pacv2.NamespacePolicyKind},
+			ObjectMeta: v1.ObjectMeta{Name: policy.Name, Namespace: "team-a"},
+			Spec:       policy.Spec,
+		}
+	}
+
+	cases := []struct {
+		name    string
+		policy  *pacv2.NamespacePolicy
+		allow   bool
+		message string
+	}{
+		{
+			name:   "valid policy",
+			policy: newNamespacePolicy(pacv2.PolicyKubernetesProvider, "package test\nviolation[result] { result = {\"msg\": \"violation\"} }"),
+			allow:  true,
+		},
+		{
+			name:    "network builtin",
+			policy:  newNamespacePolicy(pacv2.PolicyKubernetesProvider, "package test\nviolation[result] { result = http.send({\"method\": \"get\", \"url\": \"http://example.com\"}) }"),
+			message: "invalid policy code",
+		},
+		{
+			name:    "terraform provider",
+			policy:  newNamespacePolicy(pacv2.PolicyTerraformProvider, "package test\nviolation[result] { result = {\"msg\": \"violation\"} }"),
+			message: "spec.provider: namespace policies support only the 'kubernetes' provider",
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			js, err := json.Marshal(tt.policy)
+			require.NoError(t, err)
+			response := validator.Handle(context.Background(), admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Name:      tt.policy.Name,
+					Namespace: tt.policy.Namespace,
+					Kind: v1.GroupVersionKind{
+						Group:   pacv2.GroupVersion.Group,
+						Version: pacv2.GroupVersion.Version,
+						Kind:    pacv2.NamespacePolicyKind,
+					},
+					Object:    runtime.RawExtension{Raw: js},
+					Operation: admissionv1.Create,
+				},
+			})
+			assert.Equal(t, tt.allow, response.Allowed)
+			if !tt.allow {
+				assert.Contains(t, string(response.Result.Reason), tt.message)
+			}
+		})
+	}
+}
+
+func TestNamespacePolicyControllerExpiredExclusions(t *testing.T) {
+	now := time.Now()
+	policy := newPolicy("tenant-policy", pacv2.PolicyKubernetesProvider, "package test\nviolation[result] { result = {\"msg\": \"violation\"} }")
+	namespacePolicy := &pacv2.NamespacePolicy{
+		TypeMeta:   v1.TypeMeta{APIVersion: pacv2.GroupVersion.Identifier(), Kind: pacv2.NamespacePolicyKind},
+		ObjectMeta: v1.ObjectMeta{Name: policy.Name, Namespace: "team-a"},
+		Spec:       policy.Spec,
+	}
+	namespacePolicy.Spec.Exclude.Entries = []pacv2.PolicyExclusionEntry{
+		{Name: "legacy-*", ExpiresAt: &v1.Time{Time: now.Add(-time.Hour)}},
+		{Kind: "Job", ExpiresAt: &v1.Time{Time: now.Add(time.Hour)}},
+	}
+	scheme := runtime.NewScheme()
+	require.NoError(t, pacv2.AddToScheme(scheme))
+	recorder := record.NewFakeRecorder(10)
+	controller := &NamespacePolicyController{
+		Client:   fake.NewClientBuilder().WithScheme(scheme).WithObjects(namespacePolicy).Build(),
+		Recorder: recorder,
+	}
+	request := controllerruntime.Request{NamespacedName: types.NamespacedName{Name: namespacePolicy.Name, Namespace: namespacePolicy.Namespace}}
+
+	result, err := controller.Reconcile(context.Background(), request)
+	require.NoError(t, err)
+	assert.InDelta(t, time.Hour, result.RequeueAfter, float64(time.Minute), "requeued when the next entry expires")
+	require.Len(t, recorder.Events, 1)
+	event := <-recorder.Events
+	assert.Contains(t, event, "Warning ExclusionExpired")
+	assert.Contains(t, event, "name 'legacy-*'")
+
+	updated := pacv2.NamespacePolicy{}
+	require.NoError(t, controller.Client.Get(context.Background(), request.NamespacedName, &updated))
+	require.Len(t, updated.Status.ExpiredExclusions, 1)
+
+	// expired entries are reported once
+	_, err = controller.Reconcile(context.Background(), request)
+	require.NoError(t, err)
+	assert.Empty(t, recorder.Events)
+}
@@ -0,0 +1,427 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	pacv2 "github.com/weaveworks/policy-agent/api/v2beta3"
+	"github.com/weaveworks/policy-agent/internal/auditor"
+	crd "github.com/weaveworks/policy-agent/internal/policies"
+	"github.com/weaveworks/policy-agent/pkg/logger"
+	opa "github.com/weaveworks/policy-agent/pkg/opa-core"
+	"github.com/weaveworks/policy-agent/pkg/policy-core/validation"
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// servedKindsTTL is the period the kinds served by the cluster are reused between reconciliations
+const servedKindsTTL = time.Minute
+
+// unknownKindsRequeueInterval is the period policies with unknown kinds are reconciled again, as spec changes only
+// trigger reconciliations, to report the kinds of the CRDs installed later
+const unknownKindsRequeueInterval = 10 * time.Minute
+
+// PolicyController compiles the policies when they change and reports the compile state and the last audit results in their status
+type PolicyController struct {
+	Client    client.Client
+	Discovery discovery.DiscoveryInterface
+	// Recorder emits a warning event on the policy when one of its exclusion entries expires
+	Recorder record.EventRecorder
+	decoder  *admission.Decoder
+
+	lock sync.Mutex
+	// servedKinds are the kinds served by the cluster, retrieved again after servedKindsTTL
+	servedKinds          map[string]struct{}
+	servedKindsExpiresAt time.Time
+}
+
+// policyParameterTypes are the supported types of the policy parameters
+var policyParameterTypes = map[string]struct{}{
+	"string":  {},
+	"integer": {},
+	"number":  {},
+	"boolean": {},
+	"array":   {},
+	"object":  {},
+}
+
+// validatePolicy checks the policy code compiles and defines the violation rule and the parameters are well defined,
+// the name must match spec.id unless the policy is an update of a policy created before the name was required to match
+func validatePolicy(policy, old *pacv2.Policy) error {
+	legacyName := old != nil && old.Name != old.Spec.ID
+	if policy.Name != policy.Spec.ID && !legacyName {
+		return fmt.Errorf("policy name '%s' must match spec.id '%s'", policy.Name, policy.Spec.ID)
+	}
+
+	opaPolicy, err := opa.Parse(policy.Spec.Code, validation.PolicyQuery)
+	if err != nil {
+		return fmt.Errorf("invalid policy code: %w", err)
+	}
+	if err := opaPolicy.Compile(); err != nil {
+		return fmt.Errorf("invalid policy code: %w", err)
+	}
+	return validatePolicySpec(policy.Spec)
+}
+
+// validatePolicySpec checks the targets, exclusions and parameters of the policy spec are well defined
+func validatePolicySpec(spec pacv2.PolicySpec) error {
+	if err := validateTargets(spec.Targets); err != nil {
+		return err
+	}
+	if err := validateExclusions(spec.Exclude); err != nil {
+		return err
+	}
+
+	names := make(map[string]struct{})
+	for i, param := range spec.Parameters {
+		if param.Name == "" {
+			return fmt.Errorf("spec.parameters[%d]: name is required", i)
+		}
+		if _, ok := names[param.Name]; ok {
+			return fmt.Errorf("spec.parameters[%d]: duplicate parameter '%s'", i, param.Name)
+		}
+		names[param.Name] = struct{}{}
+		if _, ok := policyParameterTypes[param.Type]; !ok {
+			return fmt.Errorf("spec.parameters[%d]: parameter '%s' has unsupported type '%s'", i, param.Name, param.Type)
+		}
+		if param.Value == nil {
+			continue
+		}
+		if err := validateParameterValue(param.Type, param.Value.Raw); err != nil {
+			return fmt.Errorf("spec.parameters[%d]: parameter '%s' %w", i, param.Name, err)
+		}
+	}
+	return nil
+}
+
+// validateTargets checks the label selector and the name patterns of the policy targets
+func validateTargets(targets pacv2.PolicyTargets) error {
+	if targets.LabelSelector != nil {
+		if _, err := metav1.LabelSelectorAsSelector(targets.LabelSelector); err != nil {
+			return fmt.Errorf("spec.targets.labelSelector: %w", err)
+		}
+	}
+	for i, pattern := range targets.Names {
+		if err := validation.ValidatePattern(pattern); err != nil {
+			return fmt.Errorf("spec.targets.names[%d]: invalid pattern '%s': %w", i, pattern, err)
+		}
+	}
+	return nil
+}
+
+// validateExclusions checks the exclusion patterns are valid glob patterns or regular expressions
+func validateExclusions(exclude pacv2.PolicyExclusions) error {
+	for i, namespace := range exclude.Namespaces {
+		if err := validation.ValidatePattern(namespace); err != nil {
+			return fmt.Errorf("spec.exclude.namespaces[%d]: invalid pattern '%s': %w", i, namespace, err)
+		}
+	}
+	for i, resource := range exclude.Resources {
+		kind, namespace, name, ok := validation.ParseExcludedResource(resource)
+		if !ok {
+			return fmt.Errorf("spec.exclude.resources[%d]: resource '%s' must be namespace/name or kind/namespace/name", i, resource)
+		}
+		for _, pattern := range []string{kind, namespace, name} {
+			if err := validation.ValidatePattern(pattern); err != nil {
+				return fmt.Errorf("spec.exclude.resources[%d]: invalid pattern '%s': %w", i, pattern, err)
+			}
+		}
+	}
+	for i, entry := range exclude.Entries {
+		if entry.Kind == "" && entry.Namespace == "" && entry.Name == "" {
+			return fmt.Errorf("spec.exclude.entries[%d]: at least one of kind, namespace or name is required", i)
+		}
+		for _, pattern := range []string{entry.Kind, entry.Namespace, entry.Name} {
+			if err := validation.ValidatePattern(pattern); err != nil {
+				return fmt.Errorf("spec.exclude.entries[%d]: invalid pattern '%s': %w", i, pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateParameterValue checks the parameter value is of the parameter type, null values are allowed
+func validateParameterValue(paramType string, raw []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return fmt.Errorf("has invalid value: %w", err)
+	}
+	if value == nil {
+		return nil
+	}
+
+	var valid bool
+	switch paramType {
+	case "string":
+		_, valid = value.(string)
+	case "integer":
+		number, ok := value.(float64)
+		valid = ok && number == math.Trunc(number)
+	case "number":
+		_, valid = value.(float64)
+	case "boolean":
+		_, valid = value.(bool)
+	case "array":
+		_, valid = value.([]interface{})
+	case "object":
+		_, valid = value.(map[string]interface{})
+	}
+	if !valid {
+		return fmt.Errorf("value %s is not of type '%s'", string(raw), paramType)
+	}
+	return nil
+}
+
+func (c *PolicyController) Handle(ctx context.Context, req admission.Request) admission.Response {
+	policy := &pacv2.Policy{}
+	err := c.decoder.Decode(req, policy)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	var old *pacv2.Policy
+	if req.Operation == admissionv1.Update {
+		old = &pacv2.Policy{}
+		if err := c.decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+	}
+
+	if err = validatePolicy(policy, old); err != nil {
+		return admission.Denied(err.Error())
+	}
+
+	policies := &pacv2.PolicyList{}
+	err = c.Client.List(ctx, policies)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	for _, existing := range policies.Items {
+		// in case of update event, skip the same policy
+		if existing.GetName() == policy.GetName() {
+			continue
+		}
+		if existing.Spec.ID == policy.Spec.ID {
+			return admission.Denied(fmt.Sprintf("policy '%s' already has spec.id '%s'", existing.GetName(), policy.Spec.ID))
+		}
+	}
+	return admission.Allowed("")
+}
+
+func (c *PolicyController) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	policy := pacv2.Policy{}
+	if err := c.Client.Get(ctx, req.NamespacedName, &policy); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if !policy.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	logger.Infow("reconciling policy", "policy", req.Name)
+
+	patch := client.MergeFrom(policy.DeepCopy())
+	if err := c.setCompileStatus(&policy); err != nil {
+		return ctrl.Result{}, err
+	}
+	setState(&policy)
+	expired, nextExpiry := crd.ExpiredExclusions(policy.Spec.Exclude.Entries, time.Now())
+	reported := unreportedExclusions(expired, policy.Status.ExpiredExclusions)
+	policy.Status.ExpiredExclusions = expired
+	if err := c.Client.Status().Patch(ctx, &policy, patch); err != nil {
+		return ctrl.Result{}, err
+	}
+	for _, entry := range reported {
+		crd.ReportExpiredExclusion(c.Recorder, &policy, policy.Name, entry)
+	}
+	result := requeueOnExpiry(nextExpiry)
+	if len(policy.Status.UnknownKinds) > 0 && (result.RequeueAfter == 0 || result.RequeueAfter > unknownKindsRequeueInterval) {
+		result.RequeueAfter = unknownKindsRequeueInterval
+	}
+	return result, nil
+}
+
+// unreportedExclusions returns the expired exclusion entries missing from the ones already reported in the status
+func unreportedExclusions(expired, reported []pacv2.PolicyExclusionEntry) []pacv2.PolicyExclusionEntry {
+	var entries []pacv2.PolicyExclusionEntry
+	for _, entry := range expired {
+		found := false
+		for _, r := range reported {
+			if crd.SameExclusionEntry(entry, r) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// requeueOnExpiry reconciles the policy again when its next exclusion entry expires to report it
+func requeueOnExpiry(nextExpiry *time.Time) ctrl.Result {
+	if nextExpiry == nil {
+		return ctrl.Result{}
+	}
+	return ctrl.Result{RequeueAfter: time.Until(*nextExpiry)}
+}
+
+// setState reports whether the policy is suspended in all or some modes
+func setState(policy *pacv2.Policy) {
+	policy.Status.SuspendedModes = policy.Spec.SuspendedModes()
+	switch {
+	case policy.Spec.Suspend:
+		policy.Status.State = pacv2.PolicyStateSuspended
+	case len(policy.Status.SuspendedModes) > 0:
+		policy.Status.State = pacv2.PolicyStatePartiallySuspended
+	default:
+		policy.Status.State = pacv2.PolicyStateActive
+	}
+}
+
+// setCompileStatus compiles the policy code and resolves the policy target kinds against the kinds served by the cluster
+func (c *PolicyController) setCompileStatus(policy *pacv2.Policy) error {
+	status := &policy.Status
+	status.ObservedGeneration = policy.Generation
+	status.CompileError = ""
+	status.Rule = ""
+	status.Kinds = nil
+	status.UnknownKinds = nil
+
+	if policy.Spec.Provider != pacv2.PolicyTerraformProvider && len(policy.Spec.Targets.Kinds) > 0 {
+		servedKinds, err := c.getServedKinds()
+		if err != nil {
+			return err
+		}
+		for _, kind := range policy.Spec.Targets.Kinds {
+			if _, ok := servedKinds[kind]; ok {
+				status.Kinds = append(status.Kinds, kind)
+			} else {
+				status.UnknownKinds = append(status.UnknownKinds, kind)
+			}
+		}
+	}
+
+	opaPolicy, err := opa.Parse(policy.Spec.Code, validation.PolicyQuery)
+	if err == nil {
+		err = opaPolicy.Compile()
+	}
+	if err != nil {
+		logger.Warnw("failed to compile policy", "policy", policy.Name, "error", err)
+		status.CompileError = err.Error()
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               pacv2.PolicyConditionReady,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: policy.Generation,
+			Reason:             "CompileFailed",
+			Message:            err.Error(),
+		})
+		return nil
+	}
+
+	status.Rule = opaPolicy.Rule(validation.PolicyQuery)
+	message := "policy compiled"
+	if len(status.UnknownKinds) > 0 {
+		message = fmt.Sprintf("policy compiled, target kinds not served by the cluster: %s", strings.Join(status.UnknownKinds, ", "))
+	}
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               pacv2.PolicyConditionReady,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: policy.Generation,
+		Reason:             "Compiled",
+		Message:            message,
+	})
+	return nil
+}
+
+// getServedKinds returns the kinds served by the cluster with and without their api version, the kinds of the groups that fail discovery are left out
+func (c *PolicyController) getServedKinds() (map[string]struct{}, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.servedKinds != nil && time.Now().Before(c.servedKindsExpiresAt) {
+		return c.servedKinds, nil
+	}
+
+	resourcesLists, err := c.Discovery.ServerPreferredResources()
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return nil, fmt.Errorf("failed to get server api resources: %w", err)
+	}
+	servedKinds := make(map[string]struct{})
+	for _, resourcesList := range resourcesLists {
+		for _, resource := range resourcesList.APIResources {
+			servedKinds[resource.Kind] = struct{}{}
+			servedKinds[resourcesList.GroupVersion+"/"+resource.Kind] = struct{}{}
+		}
+	}
+	c.servedKinds = servedKinds
+	c.servedKindsExpiresAt = time.Now().Add(servedKindsTTL)
+	return servedKinds, nil
+}
+
+// OnAuditResult reports the violating and compliant entities of the cluster running the agent of each kubernetes policy
+// enabled in the audit mode in its status, the entities of the remote clusters are not counted as the policies are local.
+// Partial audits are ignored as they validate part of the entities or policies, and so are audits that failed to list or
+// validate local entities, implements github.com/weaveworks/policy-agent/internal/auditor.AuditResultListener
+func (c *PolicyController) OnAuditResult(ctx context.Context, auditEvent auditor.AuditEvent, result auditor.AuditResult) {
+	if auditEvent.Partial() {
+		return
+	}
+	if result.LocalFailed {
+		logger.Warnw("audit failed to validate some local entities, policies audit status is not updated")
+		return
+	}
+	policies := pacv2.PolicyList{}
+	if err := c.Client.List(ctx, &policies); err != nil {
+		logger.Errorw("failed to list policies to update their audit status", "error", err)
+		return
+	}
+
+	auditTime := metav1.NewTime(result.EndTime)
+	for i := range policies.Items {
+		policy := &policies.Items[i]
+		if policy.Spec.Provider != pacv2.PolicyKubernetesProvider || !policy.Spec.EnabledIn(pacv2.PolicySetAuditMode) {
+			continue
+		}
+		patch := client.MergeFrom(policy.DeepCopy())
+		policy.Status.ViolatingEntities = result.LocalViolationsPerPolicy[policy.Spec.ID]
+		policy.Status.CompliantEntities = result.LocalCompliancesPerPolicy[policy.Spec.ID]
+		policy.Status.LastAuditTime = &auditTime
+		if err := c.Client.Status().Patch(ctx, policy, patch); err != nil {
+			logger.Errorw("failed to update policy audit status", "policy", policy.Name, "error", err)
+		}
+	}
+}
+
+func (c *PolicyController) SetupWithManager(mgr ctrl.Manager) error {
+	mgr.GetWebhookServer().Register(
+		"/validate-v2beta3-policy",
+		&webhook.Admission{Handler: c},
+	)
+
+	// status updates do not change the generation and are not reconciled, policies with unknown kinds are requeued
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&pacv2.Policy{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(c)
+}
+
+// InjectDecoder injects the decoder.
+func (c *PolicyController) InjectDecoder(d *admission.Decoder) error {
+	c.decoder = d
+	return nil
+}
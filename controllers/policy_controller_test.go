@@ -0,0 +1,447 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pacv2 "github.com/weaveworks/policy-agent/api/v2beta3"
+	"github.com/weaveworks/policy-agent/internal/auditor"
+	admissionv1 "k8s.io/api/admission/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	discoverfake "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/tools/record"
+	controllerruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+type discoveryMock struct {
+	discoverfake.FakeDiscovery
+	resources []*v1.APIResourceList
+}
+
+func (d *discoveryMock) ServerPreferredResources() ([]*v1.APIResourceList, error) {
+	return d.resources, nil
+}
+
+func newPolicy(name, provider, code string, kinds ...string) *pacv2.Policy {
+	return &pacv2.Policy{
+		TypeMeta: v1.TypeMeta{
+			APIVersion: pacv2.GroupVersion.Identifier(),
+			Kind:       pacv2.PolicyKind,
+		},
+		ObjectMeta: v1.ObjectMeta{
+			Name:       name,
+			Generation: 1,
+		},
+		Spec: pacv2.PolicySpec{
+			ID:       name,
+			Provider: provider,
+			Code:     code,
+			Targets:  pacv2.PolicyTargets{Kinds: kinds},
+		},
+	}
+}
+
+func TestPolicyController(t *testing.T) {
+	validCode := "package test\nviolation[result] { result = {\"msg\": \"violation\"} }"
+
+	disabled := false
+	withModes := func(policy *pacv2.Policy, suspend bool, modes pacv2.PolicyModes) *pacv2.Policy {
+		policy.Spec.Suspend = suspend
+		policy.Spec.Modes = modes
+		return policy
+	}
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, pacv2.AddToScheme(scheme))
+	client := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		newPolicy("valid", pacv2.PolicyKubernetesProvider, validCode, "Deployment"),
+		newPolicy("unknown-kind", pacv2.PolicyKubernetesProvider, validCode, "Deployment", "Rollout"),
+		newPolicy("invalid", pacv2.PolicyKubernetesProvider, "package test\nviolation[result] { result = undefined_var }"),
+		newPolicy("terraform", pacv2.PolicyTerraformProvider, validCode, "aws_s3_bucket"),
+		newPolicy("qualified-kind", pacv2.PolicyKubernetesProvider, validCode, "apps/v1/Deployment", "apps/v1beta1/Deployment"),
+		withModes(newPolicy("no-audit", pacv2.PolicyKubernetesProvider, validCode), false, pacv2.PolicyModes{Audit: &disabled}),
+		withModes(newPolicy("suspended", pacv2.PolicyKubernetesProvider, validCode), true, pacv2.PolicyModes{}),
+	).Build()
+
+	controller := &PolicyController{
+		Client: client,
+		Discovery: &discoveryMock{
+			resources: []*v1.APIResourceList{
+				{
+					GroupVersion: "apps/v1",
+					APIResources: []v1.APIResource{{Name: "deployments", Kind: "Deployment", Namespaced: true, Verbs: v1.Verbs{"list"}}},
+				},
+			},
+		},
+	}
+
+	ctx := context.Background()
+	getPolicy := func(name string) pacv2.Policy {
+		policy := pacv2.Policy{}
+		require.NoError(t, client.Get(ctx, types.NamespacedName{Name: name}, &policy))
+		return policy
+	}
+	requeued := map[string]time.Duration{}
+	for _, name := range []string{"valid", "unknown-kind", "invalid", "terraform", "qualified-kind", "no-audit", "suspended"} {
+		result, err := controller.Reconcile(ctx, controllerruntime.Request{NamespacedName: types.NamespacedName{Name: name}})
+		require.NoError(t, err)
+		requeued[name] = result.RequeueAfter
+	}
+	// policies with unknown kinds are reconciled again to report the kinds served later
+	assert.Equal(t, unknownKindsRequeueInterval, requeued["unknown-kind"])
+	assert.Equal(t, unknownKindsRequeueInterval, requeued["qualified-kind"])
+	assert.Zero(t, requeued["valid"])
+
+	policy := getPolicy("valid")
+	assert.Equal(t, int64(1), policy.Status.ObservedGeneration)
+	assert.Empty(t, policy.Status.CompileError)
+	assert.Equal(t, "data.test.violation", policy.Status.Rule)
+	assert.Equal(t, []string{"Deployment"}, policy.Status.Kinds)
+	assert.Empty(t, policy.Status.UnknownKinds)
+	assert.True(t, meta.IsStatusConditionTrue(policy.Status.Conditions, pacv2.PolicyConditionReady))
+	assert.Equal(t, pacv2.PolicyStateActive, policy.Status.State)
+	assert.Empty(t, policy.Status.SuspendedModes)
+
+	policy = getPolicy("unknown-kind")
+	assert.Equal(t, []string{"Deployment"}, policy.Status.Kinds)
+	assert.Equal(t, []string{"Rollout"}, policy.Status.UnknownKinds)
+	condition := meta.FindStatusCondition(policy.Status.Conditions, pacv2.PolicyConditionReady)
+	require.NotNil(t, condition)
+	assert.Equal(t, v1.ConditionTrue, condition.Status)
+	assert.Contains(t, condition.Message, "Rollout")
+
+	policy = getPolicy("invalid")
+	assert.NotEmpty(t, policy.Status.CompileError)
+	assert.Empty(t, policy.Status.Rule)
+	condition = meta.FindStatusCondition(policy.Status.Conditions, pacv2.PolicyConditionReady)
+	require.NotNil(t, condition)
+	assert.Equal(t, v1.ConditionFalse, condition.Status)
+	assert.Equal(t, "CompileFailed", condition.Reason)
+
+	// terraform policies kinds are not served by the cluster
+	policy = getPolicy("terraform")
+	assert.Empty(t, policy.Status.Kinds)
+	assert.Empty(t, policy.Status.UnknownKinds)
+	assert.True(t, meta.IsStatusConditionTrue(policy.Status.Conditions, pacv2.PolicyConditionReady))
+
+	policy = getPolicy("qualified-kind")
+	assert.Equal(t, []string{"apps/v1/Deployment"}, policy.Status.Kinds)
+	assert.Equal(t, []string{"apps/v1beta1/Deployment"}, policy.Status.UnknownKinds)
+
+	policy = getPolicy("no-audit")
+	assert.Equal(t, pacv2.PolicyStatePartiallySuspended, policy.Status.State)
+	assert.Equal(t, []string{pacv2.PolicySetAuditMode}, policy.Status.SuspendedModes)
+
+	policy = getPolicy("suspended")
+	assert.Equal(t, pacv2.PolicyStateSuspended, policy.Status.State)
+	assert.Equal(t, []string{pacv2.PolicySetAuditMode, pacv2.PolicySetAdmissionMode, pacv2.PolicyMutationMode, pacv2.PolicySetTFAdmissionMode}, policy.Status.SuspendedModes)
+
+	// the remote clusters entities are only in the totals
+	result := auditor.AuditResult{
+		EndTime:                   time.Now(),
+		ViolationsPerPolicy:       map[string]int{"valid": 4, "terraform": 1},
+		CompliancesPerPolicy:      map[string]int{"valid": 5, "unknown-kind": 5},
+		LocalViolationsPerPolicy:  map[string]int{"valid": 2, "terraform": 1},
+		LocalCompliancesPerPolicy: map[string]int{"valid": 3, "unknown-kind": 5},
+	}
+
+	// partial audits do not update the status
+	for _, auditEvent := range []auditor.AuditEvent{
+		{Scope: auditor.AuditScope{Namespaces: []string{"prod"}}},
+		{Scope: auditor.AuditScope{Excludes: []auditor.AuditScope{{Kinds: []string{"Deployment"}}}}},
+		{Policies: []string{"valid"}},
+	} {
+		controller.OnAuditResult(ctx, auditEvent, result)
+		assert.Nil(t, getPolicy("valid").Status.LastAuditTime)
+	}
+
+	// incomplete local counts do not update the status
+	failed := result
+	failed.LocalFailed = true
+	controller.OnAuditResult(ctx, auditor.AuditEvent{}, failed)
+	assert.Nil(t, getPolicy("valid").Status.LastAuditTime)
+
+	controller.OnAuditResult(ctx, auditor.AuditEvent{}, result)
+	policy = getPolicy("valid")
+	assert.Equal(t, 2, policy.Status.ViolatingEntities)
+	assert.Equal(t, 3, policy.Status.CompliantEntities)
+	require.NotNil(t, policy.Status.LastAuditTime)
+	assert.Equal(t, "data.test.violation", policy.Status.Rule)
+
+	policy = getPolicy("unknown-kind")
+	assert.Equal(t, 0, policy.Status.ViolatingEntities)
+	assert.Equal(t, 5, policy.Status.CompliantEntities)
+
+	policy = getPolicy("terraform")
+	assert.Equal(t, 0, policy.Status.ViolatingEntities)
+	assert.Nil(t, policy.Status.LastAuditTime)
+
+	// policies disabled in the audit mode are not audited
+	assert.Nil(t, getPolicy("no-audit").Status.LastAuditTime)
+	assert.Nil(t, getPolicy("suspended").Status.LastAuditTime)
+}
+
+func TestPolicyValidator(t *testing.T) {
+	validCode := "package test\nviolation[result] { result = {\"msg\": \"violation\"} }"
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, pacv2.AddToScheme(scheme))
+	withID := func(policy *pacv2.Policy, id string) *pacv2.Policy {
+		policy.Spec.ID = id
+		return policy
+	}
+	client := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		newPolicy("policy-1", pacv2.PolicyKubernetesProvider, validCode),
+		// policies created before the name was required to match the id
+		withID(newPolicy("legacy-name", pacv2.PolicyKubernetesProvider, validCode), "policy-2"),
+	).Build()
+	decoder, err := admission.NewDecoder(scheme)
+	require.NoError(t, err)
+	controller := &PolicyController{Client: client}
+	require.NoError(t, controller.InjectDecoder(decoder))
+
+	withTargets := func(policy *pacv2.Policy, targets pacv2.PolicyTargets) *pacv2.Policy {
+		policy.Spec.Targets = targets
+		return policy
+	}
+	withExclude := func(policy *pacv2.Policy, exclude pacv2.PolicyExclusions) *pacv2.Policy {
+		policy.Spec.Exclude = exclude
+		return policy
+	}
+	withParameters := func(policy *pacv2.Policy, parameters ...pacv2.PolicyParameters) *pacv2.Policy {
+		policy.Spec.Parameters = parameters
+		return policy
+	}
+	value := func(raw string) *apiextensionsv1.JSON {
+		return &apiextensionsv1.JSON{Raw: []byte(raw)}
+	}
+
+	cases := []struct {
+		name   string
+		policy *pacv2.Policy
+		// old is the policy before an update, the request is a create when it is nil
+		old     *pacv2.Policy
+		allow   bool
+		message string
+	}{
+		{
+			name:   "valid policy",
+			policy: newPolicy("policy-3", pacv2.PolicyKubernetesProvider, validCode),
+			allow:  true,
+		},
+		{
+			name:   "update existing policy",
+			policy: newPolicy("policy-1", pacv2.PolicyKubernetesProvider, validCode),
+			allow:  true,
+		},
+		{
+			name: "valid parameters",
+			policy: withParameters(newPolicy("policy-3", pacv2.PolicyKubernetesProvider, validCode),
+				pacv2.PolicyParameters{Name: "replicas", Type: "integer", Value: value("3")},
+				pacv2.PolicyParameters{Name: "exclude", Type: "array", Value: value(`["kube-system"]`)},
+				pacv2.PolicyParameters{Name: "enabled", Type: "boolean", Value: value("null")},
+				pacv2.PolicyParameters{Name: "label", Type: "string"},
+			),
+			allow: true,
+		},
+		{
+			name: "valid targets",
+			policy: withTargets(newPolicy("policy-3", pacv2.PolicyKubernetesProvider, validCode), pacv2.PolicyTargets{
+				Kinds:         []string{"apps/v1/Deployment"},
+				LabelSelector: &v1.LabelSelector{MatchExpressions: []v1.LabelSelectorRequirement{{Key: "app", Operator: v1.LabelSelectorOpExists}}},
+				Names:         []string{"frontend-*", "regex:backend-[0-9]+"},
+			}),
+			allow: true,
+		},
+		{
+			name: "invalid label selector",
+			policy: withTargets(newPolicy("policy-3", pacv2.PolicyKubernetesProvider, validCode), pacv2.PolicyTargets{
+				LabelSelector: &v1.LabelSelector{MatchExpressions: []v1.LabelSelectorRequirement{{Key: "app", Operator: v1.LabelSelectorOpIn}}},
+			}),
+			message: "spec.targets.labelSelector",
+		},
+		{
+			name: "invalid name pattern",
+			policy: withTargets(newPolicy("policy-3", pacv2.PolicyKubernetesProvider, validCode), pacv2.PolicyTargets{
+				Names: []string{"frontend-["},
+			}),
+			message: "spec.targets.names[0]: invalid pattern 'frontend-['",
+		},
+		{
+			name: "invalid name regex",
+			policy: withTargets(newPolicy("policy-3", pacv2.PolicyKubernetesProvider, validCode), pacv2.PolicyTargets{
+				Names: []string{"regex:frontend-("},
+			}),
+			message: "spec.targets.names[0]: invalid pattern 'regex:frontend-('",
+		},
+		{
+			name: "valid exclusions",
+			policy: withExclude(newPolicy("policy-3", pacv2.PolicyKubernetesProvider, validCode), pacv2.PolicyExclusions{
+				Namespaces: []string{"kube-*", "regex:team-[a-z]+"},
+				Resources:  []string{"prod/frontend-*", "Deployment/*/legacy-api"},
+				Entries:    []pacv2.PolicyExclusionEntry{{Kind: "Job", ExpiresAt: &v1.Time{Time: time.Now().Add(time.Hour)}}},
+			}),
+			allow: true,
+		},
+		{
+			name: "invalid exclusion regex",
+			policy: withExclude(newPolicy("policy-3", pacv2.PolicyKubernetesProvider, validCode), pacv2.PolicyExclusions{
+				Namespaces: []string{"regex:team-("},
+			}),
+			message: "spec.exclude.namespaces[0]: invalid pattern 'regex:team-('",
+		},
+		{
+			name: "invalid excluded resource",
+			policy: withExclude(newPolicy("policy-3", pacv2.PolicyKubernetesProvider, validCode), pacv2.PolicyExclusions{
+				Resources: []string{"frontend"},
+			}),
+			message: "spec.exclude.resources[0]: resource 'frontend' must be namespace/name or kind/namespace/name",
+		},
+		{
+			name: "empty exclusion entry",
+			policy: withExclude(newPolicy("policy-3", pacv2.PolicyKubernetesProvider, validCode), pacv2.PolicyExclusions{
+				Entries: []pacv2.PolicyExclusionEntry{{Reason: "waiver"}},
+			}),
+			message: "spec.exclude.entries[0]: at least one of kind, namespace or name is required",
+		},
+		{
+			name:    "name differs from id",
+			policy:  withID(newPolicy("policy-3", pacv2.PolicyKubernetesProvider, validCode), "policy-4"),
+			message: "policy name 'policy-3' must match spec.id 'policy-4'",
+		},
+		{
+			name:   "update of policy created with a name that differs from id",
+			policy: withID(newPolicy("legacy-name", pacv2.PolicyKubernetesProvider, validCode), "policy-2"),
+			old:    withID(newPolicy("legacy-name", pacv2.PolicyKubernetesProvider, validCode), "policy-2"),
+			allow:  true,
+		},
+		{
+			name:    "update that changes the id of a policy whose name matched",
+			policy:  withID(newPolicy("policy-1", pacv2.PolicyKubernetesProvider, validCode), "policy-4"),
+			old:     newPolicy("policy-1", pacv2.PolicyKubernetesProvider, validCode),
+			message: "policy name 'policy-1' must match spec.id 'policy-4'",
+		},
+		{
+			name:    "duplicate id",
+			policy:  newPolicy("policy-2", pacv2.PolicyKubernetesProvider, validCode),
+			message: "policy 'legacy-name' already has spec.id 'policy-2'",
+		},
+		{
+			name:    "missing violation rule",
+			policy:  newPolicy("policy-3", pacv2.PolicyKubernetesProvider, "package test\nallow { true }"),
+			message: "invalid policy code: rule `violation` is not found",
+		},
+		{
+			name:    "syntax error",
+			policy:  newPolicy("policy-3", pacv2.PolicyKubernetesProvider, "package test\nviolation[result] {"),
+			message: "invalid policy code",
+		},
+		{
+			name:    "unsafe variable",
+			policy:  newPolicy("policy-3", pacv2.PolicyKubernetesProvider, "package test\nviolation[result] { result = undefined_var }"),
+			message: "undefined_var",
+		},
+		{
+			name: "duplicate parameter",
+			policy: withParameters(newPolicy("policy-3", pacv2.PolicyKubernetesProvider, validCode),
+				pacv2.PolicyParameters{Name: "replicas", Type: "integer"},
+				pacv2.PolicyParameters{Name: "replicas", Type: "string"},
+			),
+			message: "spec.parameters[1]: duplicate parameter 'replicas'",
+		},
+		{
+			name: "unsupported parameter type",
+			policy: withParameters(newPolicy("policy-3", pacv2.PolicyKubernetesProvider, validCode),
+				pacv2.PolicyParameters{Name: "replicas", Type: "int"},
+			),
+			message: "spec.parameters[0]: parameter 'replicas' has unsupported type 'int'",
+		},
+		{
+			name: "parameter value of different type",
+			policy: withParameters(newPolicy("policy-3", pacv2.PolicyKubernetesProvider, validCode),
+				pacv2.PolicyParameters{Name: "replicas", Type: "integer", Value: value("2.5")},
+			),
+			message: "spec.parameters[0]: parameter 'replicas' value 2.5 is not of type 'integer'",
+		},
+	}
+
+	ctx := context.Background()
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			js, err := json.Marshal(tt.policy)
+			require.NoError(t, err)
+			request := admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Name: tt.policy.Name,
+					Kind: v1.GroupVersionKind{
+						Group:   pacv2.GroupVersion.Group,
+						Version: pacv2.GroupVersion.Version,
+						Kind:    pacv2.PolicyKind,
+					},
+					Object:    runtime.RawExtension{Raw: js},
+					Operation: admissionv1.Create,
+				},
+			}
+			if tt.old != nil {
+				old, err := json.Marshal(tt.old)
+				require.NoError(t, err)
+				request.OldObject = runtime.RawExtension{Raw: old}
+				request.Operation = admissionv1.Update
+			}
+			response := controller.Handle(ctx, request)
+			assert.Equal(t, tt.allow, response.Allowed)
+			if !tt.allow {
+				assert.Contains(t, string(response.Result.Reason), tt.message)
+			}
+		})
+	}
+}
+
+func TestPolicyControllerExpiredExclusions(t *testing.T) {
+	validCode := "package test\nviolation[result] { result = {\"msg\": \"violation\"} }"
+	now := time.Now()
+
+	policy := newPolicy("waivers", pacv2.PolicyKubernetesProvider, validCode)
+	policy.Spec.Exclude.Entries = []pacv2.PolicyExclusionEntry{
+		{Namespace: "dev", ExpiresAt: &v1.Time{Time: now.Add(-time.Hour)}},
+		{Name: "legacy-*", ExpiresAt: &v1.Time{Time: now.Add(time.Hour)}},
+		{Kind: "Job"},
+	}
+	scheme := runtime.NewScheme()
+	require.NoError(t, pacv2.AddToScheme(scheme))
+	recorder := record.NewFakeRecorder(10)
+	controller := &PolicyController{
+		Client:    fake.NewClientBuilder().WithScheme(scheme).WithObjects(policy).Build(),
+		Discovery: &discoveryMock{},
+		Recorder:  recorder,
+	}
+
+	result, err := controller.Reconcile(context.Background(), controllerruntime.Request{NamespacedName: types.NamespacedName{Name: policy.Name}})
+	require.NoError(t, err)
+	assert.InDelta(t, time.Hour, result.RequeueAfter, float64(time.Minute), "requeued when the next entry expires")
+	require.Len(t, recorder.Events, 1)
+	event := <-recorder.Events
+	assert.Contains(t, event, "Warning ExclusionExpired")
+	assert.Contains(t, event, "namespace 'dev'")
+
+	updated := pacv2.Policy{}
+	require.NoError(t, controller.Client.Get(context.Background(), types.NamespacedName{Name: policy.Name}, &updated))
+	require.Len(t, updated.Status.ExpiredExclusions, 1)
+	assert.Equal(t, "dev", updated.Status.ExpiredExclusions[0].Namespace)
+
+	// expired entries reported in the status are not reported again after a restart
+	restarted := &PolicyController{Client: controller.Client, Discovery: &discoveryMock{}, Recorder: recorder}
+	_, err = restarted.Reconcile(context.Background(), controllerruntime.Request{NamespacedName: types.NamespacedName{Name: policy.Name}})
+	require.NoError(t, err)
+	assert.Empty(t, recorder.Events)
+}
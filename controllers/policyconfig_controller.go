@@ -4,11 +4,14 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strings"
 
 	pacv2 "github.com/weaveworks/policy-agent/api/v2beta3"
 	"github.com/weaveworks/policy-agent/pkg/logger"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/selection"
 	"k8s.io/apimachinery/pkg/types"
 
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -89,10 +92,70 @@ func checkTargetOverlap(config, newConfig pacv2.PolicyConfig) error {
 				return fmt.Errorf("policy config '%s' already targets resource '%s'", config.GetName(), resource.ID())
 			}
 		}
+	} else if config.Spec.Match.NamespaceSelector != nil {
+		if newConfig.Spec.Match.NamespaceSelector == nil {
+			return nil
+		}
+		if sameSelector(config.Spec.Match.NamespaceSelector, newConfig.Spec.Match.NamespaceSelector) {
+			return fmt.Errorf("policy config '%s' already targets namespace selector '%s'", config.GetName(), metav1.FormatLabelSelector(newConfig.Spec.Match.NamespaceSelector))
+		}
+	} else if config.Spec.Match.ObjectSelector != nil {
+		if newConfig.Spec.Match.ObjectSelector == nil {
+			return nil
+		}
+		if sameSelector(config.Spec.Match.ObjectSelector, newConfig.Spec.Match.ObjectSelector) {
+			return fmt.Errorf("policy config '%s' already targets object selector '%s'", config.GetName(), metav1.FormatLabelSelector(newConfig.Spec.Match.ObjectSelector))
+		}
 	}
 	return nil
 }
 
+// sameSelector checks if the label selectors have the same requirements. Selectors with different requirements are allowed
+// even when they match the same objects, the configs whose selector has more requirements override the others
+func sameSelector(selector, newSelector *metav1.LabelSelector) bool {
+	requirements, err := selectorRequirements(selector)
+	if err != nil {
+		return false
+	}
+	newRequirements, err := selectorRequirements(newSelector)
+	if err != nil {
+		return false
+	}
+	return len(requirements) == len(newRequirements) && containsAll(requirements, newRequirements)
+}
+
+// selectorRequirements returns the requirements of the label selector in a canonical form,
+// so that matchLabels and their equivalent matchExpressions are the same requirement
+func selectorRequirements(selector *metav1.LabelSelector) (map[string]struct{}, error) {
+	labelSelector, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	requirements, _ := labelSelector.Requirements()
+	result := make(map[string]struct{}, len(requirements))
+	for _, requirement := range requirements {
+		operator := requirement.Operator()
+		switch operator {
+		case selection.Equals, selection.DoubleEquals:
+			operator = selection.In
+		case selection.NotEquals:
+			operator = selection.NotIn
+		}
+		result[fmt.Sprintf("%s %s %s", requirement.Key(), operator, strings.Join(requirement.Values().List(), ","))] = struct{}{}
+	}
+	return result, nil
+}
+
+// containsAll checks if all the items of subset are in set
+func containsAll(set, subset map[string]struct{}) bool {
+	for item := range subset {
+		if _, ok := set[item]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
 func (pc *PolicyConfigController) Handle(ctx context.Context, req admission.Request) admission.Response {
 	newConfig := &pacv2.PolicyConfig{}
 	err := pc.decoder.Decode(req, newConfig)
@@ -128,6 +128,38 @@ func TestPolicyConfigValidator(t *testing.T) {
 				},
 			},
 		},
+		{
+			TypeMeta: v1.TypeMeta{
+				APIVersion: pacv2.GroupVersion.Identifier(),
+				Kind:       pacv2.PolicyConfigKind,
+			},
+			ObjectMeta: v1.ObjectMeta{
+				Name: uuid.NewV4().String(),
+			},
+			Spec: pacv2.PolicyConfigSpec{
+				Match: pacv2.PolicyConfigTarget{
+					NamespaceSelector: &v1.LabelSelector{
+						MatchLabels: map[string]string{"env": "dev"},
+					},
+				},
+			},
+		},
+		{
+			TypeMeta: v1.TypeMeta{
+				APIVersion: pacv2.GroupVersion.Identifier(),
+				Kind:       pacv2.PolicyConfigKind,
+			},
+			ObjectMeta: v1.ObjectMeta{
+				Name: uuid.NewV4().String(),
+			},
+			Spec: pacv2.PolicyConfigSpec{
+				Match: pacv2.PolicyConfigTarget{
+					ObjectSelector: &v1.LabelSelector{
+						MatchLabels: map[string]string{"team": "data", "tier": "backend"},
+					},
+				},
+			},
+		},
 	}
 
 	cases := []struct {
@@ -330,6 +362,174 @@ func TestPolicyConfigValidator(t *testing.T) {
 			},
 			allow: true,
 		},
+		{
+			name: "target namespace selector already targeted before",
+			config: pacv2.PolicyConfig{
+				TypeMeta: v1.TypeMeta{
+					APIVersion: pacv2.GroupVersion.Identifier(),
+					Kind:       pacv2.PolicyConfigKind,
+				},
+				ObjectMeta: v1.ObjectMeta{
+					Name: uuid.NewV4().String(),
+				},
+				Spec: pacv2.PolicyConfigSpec{
+					Match: pacv2.PolicyConfigTarget{
+						NamespaceSelector: &v1.LabelSelector{
+							MatchExpressions: []v1.LabelSelectorRequirement{
+								{Key: "env", Operator: v1.LabelSelectorOpIn, Values: []string{"dev"}},
+							},
+						},
+					},
+				},
+			},
+			allow: false,
+		},
+		{
+			name: "target namespace selector with more requirements than a targeted one",
+			config: pacv2.PolicyConfig{
+				TypeMeta: v1.TypeMeta{
+					APIVersion: pacv2.GroupVersion.Identifier(),
+					Kind:       pacv2.PolicyConfigKind,
+				},
+				ObjectMeta: v1.ObjectMeta{
+					Name: uuid.NewV4().String(),
+				},
+				Spec: pacv2.PolicyConfigSpec{
+					Match: pacv2.PolicyConfigTarget{
+						NamespaceSelector: &v1.LabelSelector{
+							MatchLabels: map[string]string{"env": "dev", "region": "eu"},
+						},
+					},
+				},
+			},
+			allow: true,
+		},
+		{
+			name: "target namespace selector not targeted before",
+			config: pacv2.PolicyConfig{
+				TypeMeta: v1.TypeMeta{
+					APIVersion: pacv2.GroupVersion.Identifier(),
+					Kind:       pacv2.PolicyConfigKind,
+				},
+				ObjectMeta: v1.ObjectMeta{
+					Name: uuid.NewV4().String(),
+				},
+				Spec: pacv2.PolicyConfigSpec{
+					Match: pacv2.PolicyConfigTarget{
+						NamespaceSelector: &v1.LabelSelector{
+							MatchLabels: map[string]string{"env": "prod"},
+						},
+					},
+				},
+			},
+			allow: true,
+		},
+		{
+			name: "target object selector with less requirements than a targeted one",
+			config: pacv2.PolicyConfig{
+				TypeMeta: v1.TypeMeta{
+					APIVersion: pacv2.GroupVersion.Identifier(),
+					Kind:       pacv2.PolicyConfigKind,
+				},
+				ObjectMeta: v1.ObjectMeta{
+					Name: uuid.NewV4().String(),
+				},
+				Spec: pacv2.PolicyConfigSpec{
+					Match: pacv2.PolicyConfigTarget{
+						ObjectSelector: &v1.LabelSelector{
+							MatchLabels: map[string]string{"team": "data"},
+						},
+					},
+				},
+			},
+			allow: true,
+		},
+		{
+			name: "target object selector already targeted before",
+			config: pacv2.PolicyConfig{
+				TypeMeta: v1.TypeMeta{
+					APIVersion: pacv2.GroupVersion.Identifier(),
+					Kind:       pacv2.PolicyConfigKind,
+				},
+				ObjectMeta: v1.ObjectMeta{
+					Name: uuid.NewV4().String(),
+				},
+				Spec: pacv2.PolicyConfigSpec{
+					Match: pacv2.PolicyConfigTarget{
+						ObjectSelector: &v1.LabelSelector{
+							MatchLabels: map[string]string{"tier": "backend"},
+							MatchExpressions: []v1.LabelSelectorRequirement{
+								{Key: "team", Operator: v1.LabelSelectorOpIn, Values: []string{"data"}},
+							},
+						},
+					},
+				},
+			},
+			allow: false,
+		},
+		{
+			name: "target object selector not targeted before",
+			config: pacv2.PolicyConfig{
+				TypeMeta: v1.TypeMeta{
+					APIVersion: pacv2.GroupVersion.Identifier(),
+					Kind:       pacv2.PolicyConfigKind,
+				},
+				ObjectMeta: v1.ObjectMeta{
+					Name: uuid.NewV4().String(),
+				},
+				Spec: pacv2.PolicyConfigSpec{
+					Match: pacv2.PolicyConfigTarget{
+						ObjectSelector: &v1.LabelSelector{
+							MatchLabels: map[string]string{"team": "data", "tier": "frontend"},
+						},
+					},
+				},
+			},
+			allow: true,
+		},
+		{
+			name: "target invalid object selector",
+			config: pacv2.PolicyConfig{
+				TypeMeta: v1.TypeMeta{
+					APIVersion: pacv2.GroupVersion.Identifier(),
+					Kind:       pacv2.PolicyConfigKind,
+				},
+				ObjectMeta: v1.ObjectMeta{
+					Name: uuid.NewV4().String(),
+				},
+				Spec: pacv2.PolicyConfigSpec{
+					Match: pacv2.PolicyConfigTarget{
+						ObjectSelector: &v1.LabelSelector{
+							MatchExpressions: []v1.LabelSelectorRequirement{
+								{Key: "team", Operator: v1.LabelSelectorOpIn},
+							},
+						},
+					},
+				},
+			},
+			allow: false,
+		},
+		{
+			name: "target namespaces and namespace selector",
+			config: pacv2.PolicyConfig{
+				TypeMeta: v1.TypeMeta{
+					APIVersion: pacv2.GroupVersion.Identifier(),
+					Kind:       pacv2.PolicyConfigKind,
+				},
+				ObjectMeta: v1.ObjectMeta{
+					Name: uuid.NewV4().String(),
+				},
+				Spec: pacv2.PolicyConfigSpec{
+					Match: pacv2.PolicyConfigTarget{
+						Namespaces: []string{"staging"},
+						NamespaceSelector: &v1.LabelSelector{
+							MatchLabels: map[string]string{"env": "staging"},
+						},
+					},
+				},
+			},
+			allow: false,
+		},
 	}
 
 	ctx := context.Background()
@@ -17,8 +17,9 @@ import (
 
 // AdmissionHandler listens to admission requests and validates them using a validator
 type AdmissionHandler struct {
-	logLevel  string
-	validator validation.Validator
+	logLevel      string
+	validator     validation.Validator
+	ownerResolver domain.OwnerResolver
 }
 
 const (
@@ -39,6 +40,11 @@ func NewAdmissionHandler(
 	}
 }
 
+// SetOwnerResolver attributes results of entities that have owners to their top level owner
+func (a *AdmissionHandler) SetOwnerResolver(ownerResolver domain.OwnerResolver) {
+	a.ownerResolver = ownerResolver
+}
+
 func (a *AdmissionHandler) handleErrors(err error, errMsg string) ctrlAdmission.Response {
 	logger.Errorw("validating admission request error", "error", err, "error-message", errMsg)
 	errRsp := ctrlAdmission.ValidationResponse(false, errMsg)
@@ -64,6 +70,12 @@ func (a *AdmissionHandler) Handle(ctx context.Context, req ctrlAdmission.Request
 	}
 
 	entity := domain.NewEntityFromSpec(entitySpec)
+	if entity.HasParent && a.ownerResolver != nil {
+		entity.Owner, err = a.ownerResolver.Resolve(ctx, entity)
+		if err != nil {
+			logger.Warnw("failed to resolve entity owner", "kind", entity.Kind, "name", entity.Name, "error", err)
+		}
+	}
 	result, err := a.validator.Validate(ctx, entity, string(req.AdmissionRequest.Operation))
 	if err != nil {
 		return a.handleErrors(err, ErrValidatingResource)
@@ -107,6 +119,10 @@ func generateResponse(violations []domain.PolicyValidation) string {
 			buffer.WriteString(fmt.Sprintf("Entity	: %s/%s in namespace: %s\n", strings.ToLower(violation.Entity.Kind), violation.Entity.Name, violation.Entity.Namespace))
 		}
 
+		if owner := violation.Entity.Owner; owner != nil {
+			buffer.WriteString(fmt.Sprintf("Owner	: %s/%s\n", strings.ToLower(owner.Kind), owner.Name))
+		}
+
 		buffer.WriteString("Occurrences:\n")
 		for _, occurrence := range violation.Occurrences {
 			buffer.WriteString(fmt.Sprintf("- %s\n", occurrence.Message))
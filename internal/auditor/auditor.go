@@ -2,6 +2,8 @@ package auditor
 
 import (
 	"context"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/weaveworks/policy-agent/pkg/logger"
@@ -9,66 +11,312 @@ import (
 	"github.com/weaveworks/policy-agent/pkg/policy-core/validation"
 )
 
-// AuditorController performs audit on a regular interval by using entitites sources to retrieve resources
+// AuditorController performs audit on a regular schedule by using entitites sources to retrieve resources
 type AuditorController struct {
-	entitiesSources    []domain.EntitiesSource
-	auditEvent         chan AuditEvent
-	validator          validation.Validator
+	// clusters are the audited clusters, the first one is the cluster running the agent
+	clusters           []*AuditCluster
+	queueLock          sync.Mutex
+	queue              []AuditEvent
+	queued             chan struct{}
 	auditEventListener AuditEventListener
-	auditInterval      time.Duration
+	completeListeners  []AuditEventListener
+	resultListeners    []AuditResultListener
+	schedules          []AuditSchedule
+	jitter             time.Duration
+	workers            int
+	pageSize           int
+	history            *AuditHistory
 }
 
 // NewAuditController returns a new instance of AuditController with an audit event listener
-func NewAuditController(validator validation.Validator, auditInterval time.Duration, entitiesSources ...domain.EntitiesSource) *AuditorController {
+func NewAuditController(validator validation.Validator, schedule Schedule, entitiesSources ...domain.EntitiesSource) *AuditorController {
 	auditController := &AuditorController{
-		entitiesSources: entitiesSources,
-		auditEvent:      make(chan AuditEvent, 1),
-		validator:       validator,
-		auditInterval:   auditInterval,
+		clusters:  []*AuditCluster{newAuditCluster("", validator, false, entitiesSources)},
+		queued:    make(chan struct{}, 1),
+		schedules: []AuditSchedule{{Schedule: schedule}},
+		workers:   1,
+		pageSize:  entitiesSizeLimit,
+		history:   NewAuditHistory(defaultHistorySize),
 	}
 	auditController.auditEventListener = auditController.doAudit
 	return auditController
 }
 
+// RegisterAuditCompleteListener adds a listener that is called after an audit finishes validating all entities
+func (a *AuditorController) RegisterAuditCompleteListener(auditCompleteListener AuditEventListener) {
+	a.completeListeners = append(a.completeListeners, auditCompleteListener)
+}
+
+// RegisterAuditResultListener adds a listener that is called with the result of each audit that finishes validating all entities
+func (a *AuditorController) RegisterAuditResultListener(auditResultListener AuditResultListener) {
+	a.resultListeners = append(a.resultListeners, auditResultListener)
+}
+
+// AddScheduleOverride audits entities in scope on their own schedule and excludes them from the default schedule
+func (a *AuditorController) AddScheduleOverride(schedule Schedule, scope AuditScope) {
+	a.schedules[0].Scope.Excludes = append(a.schedules[0].Scope.Excludes, scope)
+	a.schedules = append(a.schedules, AuditSchedule{Schedule: schedule, Scope: scope})
+}
+
+// SetJitter delays each scheduled audit by a random duration up to jitter
+func (a *AuditorController) SetJitter(jitter time.Duration) {
+	a.jitter = jitter
+}
+
 // RegisterAuditEventListener adds a listener that reacts to audit events, replaces existing listener
 func (a *AuditorController) RegisterAuditEventListener(auditEventListener AuditEventListener) {
 	a.auditEventListener = auditEventListener
 }
 
+// SetConcurrency sets the number of workers validating entities and the number of entities listed per page
+func (a *AuditorController) SetConcurrency(workers, pageSize int) {
+	if workers > 0 {
+		a.workers = workers
+	}
+	if pageSize > 0 {
+		a.pageSize = pageSize
+	}
+}
+
+// SetClusterID sets the id of the cluster running the agent
+func (a *AuditorController) SetClusterID(clusterID string) {
+	a.clusters[0].id = clusterID
+}
+
+// SetOwnerResolver enables auditing entities that have owners, their results are attributed to the top level owner
+func (a *AuditorController) SetOwnerResolver(ownerResolver domain.OwnerResolver) {
+	a.clusters[0].SetOwnerResolver(ownerResolver)
+}
+
+// SetEntitiesSources replaces the entities sources, running audits keep using the previous sources
+func (a *AuditorController) SetEntitiesSources(entitiesSources ...domain.EntitiesSource) {
+	a.clusters[0].SetEntitiesSources(entitiesSources...)
+}
+
+// SetSkippedKinds sets the kinds that are not audited with the reason, reported in the audit results
+func (a *AuditorController) SetSkippedKinds(skippedKinds map[string]string) {
+	a.clusters[0].SetSkippedKinds(skippedKinds)
+}
+
+// AddCluster audits a remote cluster with its own entities sources, the validator stamps the cluster id on its results
+func (a *AuditorController) AddCluster(clusterID string, validator validation.Validator, entitiesSources ...domain.EntitiesSource) *AuditCluster {
+	cluster := newAuditCluster(clusterID, validator, true, entitiesSources)
+	a.clusters = append(a.clusters, cluster)
+	return cluster
+}
+
+// ClusterIDs returns the ids of the audited clusters
+func (a *AuditorController) ClusterIDs() []string {
+	ids := make([]string, 0, len(a.clusters))
+	for _, cluster := range a.clusters {
+		ids = append(ids, cluster.id)
+	}
+	return ids
+}
+
+// SetHistorySize sets the number of audit results kept in the history
+func (a *AuditorController) SetHistorySize(size int) {
+	a.history = NewAuditHistory(size)
+}
+
+// History returns the results of the latest audits, it serves them as json over http
+func (a *AuditorController) History() *AuditHistory {
+	return a.history
+}
+
 // Start starts the audit controller
 func (a *AuditorController) Start(ctx context.Context) error {
 	logger.Info("starting audit controller...")
-	auditTicker := time.NewTicker(a.auditInterval)
-	defer auditTicker.Stop()
+	nextRuns := make([]time.Time, len(a.schedules))
+	for i := range a.schedules {
+		nextRuns[i] = nextRun(a.schedules[i].Schedule, time.Now(), a.jitter)
+	}
 	for {
+		next := 0
+		for i := range nextRuns {
+			if nextRuns[i].Before(nextRuns[next]) {
+				next = i
+			}
+		}
+		logger.Debugw("next scheduled audit", "time", nextRuns[next])
+		auditTimer := time.NewTimer(time.Until(nextRuns[next]))
 		select {
 		case <-ctx.Done():
+			auditTimer.Stop()
 			logger.Info("stopping audit controller...")
 			return nil
-		case <-auditTicker.C:
-			auditEvent := AuditEvent{Type: AuditEventTypePeriodical}
+		case <-auditTimer.C:
+			auditEvent := AuditEvent{Type: AuditEventTypePeriodical, Scope: a.schedules[next].Scope}
 			a.auditEventListener(ctx, auditEvent)
-		case event := <-a.auditEvent:
-			a.auditEventListener(ctx, event)
+			nextRuns[next] = nextRun(a.schedules[next].Schedule, time.Now(), a.jitter)
+		case <-a.queued:
+			auditTimer.Stop()
+			for ctx.Err() == nil {
+				event, ok := a.dequeue()
+				if !ok {
+					break
+				}
+				a.auditEventListener(ctx, event)
+			}
 		}
 	}
 }
 
-// doAudit lists available entities and performs validation on each entity
+// doAudit lists available entities of each cluster and validates them concurrently using a pool of workers
 func (a *AuditorController) doAudit(ctx context.Context, auditEvent AuditEvent) {
 	logger.Infof("starting %s", auditEvent.Type)
-	for i := range a.entitiesSources {
+	tracker := newAuditTracker(auditEvent.Type, auditEvent.Report)
+	auditEvent.Audited = newAuditedEntities()
+	for _, cluster := range a.clusters {
+		if ctx.Err() != nil {
+			break
+		}
+		validator := cluster.validator
+		if auditEvent.Validators != nil {
+			validator = auditEvent.Validators[cluster.id]
+			if validator == nil {
+				continue
+			}
+		}
+		a.auditCluster(ctx, cluster, validator, auditEvent, tracker)
+	}
+
+	if ctx.Err() != nil {
+		logger.Infow("audit cancelled", "type", auditEvent.Type, "error", ctx.Err())
+		auditEvent.Cancelled = true
+		a.notifyComplete(ctx, auditEvent)
+		a.recordResult(tracker.finish(true), auditEvent.Partial())
+		return
+	}
+	a.notifyComplete(ctx, auditEvent)
+	result := tracker.finish(false)
+	a.recordResult(result, auditEvent.Partial())
+	if auditEvent.Validators == nil {
+		for _, listener := range a.resultListeners {
+			listener(ctx, auditEvent, result)
+		}
+	}
+	logger.Infow(
+		"finished audit",
+		"type", auditEvent.Type,
+		"duration", result.EndTime.Sub(result.StartTime).String(),
+		"entities", result.Entities,
+		"violations", result.Violations,
+		"skipped-kinds", len(result.SkippedKinds),
+		"errors", len(result.Errors))
+}
+
+// notifyComplete calls the complete listeners, cancelled audits are notified so that listeners drop their partial results
+func (a *AuditorController) notifyComplete(ctx context.Context, auditEvent AuditEvent) {
+	for _, listener := range a.completeListeners {
+		listener(ctx, auditEvent)
+	}
+}
+
+// auditCluster validates the entities of a cluster
+func (a *AuditorController) auditCluster(
+	ctx context.Context,
+	cluster *AuditCluster,
+	validator validation.Validator,
+	auditEvent AuditEvent,
+	tracker *auditTracker,
+) {
+	if err := cluster.getUnavailable(); err != nil {
+		logger.Warnw("skipping audit of unavailable cluster", "type", auditEvent.Type, "cluster", cluster.id, "error", err)
+		tracker.addError(fmt.Errorf("cluster %s is unavailable: %w", cluster.id, err), !cluster.remote)
+		return
+	}
+	if cluster.remote {
+		logger.Infow("auditing cluster", "type", auditEvent.Type, "cluster", cluster.id)
+	}
+	for kind, reason := range cluster.getSkippedKinds() {
+		tracker.skipKind(cluster.kindKey(kind), reason)
+	}
+	ownerResolver := cluster.getOwnerResolver()
+
+	entities := make(chan domain.Entity, a.workers)
+	var workersGroup sync.WaitGroup
+	for i := 0; i < a.workers; i++ {
+		workersGroup.Add(1)
+		go func() {
+			defer workersGroup.Done()
+			for entity := range entities {
+				if ctx.Err() != nil {
+					continue
+				}
+				if entity.HasParent {
+					owner, err := ownerResolver.Resolve(ctx, entity)
+					if err != nil {
+						logger.Warnw(
+							"failed to resolve entity owner during audit",
+							"cluster", cluster.id,
+							"entity-kind", entity.Kind,
+							"entity-name", entity.Name,
+							"error", err)
+					}
+					entity.Owner = owner
+				}
+				summary, err := validator.Validate(ctx, entity, string(auditEvent.Type))
+				if err != nil {
+					logger.Errorw(
+						"failed to validate entity during audit",
+						"cluster", cluster.id,
+						"entity-kind", entity.Kind,
+						"entity-name", entity.Name,
+						"error", err)
+					tracker.addError(fmt.Errorf("failed to validate %s %s: %w", cluster.kindKey(entity.Kind), entity.Name, err), !cluster.remote)
+					auditEvent.Audited.addFailedEntity(cluster.id, entity)
+					continue
+				}
+				tracker.addValidated(cluster.kindKey(entity.Kind), !cluster.remote, summary)
+			}
+		}()
+	}
+
+	a.listEntities(ctx, cluster, auditEvent, entities, tracker)
+	close(entities)
+	workersGroup.Wait()
+}
+
+// recordResult adds the result of a finished audit to the history and the metrics
+func (a *AuditorController) recordResult(result AuditResult, partial bool) {
+	a.history.Add(result)
+	recordMetrics(result, partial)
+}
+
+// listEntities pages through the entities sources and sends entities within scope to the workers
+func (a *AuditorController) listEntities(
+	ctx context.Context,
+	cluster *AuditCluster,
+	auditEvent AuditEvent,
+	entities chan<- domain.Entity,
+	tracker *auditTracker,
+) {
+	scope := auditEvent.Scope
+	entitiesSources := cluster.getEntitiesSources()
+	ownerResolver := cluster.getOwnerResolver()
+	for i := range entitiesSources {
 		hasNext := true
 		keySet := ""
-		entitySource := a.entitiesSources[i]
+		entitySource := entitiesSources[i]
+		if !scope.MatchKind(entitySource.Kind()) {
+			continue
+		}
+		auditEvent.Audited.addListed(cluster.id, entitySource.Kind())
 		for hasNext {
+			if ctx.Err() != nil {
+				return
+			}
 			opts := domain.ListOptions{
-				Limit:  entitiesSizeLimit,
+				Limit:  a.pageSize,
 				KeySet: keySet,
 			}
 			entitiesList, err := entitySource.List(ctx, &opts)
 			if err != nil {
-				logger.Errorw("failed to list entities during audit", "kind", entitySource.Kind(), "error", err)
+				logger.Errorw("failed to list entities during audit", "cluster", cluster.id, "kind", entitySource.Kind(), "error", err)
+				tracker.addError(fmt.Errorf("failed to list %s: %w", cluster.kindKey(entitySource.Kind()), err), !cluster.remote)
+				tracker.skipKind(cluster.kindKey(entitySource.Kind()), SkipReasonListError)
+				auditEvent.Audited.addFailedKind(cluster.id, entitySource.Kind())
 				break
 			}
 			hasNext = entitiesList.HasNext
@@ -76,27 +324,49 @@ func (a *AuditorController) doAudit(ctx context.Context, auditEvent AuditEvent)
 
 			for idx := range entitiesList.Data {
 				entity := entitiesList.Data[idx]
-				if entity.HasParent {
+				if entity.HasParent && ownerResolver == nil {
 					continue
 				}
-				_, err := a.validator.Validate(ctx, entity, string(auditEvent.Type))
-				if err != nil {
-					logger.Errorw(
-						"failed to validate entity during audit",
-						"entity-kind", entity.Kind,
-						"entity-name", entity.Name,
-						"error", err)
+				if !scope.Match(entity.Kind, entity.Namespace) {
+					continue
+				}
+				select {
+				case entities <- entity:
+				case <-ctx.Done():
+					return
 				}
 			}
+			tracker.report()
 		}
 	}
-	logger.Info("finished audit")
+}
+
+// Trigger queues an audit event without blocking, queued events are audited in order once the running audit finishes
+func (a *AuditorController) Trigger(auditEvent AuditEvent) {
+	a.queueLock.Lock()
+	a.queue = append(a.queue, auditEvent)
+	a.queueLock.Unlock()
+	select {
+	case a.queued <- struct{}{}:
+	default:
+	}
+}
+
+func (a *AuditorController) dequeue() (AuditEvent, bool) {
+	a.queueLock.Lock()
+	defer a.queueLock.Unlock()
+	if len(a.queue) == 0 {
+		return AuditEvent{}, false
+	}
+	auditEvent := a.queue[0]
+	a.queue = a.queue[1:]
+	return auditEvent, true
 }
 
 // Audit triggers an audit with specified audit type
 func (a *AuditorController) Audit(auditType AuditEventType, data interface{}) {
-	a.auditEvent <- AuditEvent{
+	a.Trigger(AuditEvent{
 		Type: auditType,
 		Data: data,
-	}
+	})
 }
@@ -2,6 +2,8 @@ package auditor
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"testing"
 	"time"
 
@@ -9,6 +11,7 @@ import (
 	"github.com/stretchr/testify/require"
 	entitiesmock "github.com/weaveworks/policy-agent/internal/entities/mock"
 	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+	"github.com/weaveworks/policy-agent/pkg/policy-core/validation"
 	validationmock "github.com/weaveworks/policy-agent/pkg/policy-core/validation/mock"
 	"golang.org/x/sync/errgroup"
 )
@@ -29,17 +32,19 @@ func TestNewAuditController(t *testing.T) {
 		{
 			name: "standard test",
 			want: &AuditorController{
-				entitiesSources: []domain.EntitiesSource{entitiesSource},
-				validator:       validator,
+				clusters: []*AuditCluster{
+					{entitiesSources: []domain.EntitiesSource{entitiesSource}, validator: validator},
+				},
 			},
 		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			assert := require.New(t)
-			got := NewAuditController(validator, auditInterval, entitiesSource)
-			assert.Equal(test.want.entitiesSources, got.entitiesSources, "unexpected auditor entities source")
-			assert.Equal(test.want.validator, got.validator, "unexpected auditor validator")
+			got := NewAuditController(validator, NewIntervalSchedule(auditInterval), entitiesSource)
+			assert.Len(got.clusters, 1)
+			assert.Equal(test.want.clusters[0].entitiesSources, got.clusters[0].entitiesSources, "unexpected auditor entities source")
+			assert.Equal(test.want.clusters[0].validator, got.clusters[0].validator, "unexpected auditor validator")
 		})
 	}
 }
@@ -131,8 +136,9 @@ func TestAuditorController_doAudit(t *testing.T) {
 			defer ctrl.Finish()
 			validator := validationmock.NewMockValidator(ctrl)
 			entitiesSource := entitiesmock.NewMockEntitiesSource(ctrl)
+			entitiesSource.EXPECT().Kind().AnyTimes().Return("Deployment")
 			test.loadStubs(validator, entitiesSource)
-			a := NewAuditController(validator, auditInterval, entitiesSource)
+			a := NewAuditController(validator, NewIntervalSchedule(auditInterval), entitiesSource)
 			auditEvent := AuditEvent{Type: test.args.auditType}
 			a.doAudit(context.Background(), auditEvent)
 		})
@@ -171,7 +177,7 @@ func TestAuditorController_Audit(t *testing.T) {
 			entitiesSource := entitiesmock.NewMockEntitiesSource(ctrl)
 
 			auditEventChan := make(chan AuditEvent, 1)
-			a := NewAuditController(validator, auditInterval, entitiesSource)
+			a := NewAuditController(validator, NewIntervalSchedule(auditInterval), entitiesSource)
 			a.RegisterAuditEventListener(func(ctx context.Context, auditEvent AuditEvent) {
 				auditEventChan <- auditEvent
 			})
@@ -189,3 +195,335 @@ func TestAuditorController_Audit(t *testing.T) {
 		})
 	}
 }
+
+func TestAuditorController_Trigger(t *testing.T) {
+	assert := require.New(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	validator := validationmock.NewMockValidator(ctrl)
+
+	auditEventChan := make(chan AuditEvent, 3)
+	a := NewAuditController(validator, NewIntervalSchedule(auditInterval))
+	a.RegisterAuditEventListener(func(ctx context.Context, auditEvent AuditEvent) {
+		auditEventChan <- auditEvent
+	})
+	// triggers do not block while the controller is busy
+	a.Trigger(AuditEvent{Type: AuditEventTypeAuditRun, Data: "first"})
+	a.Trigger(AuditEvent{Type: AuditEventTypeAuditRun, Data: "second"})
+	a.Audit(AuditEventTypeInitial, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	eg := errgroup.Group{}
+	eg.Go(func() error {
+		return a.Start(ctx)
+	})
+	for _, data := range []interface{}{"first", "second", nil} {
+		select {
+		case event := <-auditEventChan:
+			assert.Equal(data, event.Data)
+		case <-time.After(time.Second):
+			assert.Fail("audit event not received")
+		}
+	}
+	cancel()
+	assert.Nil(eg.Wait(), "auditor controller not stopped properly")
+}
+
+func TestAuditScope_Match(t *testing.T) {
+	override := AuditScope{Kinds: []string{"Pod"}, Namespaces: []string{"dev"}}
+	kindOverride := AuditScope{Kinds: []string{"Job"}}
+	tests := []struct {
+		name      string
+		scope     AuditScope
+		kind      string
+		namespace string
+		matchKind bool
+		match     bool
+	}{
+		{
+			name:      "empty scope matches everything",
+			kind:      "Deployment",
+			namespace: "default",
+			matchKind: true,
+			match:     true,
+		},
+		{
+			name:      "kind outside of scope",
+			scope:     AuditScope{Kinds: []string{"Deployment"}},
+			kind:      "Pod",
+			namespace: "default",
+		},
+		{
+			name:      "namespace outside of scope",
+			scope:     AuditScope{Namespaces: []string{"dev"}},
+			kind:      "Pod",
+			namespace: "default",
+			matchKind: true,
+		},
+		{
+			name:      "entity excluded by override",
+			scope:     AuditScope{Excludes: []AuditScope{override}},
+			kind:      "Pod",
+			namespace: "dev",
+			matchKind: true,
+		},
+		{
+			name:      "entity of overridden kind in other namespace",
+			scope:     AuditScope{Excludes: []AuditScope{override}},
+			kind:      "Pod",
+			namespace: "prod",
+			matchKind: true,
+			match:     true,
+		},
+		{
+			name:  "kind excluded by override",
+			scope: AuditScope{Excludes: []AuditScope{kindOverride}},
+			kind:  "Job",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert := require.New(t)
+			assert.Equal(test.matchKind, test.scope.MatchKind(test.kind))
+			assert.Equal(test.match, test.scope.Match(test.kind, test.namespace))
+		})
+	}
+}
+
+func TestParseSchedule(t *testing.T) {
+	assert := require.New(t)
+	now := time.Date(2023, 1, 1, 10, 30, 0, 0, time.UTC)
+
+	schedule, err := ParseSchedule("0 2 * * *")
+	assert.NoError(err)
+	assert.Equal(time.Date(2023, 1, 2, 2, 0, 0, 0, time.UTC), schedule.Next(now))
+
+	schedule, err = ParseSchedule("@every 15m")
+	assert.NoError(err)
+	assert.Equal(now.Add(15*time.Minute), schedule.Next(now))
+
+	_, err = ParseSchedule("every day")
+	assert.Error(err)
+
+	next := nextRun(NewIntervalSchedule(time.Hour), now, time.Minute)
+	assert.False(next.Before(now.Add(time.Hour)))
+	assert.True(next.Before(now.Add(time.Hour + time.Minute)))
+}
+
+func TestAuditorController_ScheduleOverride(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	validator := validationmock.NewMockValidator(ctrl)
+	entitiesSource := entitiesmock.NewMockEntitiesSource(ctrl)
+	entitiesSource.EXPECT().Kind().AnyTimes().Return("Pod")
+	entitiesSource.EXPECT().List(gomock.Any(), gomock.Any()).Times(2).Return(&domain.EntitiesList{
+		Data: []domain.Entity{
+			{Name: "dev-pod", Kind: "Pod", Namespace: "dev"},
+			{Name: "prod-pod", Kind: "Pod", Namespace: "prod"},
+		},
+	}, nil)
+	var audited []string
+	validator.EXPECT().Validate(gomock.Any(), gomock.Any(), gomock.Any()).Times(2).
+		DoAndReturn(func(_ context.Context, entity domain.Entity, _ string) (*domain.PolicyValidationSummary, error) {
+			audited = append(audited, entity.Name)
+			return &domain.PolicyValidationSummary{}, nil
+		})
+
+	a := NewAuditController(validator, NewIntervalSchedule(auditInterval), entitiesSource)
+	a.AddScheduleOverride(NewIntervalSchedule(time.Minute), AuditScope{Namespaces: []string{"dev"}})
+
+	assert := require.New(t)
+	assert.Len(a.schedules, 2)
+	a.doAudit(context.Background(), AuditEvent{Type: AuditEventTypePeriodical, Scope: a.schedules[0].Scope})
+	a.doAudit(context.Background(), AuditEvent{Type: AuditEventTypePeriodical, Scope: a.schedules[1].Scope})
+	assert.Equal([]string{"prod-pod", "dev-pod"}, audited)
+}
+
+func TestAuditorController_doAuditConcurrently(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	validator := validationmock.NewMockValidator(ctrl)
+	deployments := entitiesmock.NewMockEntitiesSource(ctrl)
+	pods := entitiesmock.NewMockEntitiesSource(ctrl)
+	deployments.EXPECT().Kind().AnyTimes().Return("Deployment")
+	pods.EXPECT().Kind().AnyTimes().Return("Pod")
+
+	var entities []domain.Entity
+	for i := 0; i < 20; i++ {
+		entities = append(entities, domain.Entity{Name: fmt.Sprintf("entity-%d", i)})
+	}
+	deployments.EXPECT().List(gomock.Any(), &domain.ListOptions{Limit: 10}).
+		Times(1).Return(&domain.EntitiesList{Data: entities[:10]}, nil)
+	pods.EXPECT().List(gomock.Any(), &domain.ListOptions{Limit: 10}).
+		Times(1).Return(&domain.EntitiesList{Data: entities[10:]}, nil)
+	validator.EXPECT().Validate(gomock.Any(), gomock.Any(), gomock.Any()).
+		Times(len(entities)).Return(&domain.PolicyValidationSummary{}, nil)
+
+	a := NewAuditController(validator, NewIntervalSchedule(auditInterval), deployments, pods)
+	a.SetConcurrency(4, 10)
+	a.doAudit(context.Background(), AuditEvent{Type: AuditEventTypeInitial})
+}
+
+func TestAuditorController_doAuditCancelled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	validator := validationmock.NewMockValidator(ctrl)
+	entitiesSource := entitiesmock.NewMockEntitiesSource(ctrl)
+	entitiesSource.EXPECT().Kind().AnyTimes().Return("Deployment")
+	entitiesSource.EXPECT().List(gomock.Any(), gomock.Any()).Times(0)
+	validator.EXPECT().Validate(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	a := NewAuditController(validator, NewIntervalSchedule(auditInterval), entitiesSource)
+	a.SetConcurrency(4, 0)
+	a.doAudit(ctx, AuditEvent{Type: AuditEventTypeInitial})
+}
+
+type fakeOwnerResolver struct {
+	owner *domain.EntityOwner
+}
+
+func (f *fakeOwnerResolver) Resolve(_ context.Context, _ domain.Entity) (*domain.EntityOwner, error) {
+	return f.owner, nil
+}
+
+func TestAuditorController_OwnedEntities(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	validator := validationmock.NewMockValidator(ctrl)
+	entitiesSource := entitiesmock.NewMockEntitiesSource(ctrl)
+	entitiesSource.EXPECT().Kind().AnyTimes().Return("Pod")
+	entitiesSource.EXPECT().List(gomock.Any(), gomock.Any()).AnyTimes().Return(&domain.EntitiesList{
+		Data: []domain.Entity{
+			{Name: "nginx-5d8f-x2k", Kind: "Pod", HasParent: true},
+			{Name: "standalone", Kind: "Pod"},
+		},
+	}, nil)
+
+	owner := &domain.EntityOwner{APIVersion: "apps/v1", Kind: "Deployment", Name: "nginx", Namespace: "default"}
+	var audited []domain.Entity
+	validator.EXPECT().Validate(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().
+		DoAndReturn(func(_ context.Context, entity domain.Entity, _ string) (*domain.PolicyValidationSummary, error) {
+			audited = append(audited, entity)
+			return &domain.PolicyValidationSummary{}, nil
+		})
+
+	a := NewAuditController(validator, NewIntervalSchedule(auditInterval), entitiesSource)
+	a.doAudit(context.Background(), AuditEvent{Type: AuditEventTypeInitial})
+	require.Len(t, audited, 1)
+	require.Equal(t, "standalone", audited[0].Name)
+
+	audited = nil
+	a.SetOwnerResolver(&fakeOwnerResolver{owner: owner})
+	a.doAudit(context.Background(), AuditEvent{Type: AuditEventTypeInitial})
+	require.Len(t, audited, 2)
+	require.Equal(t, owner, audited[0].Owner)
+	require.Nil(t, audited[1].Owner)
+}
+
+func TestAuditorController_Clusters(t *testing.T) {
+	assert := require.New(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	newSource := func(name string) *entitiesmock.MockEntitiesSource {
+		source := entitiesmock.NewMockEntitiesSource(ctrl)
+		source.EXPECT().Kind().AnyTimes().Return("Deployment")
+		source.EXPECT().List(gomock.Any(), gomock.Any()).AnyTimes().Return(&domain.EntitiesList{
+			Data: []domain.Entity{{Name: name, Kind: "Deployment"}},
+		}, nil)
+		return source
+	}
+	newValidator := func(audited *[]string) *validationmock.MockValidator {
+		validator := validationmock.NewMockValidator(ctrl)
+		validator.EXPECT().Validate(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().
+			DoAndReturn(func(_ context.Context, entity domain.Entity, _ string) (*domain.PolicyValidationSummary, error) {
+				*audited = append(*audited, entity.Name)
+				return &domain.PolicyValidationSummary{
+					Compliances: []domain.PolicyValidation{{Policy: domain.Policy{ID: "policy-1"}}},
+				}, nil
+			})
+		return validator
+	}
+
+	var hubAudited, remoteAudited, runAudited []string
+	a := NewAuditController(newValidator(&hubAudited), NewIntervalSchedule(auditInterval), newSource("hub-app"))
+	a.SetClusterID("hub")
+	remote := a.AddCluster("remote", newValidator(&remoteAudited), newSource("remote-app"))
+	remote.SetSkippedKinds(map[string]string{"Secret": SkipReasonRBACDenied})
+	assert.Equal([]string{"hub", "remote"}, a.ClusterIDs())
+
+	a.doAudit(context.Background(), AuditEvent{Type: AuditEventTypeInitial})
+	assert.Equal([]string{"hub-app"}, hubAudited)
+	assert.Equal([]string{"remote-app"}, remoteAudited)
+	result := a.History().List()[0]
+	assert.Equal(map[string]int{"Deployment": 1, "remote/Deployment": 1}, result.EntitiesPerKind)
+	assert.Equal(map[string]string{"remote/Secret": SkipReasonRBACDenied}, result.SkippedKinds)
+	assert.Equal(map[string]int{"policy-1": 2}, result.CompliancesPerPolicy)
+	assert.Equal(map[string]int{"policy-1": 1}, result.LocalCompliancesPerPolicy)
+
+	// clusters without an overriding validator are not audited
+	a.doAudit(context.Background(), AuditEvent{
+		Type:       AuditEventTypeAuditRun,
+		Validators: map[string]validation.Validator{"remote": newValidator(&runAudited)},
+	})
+	assert.Equal([]string{"remote-app"}, runAudited)
+	assert.Len(hubAudited, 1)
+
+	// unavailable clusters are reported as audit errors
+	remote.SetUnavailable(errors.New("connection refused"))
+	a.doAudit(context.Background(), AuditEvent{Type: AuditEventTypePeriodical})
+	assert.Len(hubAudited, 2)
+	assert.Len(remoteAudited, 1)
+	result = a.History().List()[0]
+	assert.Equal([]string{"cluster remote is unavailable: connection refused"}, result.Errors)
+	assert.False(result.LocalFailed)
+}
+
+func TestAuditorController_ResultListener(t *testing.T) {
+	assert := require.New(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	source := entitiesmock.NewMockEntitiesSource(ctrl)
+	source.EXPECT().Kind().AnyTimes().Return("Deployment")
+	source.EXPECT().List(gomock.Any(), gomock.Any()).AnyTimes().Return(&domain.EntitiesList{
+		Data: []domain.Entity{{Name: "app-1", Kind: "Deployment"}, {Name: "app-2", Kind: "Deployment"}},
+	}, nil)
+	validator := validationmock.NewMockValidator(ctrl)
+	validator.EXPECT().Validate(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().
+		DoAndReturn(func(_ context.Context, entity domain.Entity, _ string) (*domain.PolicyValidationSummary, error) {
+			summary := &domain.PolicyValidationSummary{
+				Compliances: []domain.PolicyValidation{{Policy: domain.Policy{ID: "policy-1"}}},
+			}
+			if entity.Name == "app-1" {
+				summary.Violations = []domain.PolicyValidation{{Policy: domain.Policy{ID: "policy-2"}}}
+			} else {
+				summary.Compliances = append(summary.Compliances, domain.PolicyValidation{Policy: domain.Policy{ID: "policy-2"}})
+			}
+			return summary, nil
+		})
+
+	var results []AuditResult
+	a := NewAuditController(validator, NewIntervalSchedule(auditInterval), source)
+	a.RegisterAuditResultListener(func(_ context.Context, _ AuditEvent, result AuditResult) {
+		results = append(results, result)
+	})
+
+	a.doAudit(context.Background(), AuditEvent{Type: AuditEventTypeInitial})
+	assert.Len(results, 1)
+	assert.False(results[0].EndTime.IsZero())
+	assert.Equal(map[string]int{"policy-2": 1}, results[0].ViolationsPerPolicy)
+	assert.Equal(map[string]int{"policy-1": 2, "policy-2": 1}, results[0].CompliancesPerPolicy)
+
+	// audits with overriding validators and cancelled audits are not reported
+	a.doAudit(context.Background(), AuditEvent{
+		Type:       AuditEventTypeAuditRun,
+		Validators: map[string]validation.Validator{"": validator},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	a.doAudit(ctx, AuditEvent{Type: AuditEventTypePeriodical})
+	assert.Len(results, 1)
+}
@@ -0,0 +1,99 @@
+package auditor
+
+import (
+	"sync"
+
+	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+	"github.com/weaveworks/policy-agent/pkg/policy-core/validation"
+)
+
+// AuditCluster holds the entities sources and the validator of an audited cluster
+type AuditCluster struct {
+	id        string
+	validator validation.Validator
+	// remote is set for clusters other than the cluster running the agent
+	remote bool
+
+	lock            sync.RWMutex
+	entitiesSources []domain.EntitiesSource
+	// skippedKinds are the kinds without entities sources with the reason
+	skippedKinds  map[string]string
+	ownerResolver domain.OwnerResolver
+	// unavailable is the error of the failed discovery of the cluster, the cluster is not audited while it is set
+	unavailable error
+}
+
+func newAuditCluster(id string, validator validation.Validator, remote bool, entitiesSources []domain.EntitiesSource) *AuditCluster {
+	return &AuditCluster{
+		id:              id,
+		validator:       validator,
+		remote:          remote,
+		entitiesSources: entitiesSources,
+	}
+}
+
+// ID returns the cluster id stamped on the validation results of the cluster
+func (c *AuditCluster) ID() string {
+	return c.id
+}
+
+// SetEntitiesSources replaces the entities sources, running audits keep using the previous sources
+func (c *AuditCluster) SetEntitiesSources(entitiesSources ...domain.EntitiesSource) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.entitiesSources = entitiesSources
+}
+
+// SetSkippedKinds sets the kinds that are not audited with the reason, reported in the audit results
+func (c *AuditCluster) SetSkippedKinds(skippedKinds map[string]string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.skippedKinds = skippedKinds
+}
+
+// SetOwnerResolver enables auditing entities that have owners, their results are attributed to the top level owner
+func (c *AuditCluster) SetOwnerResolver(ownerResolver domain.OwnerResolver) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.ownerResolver = ownerResolver
+}
+
+// SetUnavailable marks the cluster as unavailable with the error, audits report the error instead of auditing the
+// cluster until it is reset with nil
+func (c *AuditCluster) SetUnavailable(err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.unavailable = err
+}
+
+func (c *AuditCluster) getEntitiesSources() []domain.EntitiesSource {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.entitiesSources
+}
+
+func (c *AuditCluster) getSkippedKinds() map[string]string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.skippedKinds
+}
+
+func (c *AuditCluster) getOwnerResolver() domain.OwnerResolver {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.ownerResolver
+}
+
+func (c *AuditCluster) getUnavailable() error {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.unavailable
+}
+
+// kindKey returns the key of the kind in the audit result, kinds of remote clusters are prefixed by the cluster id
+func (c *AuditCluster) kindKey(kind string) string {
+	if !c.remote {
+		return kind
+	}
+	return c.id + "/" + kind
+}
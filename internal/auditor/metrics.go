@@ -0,0 +1,102 @@
+package auditor
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	metricsNamespace = "policy_agent"
+	metricsSubsystem = "audit"
+)
+
+// severities are the policy severities used as metric labels, other severities are reported as other to bound the labels
+var severities = map[string]struct{}{"low": {}, "medium": {}, "high": {}, "critical": {}}
+
+var (
+	auditRunsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "runs_total",
+		Help:      "Number of audits by type and whether they were cancelled",
+	}, []string{"type", "cancelled"})
+	auditDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "duration_seconds",
+		Help:      "Duration of finished audits by type",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 14),
+	}, []string{"type"})
+	auditLastRunTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "last_run_timestamp_seconds",
+		Help:      "End time of the last finished audit by type",
+	}, []string{"type"})
+	auditEntitiesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "entities_total",
+		Help:      "Number of entities validated during audits by kind",
+	}, []string{"kind"})
+	auditViolationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "violations_total",
+		Help:      "Number of violations found during audits by policy severity",
+	}, []string{"severity"})
+	auditSkippedKinds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "skipped_kinds",
+		Help:      "Kinds that were not audited during the last audit with the reason",
+	}, []string{"kind", "reason"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		auditRunsTotal,
+		auditDurationSeconds,
+		auditLastRunTimestamp,
+		auditEntitiesTotal,
+		auditViolationsTotal,
+		auditSkippedKinds,
+	)
+}
+
+// recordMetrics updates the audit metrics with the result of a finished audit, the skipped kinds are replaced
+// only by complete audits of all the kinds and namespaces as partial and cancelled audits skip a subset of them
+func recordMetrics(result AuditResult, partial bool) {
+	auditType := string(result.Type)
+	if result.Cancelled {
+		auditRunsTotal.WithLabelValues(auditType, "true").Inc()
+	} else {
+		auditRunsTotal.WithLabelValues(auditType, "false").Inc()
+		auditDurationSeconds.WithLabelValues(auditType).Observe(result.EndTime.Sub(result.StartTime).Seconds())
+		auditLastRunTimestamp.WithLabelValues(auditType).Set(float64(result.EndTime.Unix()))
+	}
+	for kind, count := range result.EntitiesPerKind {
+		auditEntitiesTotal.WithLabelValues(kind).Add(float64(count))
+	}
+	for severity, count := range result.ViolationsPerSeverity {
+		auditViolationsTotal.WithLabelValues(severity).Add(float64(count))
+	}
+	if partial || result.Cancelled {
+		return
+	}
+	auditSkippedKinds.Reset()
+	for kind, reason := range result.SkippedKinds {
+		auditSkippedKinds.WithLabelValues(kind, reason).Set(1)
+	}
+}
+
+// severityLabel returns the metric label of a policy severity
+func severityLabel(severity string) string {
+	severity = strings.ToLower(severity)
+	if _, ok := severities[severity]; ok {
+		return severity
+	}
+	return "other"
+}
@@ -0,0 +1,201 @@
+package auditor
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/weaveworks/policy-agent/pkg/logger"
+	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+)
+
+const (
+	// SkipReasonRBACDenied is the reason of kinds the agent is not allowed to list
+	SkipReasonRBACDenied = "rbac_denied"
+	// SkipReasonListError is the reason of kinds that failed to be listed
+	SkipReasonListError = "list_error"
+	// maxAuditErrors limits the errors kept in the audit result
+	maxAuditErrors = 20
+	// defaultHistorySize is the number of audit results kept by default
+	defaultHistorySize = 10
+)
+
+// auditTracker collects the result of an audit from the concurrent workers
+type auditTracker struct {
+	lock       sync.Mutex
+	result     AuditResult
+	reportFunc func(result AuditResult)
+}
+
+func newAuditTracker(auditType AuditEventType, report func(result AuditResult)) *auditTracker {
+	result := AuditResult{
+		Type:                  auditType,
+		StartTime:             time.Now(),
+		EntitiesPerKind:       make(map[string]int),
+		ViolationsPerPolicy:   make(map[string]int),
+		ViolationsPerSeverity: make(map[string]int),
+		CompliancesPerPolicy:  make(map[string]int),
+		SkippedKinds:          make(map[string]string),
+
+		LocalViolationsPerPolicy:  make(map[string]int),
+		LocalCompliancesPerPolicy: make(map[string]int),
+	}
+	return &auditTracker{
+		result:     result,
+		reportFunc: report,
+	}
+}
+
+// addValidated records the validated entity, entities of the local cluster are also counted in the local counts
+func (t *auditTracker) addValidated(kind string, local bool, summary *domain.PolicyValidationSummary) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.result.Entities++
+	t.result.EntitiesPerKind[kind]++
+	if summary != nil {
+		t.result.Violations += len(summary.Violations)
+		for i := range summary.Violations {
+			t.result.ViolationsPerPolicy[summary.Violations[i].Policy.ID]++
+			t.result.ViolationsPerSeverity[severityLabel(summary.Violations[i].Policy.Severity)]++
+			if local {
+				t.result.LocalViolationsPerPolicy[summary.Violations[i].Policy.ID]++
+			}
+		}
+		for i := range summary.Compliances {
+			t.result.CompliancesPerPolicy[summary.Compliances[i].Policy.ID]++
+			if local {
+				t.result.LocalCompliancesPerPolicy[summary.Compliances[i].Policy.ID]++
+			}
+		}
+	}
+}
+
+// addError records the error, errors of the local cluster mark its counts as incomplete
+func (t *auditTracker) addError(err error, local bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if local {
+		t.result.LocalFailed = true
+	}
+	if len(t.result.Errors) < maxAuditErrors {
+		t.result.Errors = append(t.result.Errors, err.Error())
+	}
+}
+
+// skipKind records a kind that could not be audited
+func (t *auditTracker) skipKind(kind, reason string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.result.SkippedKinds[kind] = reason
+}
+
+// snapshot returns a copy of the current result
+func (t *auditTracker) snapshot() AuditResult {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.result.copy()
+}
+
+// report sends the partial result to the report function
+func (t *auditTracker) report() {
+	if t.reportFunc == nil {
+		return
+	}
+	t.reportFunc(t.snapshot())
+}
+
+// finish ends the audit and reports the final result
+func (t *auditTracker) finish(cancelled bool) AuditResult {
+	t.lock.Lock()
+	t.result.EndTime = time.Now()
+	t.result.Cancelled = cancelled
+	t.lock.Unlock()
+	result := t.snapshot()
+	if t.reportFunc != nil {
+		t.reportFunc(result)
+	}
+	return result
+}
+
+// copy returns a deep copy of the result
+func (r AuditResult) copy() AuditResult {
+	result := r
+	result.EntitiesPerKind = make(map[string]int, len(r.EntitiesPerKind))
+	for kind, count := range r.EntitiesPerKind {
+		result.EntitiesPerKind[kind] = count
+	}
+	result.ViolationsPerPolicy = make(map[string]int, len(r.ViolationsPerPolicy))
+	for policy, count := range r.ViolationsPerPolicy {
+		result.ViolationsPerPolicy[policy] = count
+	}
+	result.ViolationsPerSeverity = make(map[string]int, len(r.ViolationsPerSeverity))
+	for severity, count := range r.ViolationsPerSeverity {
+		result.ViolationsPerSeverity[severity] = count
+	}
+	result.CompliancesPerPolicy = make(map[string]int, len(r.CompliancesPerPolicy))
+	for policy, count := range r.CompliancesPerPolicy {
+		result.CompliancesPerPolicy[policy] = count
+	}
+	result.SkippedKinds = make(map[string]string, len(r.SkippedKinds))
+	for kind, reason := range r.SkippedKinds {
+		result.SkippedKinds[kind] = reason
+	}
+	result.LocalViolationsPerPolicy = make(map[string]int, len(r.LocalViolationsPerPolicy))
+	for policy, count := range r.LocalViolationsPerPolicy {
+		result.LocalViolationsPerPolicy[policy] = count
+	}
+	result.LocalCompliancesPerPolicy = make(map[string]int, len(r.LocalCompliancesPerPolicy))
+	for policy, count := range r.LocalCompliancesPerPolicy {
+		result.LocalCompliancesPerPolicy[policy] = count
+	}
+	result.Errors = append([]string(nil), r.Errors...)
+	return result
+}
+
+// AuditHistory keeps the results of the latest audits
+type AuditHistory struct {
+	lock    sync.RWMutex
+	size    int
+	results []AuditResult
+}
+
+// NewAuditHistory returns a history that keeps the results of the latest size audits
+func NewAuditHistory(size int) *AuditHistory {
+	if size < 1 {
+		size = defaultHistorySize
+	}
+	return &AuditHistory{size: size}
+}
+
+// Add adds the result of a finished audit and drops the oldest result if the history is full
+func (h *AuditHistory) Add(result AuditResult) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.results = append(h.results, result)
+	if len(h.results) > h.size {
+		h.results = h.results[len(h.results)-h.size:]
+	}
+}
+
+// List returns the kept results, latest first
+func (h *AuditHistory) List() []AuditResult {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	results := make([]AuditResult, 0, len(h.results))
+	for i := len(h.results) - 1; i >= 0; i-- {
+		results = append(results, h.results[i].copy())
+	}
+	return results
+}
+
+// ServeHTTP serves the kept results as json, latest first
+func (h *AuditHistory) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(struct {
+		Audits []AuditResult `json:"audits"`
+	}{Audits: h.List()})
+	if err != nil {
+		logger.Errorw("failed to write audit status", "error", err)
+	}
+}
@@ -0,0 +1,78 @@
+package auditor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	entitiesmock "github.com/weaveworks/policy-agent/internal/entities/mock"
+	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+	validationmock "github.com/weaveworks/policy-agent/pkg/policy-core/validation/mock"
+)
+
+func TestAuditorController_History(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	validator := validationmock.NewMockValidator(ctrl)
+	deployments := entitiesmock.NewMockEntitiesSource(ctrl)
+	services := entitiesmock.NewMockEntitiesSource(ctrl)
+	deployments.EXPECT().Kind().AnyTimes().Return("Deployment")
+	services.EXPECT().Kind().AnyTimes().Return("Service")
+	deployments.EXPECT().List(gomock.Any(), gomock.Any()).AnyTimes().Return(&domain.EntitiesList{
+		Data: []domain.Entity{{Name: "a", Kind: "Deployment"}, {Name: "b", Kind: "Deployment"}},
+	}, nil)
+	services.EXPECT().List(gomock.Any(), gomock.Any()).AnyTimes().Return(nil, errors.New("server error"))
+	validator.EXPECT().Validate(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().Return(&domain.PolicyValidationSummary{
+		Violations: []domain.PolicyValidation{{Policy: domain.Policy{ID: "policy-1", Severity: "High"}}},
+	}, nil)
+
+	a := NewAuditController(validator, NewIntervalSchedule(auditInterval), deployments, services)
+	a.SetHistorySize(2)
+	a.SetSkippedKinds(map[string]string{"Secret": SkipReasonRBACDenied})
+
+	violationsBefore := testutil.ToFloat64(auditViolationsTotal.WithLabelValues("high"))
+	a.doAudit(context.Background(), AuditEvent{Type: AuditEventTypeInitial})
+	a.doAudit(context.Background(), AuditEvent{Type: AuditEventTypePeriodical})
+	a.doAudit(context.Background(), AuditEvent{Type: AuditEventTypeAuditRun})
+
+	history := a.History().List()
+	require.Len(t, history, 2)
+	assert.Equal(t, AuditEventTypeAuditRun, history[0].Type)
+	assert.Equal(t, AuditEventTypePeriodical, history[1].Type)
+
+	result := history[0]
+	assert.False(t, result.Cancelled)
+	assert.False(t, result.EndTime.IsZero())
+	assert.Equal(t, 2, result.Entities)
+	assert.Equal(t, 2, result.Violations)
+	assert.Equal(t, map[string]int{"Deployment": 2}, result.EntitiesPerKind)
+	assert.Equal(t, map[string]int{"policy-1": 2}, result.ViolationsPerPolicy)
+	assert.Equal(t, map[string]int{"high": 2}, result.ViolationsPerSeverity)
+	assert.Equal(t, map[string]string{"Secret": SkipReasonRBACDenied, "Service": SkipReasonListError}, result.SkippedKinds)
+	assert.Len(t, result.Errors, 1)
+
+	assert.Equal(t, violationsBefore+6, testutil.ToFloat64(auditViolationsTotal.WithLabelValues("high")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(auditSkippedKinds.WithLabelValues("Service", SkipReasonListError)))
+
+	recorder := httptest.NewRecorder()
+	a.History().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/audit/status", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var status struct {
+		Audits []AuditResult `json:"audits"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &status))
+	require.Len(t, status.Audits, 2)
+	assert.Equal(t, result.Entities, status.Audits[0].Entities)
+	assert.Equal(t, result.SkippedKinds, status.Audits[0].SkippedKinds)
+
+	// scoped audits do not replace the skipped kinds of the last complete audit
+	a.doAudit(context.Background(), AuditEvent{Type: AuditEventTypeAuditRun, Scope: AuditScope{Kinds: []string{"Deployment"}}})
+	assert.Equal(t, float64(1), testutil.ToFloat64(auditSkippedKinds.WithLabelValues("Service", SkipReasonListError)))
+}
@@ -0,0 +1,44 @@
+package auditor
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Schedule describes when the next audit should be triggered
+type Schedule interface {
+	// Next returns the next activation time, later than the given time
+	Next(time.Time) time.Time
+}
+
+// AuditSchedule binds a schedule to the scope of entities it audits
+type AuditSchedule struct {
+	Schedule Schedule
+	Scope    AuditScope
+}
+
+// ParseSchedule parses a standard cron expression or a descriptor such as "@hourly" and "@every 15m"
+func ParseSchedule(spec string) (Schedule, error) {
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid audit schedule %q: %w", spec, err)
+	}
+	return schedule, nil
+}
+
+// NewIntervalSchedule returns a schedule that activates once every interval
+func NewIntervalSchedule(interval time.Duration) Schedule {
+	return cron.Every(interval)
+}
+
+// nextRun returns the next activation of the schedule delayed by a random duration up to jitter
+func nextRun(schedule Schedule, now time.Time, jitter time.Duration) time.Time {
+	next := schedule.Next(now)
+	if jitter > 0 {
+		next = next.Add(time.Duration(rand.Int63n(int64(jitter))))
+	}
+	return next
+}
@@ -0,0 +1,219 @@
+package auditor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/weaveworks/policy-agent/pkg/logger"
+	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+	"github.com/weaveworks/policy-agent/pkg/uuid-go"
+)
+
+// ViolationDelta is a change in the status of a policy and entity pair between audits
+type ViolationDelta string
+
+const (
+	ViolationDeltaNew            ViolationDelta = "new"
+	ViolationDeltaResolved       ViolationDelta = "resolved"
+	ViolationDeltaStillViolating ViolationDelta = "still_violating"
+)
+
+// ParseViolationDelta returns the violation delta of the given name
+func ParseViolationDelta(name string) (ViolationDelta, error) {
+	switch delta := ViolationDelta(name); delta {
+	case ViolationDeltaNew, ViolationDeltaResolved, ViolationDeltaStillViolating:
+		return delta, nil
+	}
+	return "", fmt.Errorf("unknown violation delta %q", name)
+}
+
+// ViolationState is the last known violation of a policy and entity pair
+type ViolationState struct {
+	Validation   domain.PolicyValidation `json:"validation"`
+	FirstSeen    time.Time               `json:"first_seen"`
+	LastNotified time.Time               `json:"last_notified"`
+}
+
+// StateStore persists the audit state between restarts
+type StateStore interface {
+	// Load returns the stored state, returns empty state if it was never saved
+	Load(ctx context.Context) (map[string]ViolationState, error)
+	// Save replaces the stored state
+	Save(ctx context.Context, state map[string]ViolationState) error
+}
+
+type deltaSubscriber struct {
+	sink   domain.PolicyValidationSink
+	deltas map[ViolationDelta]struct{}
+}
+
+// AuditStateTracker keeps the last known status of each policy and entity pair and
+// writes only the violation deltas to its subscribers
+type AuditStateTracker struct {
+	store               StateStore
+	stillViolatingAfter time.Duration
+	subscribers         []deltaSubscriber
+
+	lock  sync.Mutex
+	state map[string]ViolationState
+	// seen holds the pairs written during the current audit
+	seen map[string]struct{}
+}
+
+// NewAuditStateTracker returns a tracker that persists its state in the store, violations that are still
+// violating are notified again once every stillViolatingAfter, zero disables still violating notifications
+func NewAuditStateTracker(store StateStore, stillViolatingAfter time.Duration) *AuditStateTracker {
+	return &AuditStateTracker{
+		store:               store,
+		stillViolatingAfter: stillViolatingAfter,
+		state:               make(map[string]ViolationState),
+		seen:                make(map[string]struct{}),
+	}
+}
+
+// Subscribe writes the given violation deltas to the sink
+func (t *AuditStateTracker) Subscribe(sink domain.PolicyValidationSink, deltas ...ViolationDelta) {
+	subscriber := deltaSubscriber{sink: sink, deltas: make(map[ViolationDelta]struct{})}
+	for _, delta := range deltas {
+		subscriber.deltas[delta] = struct{}{}
+	}
+	t.subscribers = append(t.subscribers, subscriber)
+}
+
+// Load restores the state saved by a previous run
+func (t *AuditStateTracker) Load(ctx context.Context) error {
+	state, err := t.store.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load audit state: %w", err)
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if state != nil {
+		t.state = state
+	}
+	logger.Infow("loaded audit state", "violations", len(t.state))
+	return nil
+}
+
+// Write tracks validation results and writes their deltas to the subscribers, implements github.com/weaveworks/policy-agent/pkg/policy-core/domain.PolicyValidationSink
+func (t *AuditStateTracker) Write(ctx context.Context, results []domain.PolicyValidation) error {
+	deltas := make(map[ViolationDelta][]domain.PolicyValidation)
+	now := time.Now()
+
+	t.lock.Lock()
+	for _, result := range results {
+		key := stateKey(result)
+		t.seen[key] = struct{}{}
+		previous, tracked := t.state[key]
+
+		if result.Status != domain.PolicyValidationStatusViolating {
+			if tracked {
+				delete(t.state, key)
+				deltas[ViolationDeltaResolved] = append(deltas[ViolationDeltaResolved], result)
+			}
+			continue
+		}
+
+		current := ViolationState{
+			Validation:   compactValidation(result),
+			FirstSeen:    now,
+			LastNotified: now,
+		}
+		if !tracked {
+			deltas[ViolationDeltaNew] = append(deltas[ViolationDeltaNew], result)
+		} else {
+			current.FirstSeen = previous.FirstSeen
+			current.LastNotified = previous.LastNotified
+			if t.stillViolatingAfter > 0 && now.Sub(previous.LastNotified) >= t.stillViolatingAfter {
+				current.LastNotified = now
+				deltas[ViolationDeltaStillViolating] = append(deltas[ViolationDeltaStillViolating], result)
+			}
+		}
+		t.state[key] = current
+	}
+	t.lock.Unlock()
+
+	return t.notify(ctx, deltas)
+}
+
+// OnAuditComplete resolves the violations of the evaluated entities that were not found during the audit and saves the state,
+// cancelled audits resolve nothing, implements github.com/weaveworks/policy-agent/internal/auditor.AuditEventListener
+func (t *AuditStateTracker) OnAuditComplete(ctx context.Context, auditEvent AuditEvent) {
+	if auditEvent.Cancelled {
+		t.lock.Lock()
+		t.seen = make(map[string]struct{})
+		t.lock.Unlock()
+		return
+	}
+
+	var resolved []domain.PolicyValidation
+	now := time.Now()
+
+	t.lock.Lock()
+	for key, state := range t.state {
+		if _, ok := t.seen[key]; ok || !auditEvent.Evaluated(state.Validation.ClusterID, state.Validation.Policy.ID, state.Validation.Entity) {
+			continue
+		}
+		delete(t.state, key)
+		result := state.Validation
+		result.ID = uuid.NewV4().String()
+		result.Status = domain.PolicyValidationStatusCompliant
+		result.Message = ""
+		result.Occurrences = nil
+		result.CreatedAt = now
+		resolved = append(resolved, result)
+	}
+	t.seen = make(map[string]struct{})
+	state := make(map[string]ViolationState, len(t.state))
+	for key, value := range t.state {
+		state[key] = value
+	}
+	t.lock.Unlock()
+
+	err := t.notify(ctx, map[ViolationDelta][]domain.PolicyValidation{ViolationDeltaResolved: resolved})
+	if err != nil {
+		logger.Errorw("failed to write resolved violations", "error", err)
+	}
+
+	err = t.store.Save(ctx, state)
+	if err != nil {
+		logger.Errorw("failed to save audit state", "error", err)
+	}
+}
+
+func (t *AuditStateTracker) notify(ctx context.Context, deltas map[ViolationDelta][]domain.PolicyValidation) error {
+	for _, subscriber := range t.subscribers {
+		var results []domain.PolicyValidation
+		for delta := range subscriber.deltas {
+			results = append(results, deltas[delta]...)
+		}
+		if len(results) == 0 {
+			continue
+		}
+		err := subscriber.sink.Write(ctx, results)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stateKey identifies the policy and entity pair, prefixed by the cluster id when set
+func stateKey(result domain.PolicyValidation) string {
+	entity := result.Entity
+	key := fmt.Sprintf("%s/%s/%s/%s", result.Policy.ID, entity.Kind, entity.Namespace, entity.Name)
+	if result.ClusterID != "" {
+		key = result.ClusterID + "/" + key
+	}
+	return key
+}
+
+// compactValidation drops the fields that are not needed to report a resolved violation to keep the stored state small
+func compactValidation(result domain.PolicyValidation) domain.PolicyValidation {
+	result.Entity.Manifest = nil
+	result.Policy.Code = ""
+	result.Policy.Parameters = nil
+	return result
+}
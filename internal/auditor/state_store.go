@@ -0,0 +1,186 @@
+package auditor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/weaveworks/policy-agent/pkg/logger"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	stateConfigMapKey = "state.json"
+	// maxConfigMapStateSize keeps the config map below the 1MiB object size limit
+	maxConfigMapStateSize = 900 * 1024
+)
+
+// ConfigMapStateStore stores the audit state in a config map
+type ConfigMapStateStore struct {
+	clientSet kubernetes.Interface
+	namespace string
+	name      string
+}
+
+// NewConfigMapStateStore returns a store that keeps the audit state in the config map of the given namespace and name
+func NewConfigMapStateStore(clientSet kubernetes.Interface, namespace, name string) *ConfigMapStateStore {
+	return &ConfigMapStateStore{
+		clientSet: clientSet,
+		namespace: namespace,
+		name:      name,
+	}
+}
+
+// Load returns the state stored in the config map, implements StateStore
+func (s *ConfigMapStateStore) Load(ctx context.Context) (map[string]ViolationState, error) {
+	configMap, err := s.clientSet.CoreV1().ConfigMaps(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get config map %s/%s: %w", s.namespace, s.name, err)
+	}
+	return decodeState([]byte(configMap.Data[stateConfigMapKey]))
+}
+
+// Save writes the state to the config map, creates it if it does not exist, implements StateStore.
+// The least recently notified violations are dropped when the state does not fit in the config map
+func (s *ConfigMapStateStore) Save(ctx context.Context, state map[string]ViolationState) error {
+	data, err := encodeState(state, maxConfigMapStateSize)
+	if err != nil {
+		return err
+	}
+	client := s.clientSet.CoreV1().ConfigMaps(s.namespace)
+	configMap, err := client.Get(ctx, s.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		configMap = &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      s.name,
+				Namespace: s.namespace,
+			},
+			Data: map[string]string{stateConfigMapKey: string(data)},
+		}
+		_, err = client.Create(ctx, configMap, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to create config map %s/%s: %w", s.namespace, s.name, err)
+		}
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to get config map %s/%s: %w", s.namespace, s.name, err)
+	}
+
+	if configMap.Data == nil {
+		configMap.Data = make(map[string]string)
+	}
+	configMap.Data[stateConfigMapKey] = string(data)
+	_, err = client.Update(ctx, configMap, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to update config map %s/%s: %w", s.namespace, s.name, err)
+	}
+	return nil
+}
+
+// FileStateStore stores the audit state in a local file
+type FileStateStore struct {
+	filePath string
+}
+
+// NewFileStateStore returns a store that keeps the audit state in the given file
+func NewFileStateStore(filePath string) *FileStateStore {
+	return &FileStateStore{filePath: filePath}
+}
+
+// Load returns the state stored in the file, implements StateStore
+func (s *FileStateStore) Load(_ context.Context) (map[string]ViolationState, error) {
+	data, err := os.ReadFile(s.filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", s.filePath, err)
+	}
+	return decodeState(data)
+}
+
+// Save replaces the file content with the state, implements StateStore
+func (s *FileStateStore) Save(_ context.Context, state map[string]ViolationState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit state: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.filePath), filepath.Base(s.filePath))
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for %s: %w", s.filePath, err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write file %s: %w", tmp.Name(), err)
+	}
+	err = os.Rename(tmp.Name(), s.filePath)
+	if err != nil {
+		return fmt.Errorf("failed to replace file %s: %w", s.filePath, err)
+	}
+	return nil
+}
+
+// encodeState encodes the state in at most maxSize bytes, keeping the most recently notified violations
+func encodeState(state map[string]ViolationState, maxSize int) ([]byte, error) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode audit state: %w", err)
+	}
+	if len(data) <= maxSize {
+		return data, nil
+	}
+
+	keys := make([]string, 0, len(state))
+	for key := range state {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return state[keys[i]].LastNotified.After(state[keys[j]].LastNotified)
+	})
+	kept := make(map[string]ViolationState)
+	// size accounts for the braces and the separators of the encoded map
+	size := 2
+	for _, key := range keys {
+		entry, err := json.Marshal(map[string]ViolationState{key: state[key]})
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode audit state: %w", err)
+		}
+		if size+len(entry)-1 > maxSize {
+			break
+		}
+		size += len(entry) - 1
+		kept[key] = state[key]
+	}
+	logger.Warnw("audit state exceeds the config map size limit, dropping least recently notified violations",
+		"violations", len(state), "dropped", len(state)-len(kept))
+
+	data, err = json.Marshal(kept)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode audit state: %w", err)
+	}
+	return data, nil
+}
+
+func decodeState(data []byte) (map[string]ViolationState, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var state map[string]ViolationState
+	err := json.Unmarshal(data, &state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode audit state: %w", err)
+	}
+	return state, nil
+}
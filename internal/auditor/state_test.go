@@ -0,0 +1,186 @@
+package auditor
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+type recordingSink struct {
+	results []domain.PolicyValidation
+}
+
+func (r *recordingSink) Write(_ context.Context, results []domain.PolicyValidation) error {
+	r.results = append(r.results, results...)
+	return nil
+}
+
+func (r *recordingSink) names() []string {
+	var names []string
+	for _, result := range r.results {
+		names = append(names, result.Status+":"+result.Entity.Name)
+	}
+	r.results = nil
+	return names
+}
+
+func newValidation(entity, status string) domain.PolicyValidation {
+	return domain.PolicyValidation{
+		Policy: domain.Policy{ID: "policy"},
+		Entity: domain.Entity{
+			Name:      entity,
+			Kind:      "Deployment",
+			Namespace: "default",
+			Manifest:  map[string]interface{}{"kind": "Deployment"},
+		},
+		Status: status,
+	}
+}
+
+func TestAuditStateTracker_Deltas(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	store := NewFileStateStore(filepath.Join(t.TempDir(), "state.json"))
+	tracker := NewAuditStateTracker(store, time.Hour)
+	newSink, resolvedSink, stillViolatingSink := &recordingSink{}, &recordingSink{}, &recordingSink{}
+	tracker.Subscribe(newSink, ViolationDeltaNew)
+	tracker.Subscribe(resolvedSink, ViolationDeltaResolved)
+	tracker.Subscribe(stillViolatingSink, ViolationDeltaStillViolating)
+
+	violating := domain.PolicyValidationStatusViolating
+	compliant := domain.PolicyValidationStatusCompliant
+
+	// first audit reports all violations as new
+	require.NoError(t, tracker.Write(ctx, []domain.PolicyValidation{
+		newValidation("a", violating),
+		newValidation("b", violating),
+		newValidation("c", violating),
+		newValidation("d", compliant),
+	}))
+	tracker.OnAuditComplete(ctx, AuditEvent{})
+	assert.ElementsMatch([]string{"Violation:a", "Violation:b", "Violation:c"}, newSink.names())
+	assert.Empty(resolvedSink.names())
+	assert.Empty(stillViolatingSink.names())
+
+	// second audit, a is still violating, b is compliant and c is no longer found
+	require.NoError(t, tracker.Write(ctx, []domain.PolicyValidation{
+		newValidation("a", violating),
+		newValidation("b", compliant),
+	}))
+	tracker.OnAuditComplete(ctx, AuditEvent{})
+	assert.Empty(newSink.names())
+	assert.ElementsMatch([]string{"Compliance:b", "Compliance:c"}, resolvedSink.names())
+	assert.Empty(stillViolatingSink.names())
+
+	// state survives restarts and a is reported again after the still violating period
+	tracker = NewAuditStateTracker(store, time.Hour)
+	tracker.Subscribe(newSink, ViolationDeltaNew)
+	tracker.Subscribe(stillViolatingSink, ViolationDeltaStillViolating)
+	require.NoError(t, tracker.Load(ctx))
+	require.Contains(t, tracker.state, "policy/Deployment/default/a")
+	assert.Nil(tracker.state["policy/Deployment/default/a"].Validation.Entity.Manifest)
+
+	state := tracker.state["policy/Deployment/default/a"]
+	state.LastNotified = time.Now().Add(-2 * time.Hour)
+	tracker.state["policy/Deployment/default/a"] = state
+	require.NoError(t, tracker.Write(ctx, []domain.PolicyValidation{newValidation("a", violating)}))
+	assert.Empty(newSink.names())
+	assert.Equal([]string{"Violation:a"}, stillViolatingSink.names())
+
+	require.NoError(t, tracker.Write(ctx, []domain.PolicyValidation{newValidation("a", violating)}))
+	assert.Empty(stillViolatingSink.names())
+}
+
+func TestAuditStateTracker_ResolveInScope(t *testing.T) {
+	ctx := context.Background()
+	tracker := NewAuditStateTracker(NewConfigMapStateStore(fake.NewSimpleClientset(), "policy-system", "state"), 0)
+	resolvedSink := &recordingSink{}
+	tracker.Subscribe(resolvedSink, ViolationDeltaResolved)
+
+	pod := newValidation("pod", domain.PolicyValidationStatusViolating)
+	pod.Entity.Kind = "Pod"
+	require.NoError(t, tracker.Write(ctx, []domain.PolicyValidation{
+		newValidation("deployment", domain.PolicyValidationStatusViolating),
+		pod,
+	}))
+	tracker.OnAuditComplete(ctx, AuditEvent{})
+
+	// an audit of pods only does not resolve violations of other kinds
+	tracker.OnAuditComplete(ctx, AuditEvent{Scope: AuditScope{Kinds: []string{"Pod"}}})
+	assert.Equal(t, []string{"Compliance:pod"}, resolvedSink.names())
+
+	loaded, err := tracker.store.Load(ctx)
+	require.NoError(t, err)
+	assert.Len(t, loaded, 1)
+	assert.Contains(t, loaded, "policy/Deployment/default/deployment")
+
+	// an audit of other policies does not resolve violations of the policy
+	tracker.OnAuditComplete(ctx, AuditEvent{Policies: []string{"other"}})
+	assert.Empty(t, resolvedSink.names())
+	assert.Contains(t, tracker.state, "policy/Deployment/default/deployment")
+
+	// a cancelled audit resolves nothing and forgets the pairs seen so far
+	require.NoError(t, tracker.Write(ctx, []domain.PolicyValidation{newValidation("deployment", domain.PolicyValidationStatusViolating)}))
+	tracker.OnAuditComplete(ctx, AuditEvent{Cancelled: true})
+	assert.Empty(t, tracker.seen)
+	assert.Empty(t, resolvedSink.names())
+
+	// violations of kinds that were not listed or failed to be listed and of entities that failed to be validated are kept
+	failedEntity := newAuditedEntities()
+	failedEntity.addListed("", "Deployment")
+	failedEntity.addFailedEntity("", newValidation("deployment", "").Entity)
+	failedKind := newAuditedEntities()
+	failedKind.addListed("", "Deployment")
+	failedKind.addFailedKind("", "Deployment")
+	for _, audited := range []*AuditedEntities{failedEntity, failedKind, newAuditedEntities()} {
+		tracker.OnAuditComplete(ctx, AuditEvent{Audited: audited})
+	}
+	assert.Empty(t, resolvedSink.names())
+	assert.Contains(t, tracker.state, "policy/Deployment/default/deployment")
+
+	audited := newAuditedEntities()
+	audited.addListed("", "Deployment")
+	tracker.OnAuditComplete(ctx, AuditEvent{Audited: audited})
+	assert.Equal(t, []string{"Compliance:deployment"}, resolvedSink.names())
+}
+
+func TestEncodeStateLimit(t *testing.T) {
+	now := time.Now()
+	state := make(map[string]ViolationState)
+	for i := 0; i < 10; i++ {
+		validation := newValidation(fmt.Sprintf("deployment-%d", i), domain.PolicyValidationStatusViolating)
+		state[stateKey(validation)] = ViolationState{
+			Validation:   compactValidation(validation),
+			LastNotified: now.Add(time.Duration(i) * time.Minute),
+		}
+	}
+	data, err := encodeState(state, 1<<20)
+	require.NoError(t, err)
+
+	limit := len(data) / 2
+	data, err = encodeState(state, limit)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, len(data), limit)
+	decoded, err := decodeState(data)
+	require.NoError(t, err)
+	assert.NotEmpty(t, decoded)
+	assert.Less(t, len(decoded), len(state))
+	assert.Contains(t, decoded, "policy/Deployment/default/deployment-9")
+	assert.NotContains(t, decoded, "policy/Deployment/default/deployment-0")
+}
+
+func TestParseViolationDelta(t *testing.T) {
+	delta, err := ParseViolationDelta("still_violating")
+	require.NoError(t, err)
+	assert.Equal(t, ViolationDeltaStillViolating, delta)
+
+	_, err = ParseViolationDelta("unknown")
+	assert.Error(t, err)
+}
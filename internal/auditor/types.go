@@ -1,19 +1,189 @@
 package auditor
 
-import "context"
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+	"github.com/weaveworks/policy-agent/pkg/policy-core/validation"
+)
 
 type AuditEventType string
 
 const (
 	AuditEventTypeInitial    AuditEventType = "initial-audit"
 	AuditEventTypePeriodical AuditEventType = "periodic-audit"
+	AuditEventTypeAuditRun   AuditEventType = "audit-run"
 	entitiesSizeLimit                       = 50
 	TypeAudit                               = "Audit"
 )
 
 type AuditEvent struct {
-	Type AuditEventType
-	Data interface{}
+	Type  AuditEventType
+	Data  interface{}
+	Scope AuditScope
+	// Validators override the validators of the clusters by cluster id, clusters without a validator are not audited
+	Validators map[string]validation.Validator
+	// Policies are the ids of the policies evaluated by the validators, empty means all policies
+	Policies []string
+	// Report is called with the partial result after each listed page and with the final result when the audit finishes
+	Report func(result AuditResult)
+	// Cancelled is set on the events passed to the complete listeners when the audit did not finish
+	Cancelled bool
+	// Audited records the evaluated entities, it is set on the events passed to the complete listeners
+	Audited *AuditedEntities
+}
+
+// Evaluated reports whether the audit evaluated the entity of the cluster against the policy,
+// events without audited entities evaluate every entity in scope
+func (e *AuditEvent) Evaluated(clusterID, policyID string, entity domain.Entity) bool {
+	if e.Cancelled || !contains(e.Policies, policyID) || !e.Scope.Match(entity.Kind, entity.Namespace) {
+		return false
+	}
+	return e.Audited == nil || e.Audited.evaluated(clusterID, entity)
+}
+
+// Partial reports whether the audit evaluates only part of the entities, policies or clusters
+func (e *AuditEvent) Partial() bool {
+	return !e.Scope.IsEmpty() || len(e.Policies) > 0 || e.Validators != nil
+}
+
+// AuditedEntities records the kinds listed by an audit and the entities that failed to be validated
+type AuditedEntities struct {
+	lock sync.Mutex
+	// listed holds the listed kinds of each cluster
+	listed map[string]struct{}
+	// failed holds the kinds that failed to be listed and the entities that failed to be validated
+	failed map[string]struct{}
+}
+
+func newAuditedEntities() *AuditedEntities {
+	return &AuditedEntities{
+		listed: make(map[string]struct{}),
+		failed: make(map[string]struct{}),
+	}
+}
+
+func (a *AuditedEntities) addListed(clusterID, kind string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.listed[clusterID+"/"+kind] = struct{}{}
+}
+
+func (a *AuditedEntities) addFailedKind(clusterID, kind string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.failed[clusterID+"/"+kind] = struct{}{}
+}
+
+func (a *AuditedEntities) addFailedEntity(clusterID string, entity domain.Entity) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.failed[entityKey(clusterID, entity)] = struct{}{}
+}
+
+// evaluated reports whether the kind of the entity was listed without errors and the entity was validated
+func (a *AuditedEntities) evaluated(clusterID string, entity domain.Entity) bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	kind := clusterID + "/" + entity.Kind
+	if _, ok := a.listed[kind]; !ok {
+		return false
+	}
+	if _, ok := a.failed[kind]; ok {
+		return false
+	}
+	_, failed := a.failed[entityKey(clusterID, entity)]
+	return !failed
+}
+
+func entityKey(clusterID string, entity domain.Entity) string {
+	return clusterID + "/" + entity.Kind + "/" + entity.Namespace + "/" + entity.Name
+}
+
+// AuditResult summarizes the entities validated during an audit
+type AuditResult struct {
+	Type      AuditEventType `json:"type"`
+	StartTime time.Time      `json:"start_time"`
+	// EndTime is zero until the audit finishes
+	EndTime    time.Time `json:"end_time"`
+	Cancelled  bool      `json:"cancelled"`
+	Entities   int       `json:"entities"`
+	Violations int       `json:"violations"`
+	// EntitiesPerKind is the number of entities validated of each kind
+	EntitiesPerKind map[string]int `json:"entities_per_kind"`
+	// ViolationsPerPolicy is the number of violations found of each policy id
+	ViolationsPerPolicy map[string]int `json:"violations_per_policy"`
+	// ViolationsPerSeverity is the number of violations found of each policy severity, unknown severities are counted as other
+	ViolationsPerSeverity map[string]int `json:"violations_per_severity"`
+	// CompliancesPerPolicy is the number of compliant entities of each policy id
+	CompliancesPerPolicy map[string]int `json:"compliances_per_policy"`
+	// SkippedKinds are the kinds that were not audited with the reason
+	SkippedKinds map[string]string `json:"skipped_kinds,omitempty"`
+	Errors       []string          `json:"errors,omitempty"`
+	// LocalViolationsPerPolicy and LocalCompliancesPerPolicy count the entities of the cluster running the agent only
+	LocalViolationsPerPolicy  map[string]int `json:"-"`
+	LocalCompliancesPerPolicy map[string]int `json:"-"`
+	// LocalFailed is set when entities of the cluster running the agent could not be listed or validated, the local
+	// counts are then incomplete
+	LocalFailed bool `json:"-"`
 }
 
 type AuditEventListener func(ctx context.Context, auditEvent AuditEvent)
+
+// AuditResultListener is called with the result of each finished audit
+type AuditResultListener func(ctx context.Context, auditEvent AuditEvent, result AuditResult)
+
+// AuditScope limits an audit to entities of specific kinds and namespaces, empty scope matches all entities
+type AuditScope struct {
+	Kinds      []string
+	Namespaces []string
+	// Excludes are scopes audited separately, entities matching any of them are skipped
+	Excludes []AuditScope
+}
+
+// IsEmpty checks if the scope matches all entities
+func (s *AuditScope) IsEmpty() bool {
+	return len(s.Kinds) == 0 && len(s.Namespaces) == 0 && len(s.Excludes) == 0
+}
+
+// MatchKind checks if entities of the given kind could be part of the scope
+func (s *AuditScope) MatchKind(kind string) bool {
+	if !contains(s.Kinds, kind) {
+		return false
+	}
+	for i := range s.Excludes {
+		exclude := s.Excludes[i]
+		if len(exclude.Namespaces) == 0 && len(exclude.Kinds) != 0 && contains(exclude.Kinds, kind) {
+			return false
+		}
+	}
+	return true
+}
+
+// Match checks if an entity of the given kind and namespace is part of the scope
+func (s *AuditScope) Match(kind, namespace string) bool {
+	if !contains(s.Kinds, kind) || !contains(s.Namespaces, namespace) {
+		return false
+	}
+	for i := range s.Excludes {
+		if s.Excludes[i].Match(kind, namespace) {
+			return false
+		}
+	}
+	return true
+}
+
+// contains reports whether value is in list, an empty list contains every value
+func contains(list []string, value string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for i := range list {
+		if list[i] == value {
+			return true
+		}
+	}
+	return false
+}
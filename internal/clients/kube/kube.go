@@ -2,10 +2,15 @@ package kube
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"path"
 	"strings"
 
+	"golang.org/x/time/rate"
 	authv1 "k8s.io/api/authorization/v1"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -14,14 +19,32 @@ import (
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/metadata"
 	"k8s.io/client-go/rest"
 )
 
+const (
+	// nodesPageSize is the number of nodes retrieved per list request when counting the nodes
+	nodesPageSize = 500
+	// reviewQPS and reviewBurst limit the permission reviews sent while discovering the agent permissions
+	reviewQPS   = 20
+	reviewBurst = 40
+)
+
+// ErrManifestTooLarge is returned for the items whose json manifest exceeds the max size, they are not decoded
+var ErrManifestTooLarge = errors.New("manifest exceeds the max size")
+
 // KubeClient provides interface to various k8s api calls
 type KubeClient struct {
 	ClientSet       kubernetes.Interface
 	DynamicClient   dynamic.Interface
 	DiscoveryClient discovery.DiscoveryInterface
+	MetadataClient  metadata.Interface
+	// RESTClient reads the raw manifests of the items limited by a max size, it is not bound to an api group
+	RESTClient    rest.Interface
+	listLimiter   *rate.Limiter
+	reviewLimiter *rate.Limiter
 }
 
 // NewKubeClient returns a new instance of KubeClient
@@ -34,19 +57,29 @@ func NewKubeClient(config *rest.Config) (*KubeClient, error) {
 	if err != nil {
 		return nil, fmt.Errorf("unable to create dynamic client for kube client, error: %w", err)
 	}
+	metadataClient, err := metadata.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create metadata client for kube client, error: %w", err)
+	}
 	return &KubeClient{
 		ClientSet:       clientSet,
 		DynamicClient:   dynamicClient,
-		DiscoveryClient: clientSet.DiscoveryClient}, nil
+		DiscoveryClient: clientSet.DiscoveryClient,
+		MetadataClient:  metadataClient,
+		RESTClient:      clientSet.Discovery().RESTClient(),
+		reviewLimiter:   rate.NewLimiter(reviewQPS, reviewBurst)}, nil
 
 }
 
-// GetAgentPermissions retrieves allowed permissions for the agent
-func (k *KubeClient) GetAgentPermissions(ctx context.Context) (*authv1.SelfSubjectRulesReview, error) {
+// GetAgentPermissions retrieves allowed permissions for the agent in a namespace, they include the cluster wide permissions
+func (k *KubeClient) GetAgentPermissions(ctx context.Context, namespace string) (*authv1.SelfSubjectRulesReview, error) {
+	if err := k.waitReviewLimit(ctx); err != nil {
+		return nil, err
+	}
 
 	rulesSpec := authv1.SelfSubjectRulesReview{
 		Spec: authv1.SelfSubjectRulesReviewSpec{
-			Namespace: "kube-system",
+			Namespace: namespace,
 		},
 		Status: authv1.SubjectRulesReviewStatus{
 			Incomplete: false,
@@ -55,12 +88,57 @@ func (k *KubeClient) GetAgentPermissions(ctx context.Context) (*authv1.SelfSubje
 
 	subjectRules, err := k.ClientSet.AuthorizationV1().SelfSubjectRulesReviews().Create(ctx, &rulesSpec, meta.CreateOptions{})
 	if err != nil {
-		return nil, fmt.Errorf("unable to get agent permissions, error: %w", err)
+		return nil, fmt.Errorf("unable to get agent permissions in namespace %s, error: %w", namespace, err)
 	}
 
 	return subjectRules, nil
 }
 
+// CanListAllNamespaces checks if the agent is allowed to list the resource across all namespaces, which requires
+// a cluster wide grant such as a cluster role binding, an empty name checks the permission to list all names
+func (k *KubeClient) CanListAllNamespaces(ctx context.Context, group, resource, name string) (bool, error) {
+	if err := k.waitReviewLimit(ctx); err != nil {
+		return false, err
+	}
+	review := authv1.SelfSubjectAccessReview{
+		Spec: authv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authv1.ResourceAttributes{
+				Verb:     "list",
+				Group:    group,
+				Resource: resource,
+				Name:     name,
+			},
+		},
+	}
+	result, err := k.ClientSet.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, &review, meta.CreateOptions{})
+	if err != nil {
+		return false, fmt.Errorf("unable to review agent permissions to list %s: %w", resource, err)
+	}
+	return result.Status.Allowed, nil
+}
+
+func (k *KubeClient) waitReviewLimit(ctx context.Context) error {
+	if k.reviewLimiter == nil {
+		return nil
+	}
+	if err := k.reviewLimiter.Wait(ctx); err != nil {
+		return fmt.Errorf("rate limiter failed to review agent permissions: %w", err)
+	}
+	return nil
+}
+
+// SetListRateLimit limits list requests to qps per second with bursts of at most burst requests, non positive qps disables the limit
+func (k *KubeClient) SetListRateLimit(qps float64, burst int) {
+	if qps <= 0 {
+		k.listLimiter = nil
+		return
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	k.listLimiter = rate.NewLimiter(rate.Limit(qps), burst)
+}
+
 // ListResourceItems returns items from a specific reource group version
 func (k *KubeClient) ListResourceItems(
 	ctx context.Context,
@@ -68,6 +146,10 @@ func (k *KubeClient) ListResourceItems(
 	namespace string,
 	listOptions meta.ListOptions) (*unstructured.UnstructuredList, error) {
 
+	if err := k.waitListLimit(ctx, resource); err != nil {
+		return nil, err
+	}
+
 	list, err := k.DynamicClient.Resource(resource).Namespace(namespace).List(ctx, listOptions)
 	if err != nil {
 		return nil, fmt.Errorf("unable to list resource %s in namespace %s: %w", resource.Resource, namespace, err)
@@ -75,6 +157,210 @@ func (k *KubeClient) ListResourceItems(
 	return list, nil
 }
 
+// ListResourceMetadata returns the metadata of the items of a specific resource group version
+func (k *KubeClient) ListResourceMetadata(
+	ctx context.Context,
+	resource schema.GroupVersionResource,
+	namespace string,
+	listOptions meta.ListOptions) (*meta.PartialObjectMetadataList, error) {
+
+	if err := k.waitListLimit(ctx, resource); err != nil {
+		return nil, err
+	}
+
+	list, err := k.MetadataClient.Resource(resource).Namespace(namespace).List(ctx, listOptions)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list resource %s metadata in namespace %s: %w", resource.Resource, namespace, err)
+	}
+	return list, nil
+}
+
+// ListSizedResourceItems returns the items of a specific resource group version, the items whose json manifest is larger
+// than maxSize bytes are not decoded and are returned with their metadata only, maxSize 0 disables the limit
+func (k *KubeClient) ListSizedResourceItems(
+	ctx context.Context,
+	resource schema.GroupVersionResource,
+	namespace string,
+	listOptions meta.ListOptions,
+	maxSize int) (*unstructured.UnstructuredList, []meta.ObjectMeta, error) {
+
+	if maxSize <= 0 {
+		list, err := k.ListResourceItems(ctx, resource, namespace, listOptions)
+		return list, nil, err
+	}
+	if err := k.waitListLimit(ctx, resource); err != nil {
+		return nil, nil, err
+	}
+
+	body, err := k.RESTClient.Get().
+		AbsPath(resourcePath(resource, namespace, "")).
+		SpecificallyVersionedParams(&listOptions, scheme.ParameterCodec, schema.GroupVersion{Version: "v1"}).
+		Stream(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to list resource %s in namespace %s: %w", resource.Resource, namespace, err)
+	}
+	defer body.Close()
+	list, skipped, err := decodeSizedList(body, maxSize)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to decode resource %s list in namespace %s: %w", resource.Resource, namespace, err)
+	}
+	return list, skipped, nil
+}
+
+// GetListedResourceItem returns an item found by a list request, it is rate limited like the list requests,
+// ErrManifestTooLarge is returned without reading the rest of the manifest when it is larger than maxSize bytes
+func (k *KubeClient) GetListedResourceItem(
+	ctx context.Context,
+	resource schema.GroupVersionResource,
+	namespace string,
+	name string,
+	maxSize int) (*unstructured.Unstructured, error) {
+
+	if err := k.waitListLimit(ctx, resource); err != nil {
+		return nil, err
+	}
+	if maxSize <= 0 {
+		return k.GetResourceItem(ctx, resource, namespace, name)
+	}
+
+	body, err := k.RESTClient.Get().AbsPath(resourcePath(resource, namespace, name)).Stream(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get resource %s %s in namespace %s: %w", resource.Resource, name, namespace, err)
+	}
+	defer body.Close()
+	data, err := io.ReadAll(io.LimitReader(body, int64(maxSize)+1))
+	if err != nil {
+		return nil, fmt.Errorf("unable to get resource %s %s in namespace %s: %w", resource.Resource, name, namespace, err)
+	}
+	if len(data) > maxSize {
+		return nil, ErrManifestTooLarge
+	}
+	item := &unstructured.Unstructured{}
+	if err := item.UnmarshalJSON(data); err != nil {
+		return nil, fmt.Errorf("unable to decode resource %s %s in namespace %s: %w", resource.Resource, name, namespace, err)
+	}
+	return item, nil
+}
+
+// resourcePath returns the api path of the resource items in the namespace, or of the named item
+func resourcePath(resource schema.GroupVersionResource, namespace, name string) string {
+	parts := []string{"/apis", resource.Group, resource.Version}
+	if resource.Group == "" {
+		parts = []string{"/api", resource.Version}
+	}
+	if namespace != "" {
+		parts = append(parts, "namespaces", namespace)
+	}
+	parts = append(parts, resource.Resource)
+	if name != "" {
+		parts = append(parts, name)
+	}
+	return path.Join(parts...)
+}
+
+// decodeSizedList decodes the list keeping the raw items up to maxSize bytes, larger items are decoded to their metadata
+// only, list items are decoded together as they take their kind from the list
+func decodeSizedList(reader io.Reader, maxSize int) (*unstructured.UnstructuredList, []meta.ObjectMeta, error) {
+	decoder := json.NewDecoder(reader)
+	if err := expectDelim(decoder, '{'); err != nil {
+		return nil, nil, err
+	}
+	fields := map[string]json.RawMessage{}
+	items := []json.RawMessage{}
+	var skipped []meta.ObjectMeta
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		key, _ := token.(string)
+		if key != "items" {
+			var value json.RawMessage
+			if err := decoder.Decode(&value); err != nil {
+				return nil, nil, err
+			}
+			fields[key] = value
+			continue
+		}
+		if err := expectDelim(decoder, '['); err != nil {
+			return nil, nil, err
+		}
+		for decoder.More() {
+			var item json.RawMessage
+			if err := decoder.Decode(&item); err != nil {
+				return nil, nil, err
+			}
+			if len(item) <= maxSize {
+				items = append(items, item)
+				continue
+			}
+			var metadata struct {
+				Metadata meta.ObjectMeta `json:"metadata"`
+			}
+			if err := json.Unmarshal(item, &metadata); err != nil {
+				return nil, nil, err
+			}
+			skipped = append(skipped, metadata.Metadata)
+		}
+		if err := expectDelim(decoder, ']'); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := expectDelim(decoder, '}'); err != nil {
+		return nil, nil, err
+	}
+
+	var err error
+	fields["items"], err = json.Marshal(items)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return nil, nil, err
+	}
+	list := &unstructured.UnstructuredList{}
+	if err := list.UnmarshalJSON(data); err != nil {
+		return nil, nil, err
+	}
+	return list, skipped, nil
+}
+
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("unexpected json token %v, expected %v", token, delim)
+	}
+	return nil
+}
+
+func (k *KubeClient) waitListLimit(ctx context.Context, resource schema.GroupVersionResource) error {
+	if k.listLimiter == nil {
+		return nil
+	}
+	if err := k.listLimiter.Wait(ctx); err != nil {
+		return fmt.Errorf("rate limiter failed to list resource %s: %w", resource.Resource, err)
+	}
+	return nil
+}
+
+// GetResourceItem returns an item from a specific resource group version by its name
+func (k *KubeClient) GetResourceItem(
+	ctx context.Context,
+	resource schema.GroupVersionResource,
+	namespace string,
+	name string) (*unstructured.Unstructured, error) {
+
+	item, err := k.DynamicClient.Resource(resource).Namespace(namespace).Get(ctx, name, meta.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get resource %s %s in namespace %s: %w", resource.Resource, name, namespace, err)
+	}
+	return item, nil
+}
+
 // GetAPIResources returns all available api resources in the cluster
 func (k *KubeClient) GetAPIResources(ctx context.Context) ([]*meta.APIResourceList, error) {
 	apiResourcesList, err := k.DiscoveryClient.ServerPreferredResources()
@@ -93,16 +379,37 @@ func (k *KubeClient) GetServerVersion() (string, error) {
 	return version.String(), nil
 }
 
+// GetClusterProvider returns the provider of the cluster nodes such as aws, empty when the cluster has no nodes
 func (k *KubeClient) GetClusterProvider(ctx context.Context) (string, error) {
-	nodes, err := k.ClientSet.CoreV1().Nodes().List(ctx, meta.ListOptions{})
+	nodes, err := k.ClientSet.CoreV1().Nodes().List(ctx, meta.ListOptions{Limit: 1})
 	if err != nil {
 		return "", fmt.Errorf("unable to list cluster nodes: %w", err)
 	}
+	if len(nodes.Items) == 0 {
+		return "", nil
+	}
 
 	node := nodes.Items[0]
 	return strings.Split(node.Spec.ProviderID, ":")[0], nil
 }
 
+// GetNodesCount returns the number of the cluster nodes
+func (k *KubeClient) GetNodesCount(ctx context.Context) (int, error) {
+	count := 0
+	opts := meta.ListOptions{Limit: nodesPageSize}
+	for {
+		nodes, err := k.ClientSet.CoreV1().Nodes().List(ctx, opts)
+		if err != nil {
+			return 0, fmt.Errorf("unable to list cluster nodes: %w", err)
+		}
+		count += len(nodes.Items)
+		if nodes.Continue == "" {
+			return count, nil
+		}
+		opts.Continue = nodes.Continue
+	}
+}
+
 func (k *KubeClient) GetAgentNamespace() string {
 	namespace := "undefined"
 	namespaceBytes, err := ioutil.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace")
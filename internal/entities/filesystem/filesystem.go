@@ -0,0 +1,335 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/weaveworks/policy-agent/pkg/logger"
+	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+const (
+	decoderBufferSize = 4096
+	yamlSeparator     = "---"
+)
+
+// manifestExtensions are the extensions of the loaded manifest files
+var manifestExtensions = map[string]struct{}{
+	".yaml": {},
+	".yml":  {},
+	".json": {},
+}
+
+// Manifest is a kubernetes object loaded from a manifest file
+type Manifest struct {
+	// Path is the path of the file relative to the root directory
+	Path string
+	// Line is the line of the file where the object document starts
+	Line int
+	// GitCommit is the commit the manifest was read from, if any
+	GitCommit string
+	Object    map[string]interface{}
+}
+
+// ManifestsLoader loads the manifests listed by the manifest entities sources
+type ManifestsLoader interface {
+	// Load returns the manifests in a stable order
+	Load() ([]Manifest, error)
+}
+
+// dirLoader loads the manifests of a directory
+type dirLoader string
+
+func (d dirLoader) Load() ([]Manifest, error) {
+	return LoadManifests(string(d))
+}
+
+// GetEntitiesSources returns an entities source for each kind found in the manifests of the directory
+func GetEntitiesSources(root string) ([]domain.EntitiesSource, error) {
+	return NewEntitiesSources(dirLoader(root))
+}
+
+// NewEntitiesSources returns an entities source for each kind found in the manifests of the loader
+func NewEntitiesSources(loader ManifestsLoader) ([]domain.EntitiesSource, error) {
+	manifests, err := loader.Load()
+	if err != nil {
+		return nil, err
+	}
+	kinds := map[string]struct{}{}
+	for i := range manifests {
+		kinds[unstructuredKind(manifests[i].Object)] = struct{}{}
+	}
+	var sources []domain.EntitiesSource
+	for kind := range kinds {
+		sources = append(sources, &ManifestEntitySource{loader: loader, kind: kind})
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		return sources[i].Kind() < sources[j].Kind()
+	})
+	return sources, nil
+}
+
+// ManifestEntitySource lists the entities of a kind from the manifests of a loader
+type ManifestEntitySource struct {
+	loader ManifestsLoader
+	kind   string
+
+	lock sync.Mutex
+	// entities holds the entities of the kind, loaded when listing the first page
+	entities []domain.Entity
+}
+
+// NewManifestEntitySource returns a source of the entities of a kind in the manifests of the root directory
+func NewManifestEntitySource(root, kind string) *ManifestEntitySource {
+	return &ManifestEntitySource{
+		loader: dirLoader(root),
+		kind:   kind,
+	}
+}
+
+// List returns a page of entities ordered by file and position in the file, the key set is the offset of the next page
+func (m *ManifestEntitySource) List(_ context.Context, listOptions *domain.ListOptions) (*domain.EntitiesList, error) {
+	entities, err := m.getEntities(listOptions.KeySet == "")
+	if err != nil {
+		return nil, err
+	}
+
+	offset := 0
+	if listOptions.KeySet != "" {
+		offset, err = strconv.Atoi(listOptions.KeySet)
+		if err != nil || offset < 0 {
+			return nil, fmt.Errorf("invalid key set %s", listOptions.KeySet)
+		}
+	}
+	if offset > len(entities) {
+		offset = len(entities)
+	}
+	end := len(entities)
+	if listOptions.Limit > 0 && offset+listOptions.Limit < end {
+		end = offset + listOptions.Limit
+	}
+
+	list := &domain.EntitiesList{
+		Data: entities[offset:end],
+	}
+	if end < len(entities) {
+		list.HasNext = true
+		list.KeySet = strconv.Itoa(end)
+	}
+	return list, nil
+}
+
+// Kind indicates the kind of the source entities
+func (m *ManifestEntitySource) Kind() string {
+	return m.kind
+}
+
+// getEntities returns the entities of the source kind, loads them again when refresh is set
+func (m *ManifestEntitySource) getEntities(refresh bool) ([]domain.Entity, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if !refresh && m.entities != nil {
+		return m.entities, nil
+	}
+	manifests, err := m.loader.Load()
+	if err != nil {
+		return nil, err
+	}
+	entities := []domain.Entity{}
+	for i := range manifests {
+		if unstructuredKind(manifests[i].Object) != m.kind {
+			continue
+		}
+		entities = append(entities, NewEntityFromManifest(manifests[i]))
+	}
+	m.entities = entities
+	return entities, nil
+}
+
+// NewEntityFromManifest returns the entity of a manifest with its file and commit,
+// entities without uid get an id derived from their identity
+func NewEntityFromManifest(manifest Manifest) domain.Entity {
+	entity := domain.NewEntityFromSpec(manifest.Object)
+	if entity.ID == "" {
+		identity := strings.Join([]string{entity.APIVersion, entity.Kind, entity.Namespace, entity.Name}, "/")
+		entity.ID = uuid.NewV5(uuid.NamespaceURL, identity).String()
+	}
+	entity.File = manifest.Path
+	entity.Line = manifest.Line
+	entity.GitCommit = manifest.GitCommit
+	return entity
+}
+
+// LoadManifests walks the directory and returns the objects of its manifest files in lexical order,
+// multi-document files and list kinds are expanded to their objects
+func LoadManifests(root string) ([]Manifest, error) {
+	var manifests []Manifest
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !IsManifestFile(path) {
+			return nil
+		}
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		fileManifests, err := DecodeManifests(file, relPath)
+		if err != nil {
+			return err
+		}
+		manifests = append(manifests, fileManifests...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load manifests from %s: %w", root, err)
+	}
+	return manifests, nil
+}
+
+// IsManifestFile checks if the file has a yaml or json extension
+func IsManifestFile(path string) bool {
+	_, ok := manifestExtensions[strings.ToLower(filepath.Ext(path))]
+	return ok
+}
+
+// IsHiddenPath checks if any directory of the slash separated path is hidden, these directories are skipped by LoadManifests
+func IsHiddenPath(name string) bool {
+	for _, part := range strings.Split(path.Dir(name), "/") {
+		if strings.HasPrefix(part, ".") && part != "." {
+			return true
+		}
+	}
+	return false
+}
+
+// DecodeManifests returns the objects of the documents of a yaml or json file with the line where each document starts,
+// multi-document files and list kinds are expanded to their objects
+func DecodeManifests(reader io.Reader, path string) ([]Manifest, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	var manifests []Manifest
+	for _, doc := range splitDocuments(data) {
+		objects, err := decodeObjects(bytes.NewReader(doc.data), path)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range objects {
+			manifests = append(manifests, Manifest{Path: path, Line: doc.line, Object: object})
+		}
+	}
+	return manifests, nil
+}
+
+// document is a yaml document of a file
+type document struct {
+	// line is the first line of the document that is neither blank nor a comment
+	line int
+	data []byte
+}
+
+// splitDocuments splits the file on yaml separator lines, documents without content are dropped
+func splitDocuments(data []byte) []document {
+	var documents []document
+	current := document{}
+	for i, line := range bytes.SplitAfter(data, []byte("\n")) {
+		trimmed := bytes.TrimSpace(line)
+		if isSeparator(line) {
+			if current.line != 0 {
+				documents = append(documents, current)
+			}
+			current = document{}
+			continue
+		}
+		if current.line == 0 && len(trimmed) != 0 && trimmed[0] != '#' {
+			current.line = i + 1
+		}
+		current.data = append(current.data, line...)
+	}
+	if current.line != 0 {
+		documents = append(documents, current)
+	}
+	return documents
+}
+
+// isSeparator checks if the line is a yaml separator, separators start at the first column so that indented
+// "---" lines of block scalars are kept in their document
+func isSeparator(line []byte) bool {
+	if !bytes.HasPrefix(line, []byte(yamlSeparator)) {
+		return false
+	}
+	rest := bytes.TrimRight(line[len(yamlSeparator):], "\r\n")
+	return len(rest) == 0 || rest[0] == ' ' || rest[0] == '\t'
+}
+
+func decodeObjects(reader io.Reader, path string) ([]map[string]interface{}, error) {
+	var objects []map[string]interface{}
+	decoder := yaml.NewYAMLOrJSONDecoder(reader, decoderBufferSize)
+	for {
+		var object map[string]interface{}
+		err := decoder.Decode(&object)
+		if errors.Is(err, io.EOF) {
+			return objects, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+		}
+		if len(object) == 0 {
+			continue
+		}
+		if unstructuredKind(object) == "" || unstructuredAPIVersion(object) == "" {
+			logger.Debugw("skipping document without kind", "path", path)
+			continue
+		}
+		item := unstructured.Unstructured{Object: object}
+		if item.IsList() {
+			list, err := item.ToList()
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode list in %s: %w", path, err)
+			}
+			for i := range list.Items {
+				objects = append(objects, list.Items[i].Object)
+			}
+			continue
+		}
+		objects = append(objects, object)
+	}
+}
+
+func unstructuredKind(object map[string]interface{}) string {
+	kind, _ := object["kind"].(string)
+	return kind
+}
+
+func unstructuredAPIVersion(object map[string]interface{}) string {
+	apiVersion, _ := object["apiVersion"].(string)
+	return apiVersion
+}
@@ -0,0 +1,150 @@
+package filesystem
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+)
+
+const deployments = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app-1
+  namespace: prod
+---
+# comment only document
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: app-1
+  namespace: prod
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app-2
+  namespace: prod
+  uid: 0b8a3c4e-5b0a-4f5a-9b7a-1f0c2d3e4f5a
+`
+
+const list = `{
+  "apiVersion": "v1",
+  "kind": "List",
+  "items": [
+    {"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "app-3", "namespace": "dev"}}
+  ]
+}`
+
+func writeFile(t *testing.T, path, content string) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+func TestManifestEntitySource(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "apps", "deployments.yaml"), deployments)
+	writeFile(t, filepath.Join(root, "dev", "list.json"), list)
+	writeFile(t, filepath.Join(root, "README.md"), "# not a manifest")
+	writeFile(t, filepath.Join(root, ".git", "config.yaml"), "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: ignored\n")
+
+	sources, err := GetEntitiesSources(root)
+	require.NoError(t, err)
+	require.Len(t, sources, 2)
+	assert.Equal(t, "Deployment", sources[0].Kind())
+	assert.Equal(t, "Service", sources[1].Kind())
+
+	ctx := context.Background()
+	var names []string
+	var ids []string
+	listOptions := &domain.ListOptions{Limit: 2}
+	for {
+		list, err := sources[0].List(ctx, listOptions)
+		require.NoError(t, err)
+		for _, entity := range list.Data {
+			names = append(names, entity.Name)
+			ids = append(ids, entity.ID)
+		}
+		if !list.HasNext {
+			break
+		}
+		listOptions = &domain.ListOptions{Limit: 2, KeySet: list.KeySet}
+	}
+	assert.Equal(t, []string{"app-1", "app-2", "app-3"}, names)
+	assert.Equal(t, "0b8a3c4e-5b0a-4f5a-9b7a-1f0c2d3e4f5a", ids[1])
+
+	// synthesised ids are stable across loads
+	list, err := NewManifestEntitySource(root, "Deployment").List(ctx, &domain.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, list.Data, 3)
+	assert.NotEmpty(t, list.Data[0].ID)
+	assert.Equal(t, ids[0], list.Data[0].ID)
+	assert.NotEqual(t, ids[0], ids[2])
+	assert.Equal(t, "apps/deployments.yaml", list.Data[0].File)
+	assert.Equal(t, 2, list.Data[0].Line)
+	assert.Equal(t, 16, list.Data[1].Line)
+	assert.Equal(t, "dev/list.json", list.Data[2].File)
+	assert.Equal(t, 1, list.Data[2].Line)
+
+	_, err = sources[0].List(ctx, &domain.ListOptions{KeySet: "invalid"})
+	assert.Error(t, err)
+}
+
+func TestLoadManifests_InvalidFile(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "invalid.yaml"), "kind: [")
+	_, err := LoadManifests(root)
+	assert.Error(t, err)
+}
+
+func TestSplitDocuments(t *testing.T) {
+	cases := []struct {
+		name  string
+		data  string
+		lines []int
+	}{
+		{
+			name:  "separators",
+			data:  "kind: A\n---\nkind: B\n--- # comment\nkind: C\n---\r\nkind: D\n",
+			lines: []int{1, 3, 5, 7},
+		},
+		{
+			name:  "indented separator in block scalar",
+			data:  "kind: ConfigMap\ndata:\n  docs: |\n    a\n    ---\n    b\n",
+			lines: []int{1},
+		},
+		{
+			name:  "separator prefix",
+			data:  "kind: ConfigMap\ndata:\n  key: |-\n---a\n",
+			lines: []int{1},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var lines []int
+			for _, doc := range splitDocuments([]byte(c.data)) {
+				lines = append(lines, doc.line)
+			}
+			assert.Equal(t, c.lines, lines)
+		})
+	}
+}
+
+func TestIsHiddenPath(t *testing.T) {
+	cases := map[string]bool{
+		"deploy.yaml":                false,
+		"./apps/deploy.yaml":         false,
+		"apps/.hidden.yaml":          false,
+		".github/workflows/ci.yaml":  true,
+		"apps/.config/settings.yaml": true,
+	}
+	for name, hidden := range cases {
+		assert.Equal(t, hidden, IsHiddenPath(name), name)
+	}
+}
@@ -0,0 +1,158 @@
+package git
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/weaveworks/policy-agent/internal/entities/filesystem"
+	"github.com/weaveworks/policy-agent/pkg/logger"
+	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+)
+
+const gitBinary = "git"
+
+// GetEntitiesSources returns an entities source for each kind found in the manifests of the repository directory at the ref
+func GetEntitiesSources(repository, ref, dir string) ([]domain.EntitiesSource, error) {
+	return filesystem.NewEntitiesSources(NewManifestsLoader(repository, ref, dir))
+}
+
+// ManifestsLoader loads the manifests of a directory of a local git repository at a ref
+type ManifestsLoader struct {
+	repository string
+	ref        string
+	dir        string
+
+	lock sync.Mutex
+	// commit is the commit the manifests were loaded from
+	commit    string
+	manifests []filesystem.Manifest
+}
+
+// NewManifestsLoader returns a loader of the manifests under dir in the repository checkout at the ref,
+// an empty dir loads the manifests of the whole repository
+func NewManifestsLoader(repository, ref, dir string) *ManifestsLoader {
+	return &ManifestsLoader{
+		repository: repository,
+		ref:        ref,
+		dir:        strings.Trim(dir, "/"),
+	}
+}
+
+// Load resolves the ref and returns the manifests of its commit, the manifests are read again only when the ref moves,
+// implements github.com/weaveworks/policy-agent/internal/entities/filesystem.ManifestsLoader
+func (l *ManifestsLoader) Load() ([]filesystem.Manifest, error) {
+	commit, err := l.resolveRef()
+	if err != nil {
+		return nil, err
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if commit == l.commit {
+		return l.manifests, nil
+	}
+	manifests, err := l.readManifests(commit)
+	if err != nil {
+		return nil, err
+	}
+	logger.Infow("loaded git manifests", "repository", l.repository, "ref", l.ref, "commit", commit, "manifests", len(manifests))
+	l.commit = commit
+	l.manifests = manifests
+	return manifests, nil
+}
+
+// resolveRef returns the commit sha of the ref
+func (l *ManifestsLoader) resolveRef() (string, error) {
+	if strings.HasPrefix(l.ref, "-") {
+		return "", fmt.Errorf("invalid git ref %s", l.ref)
+	}
+	var stdout bytes.Buffer
+	if err := l.run(&stdout, "rev-parse", "--verify", l.ref+"^{commit}"); err != nil {
+		return "", fmt.Errorf("failed to resolve git ref %s: %w", l.ref, err)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// readManifests returns the manifests of the commit files, paths are relative to the repository root,
+// the archive is decoded while git writes it
+func (l *ManifestsLoader) readManifests(commit string) ([]filesystem.Manifest, error) {
+	args := []string{"archive", "--format=tar", commit}
+	if l.dir != "" {
+		args = append(args, "--", l.dir)
+	}
+	var stderr bytes.Buffer
+	cmd := l.command(&stderr, args...)
+	archive, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read git commit %s: %w", commit, err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to read git commit %s: %w", commit, err)
+	}
+	manifests, err := readArchive(archive, commit)
+	if err != nil {
+		// the rest of the archive is not read, git is stopped instead of blocking on its output
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return nil, err
+	}
+	// the padding after the end of the archive is read so that git does not block on it
+	if _, err := io.Copy(io.Discard, archive); err != nil {
+		return nil, fmt.Errorf("failed to read git commit %s: %w", commit, err)
+	}
+	if err := cmd.Wait(); err != nil {
+		return nil, fmt.Errorf("failed to read git commit %s: %w: %s", commit, err, strings.TrimSpace(stderr.String()))
+	}
+	return manifests, nil
+}
+
+// readArchive decodes the manifests of the files of the tar archive of the commit
+func readArchive(archive io.Reader, commit string) ([]filesystem.Manifest, error) {
+	var manifests []filesystem.Manifest
+	reader := tar.NewReader(archive)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return manifests, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read git commit %s: %w", commit, err)
+		}
+		if header.Typeflag != tar.TypeReg || filesystem.IsHiddenPath(header.Name) || !filesystem.IsManifestFile(header.Name) {
+			continue
+		}
+		fileManifests, err := filesystem.DecodeManifests(reader, header.Name)
+		if err != nil {
+			return nil, err
+		}
+		for i := range fileManifests {
+			fileManifests[i].GitCommit = commit
+		}
+		manifests = append(manifests, fileManifests...)
+	}
+}
+
+// run runs the git command in the repository and writes its output to stdout
+func (l *ManifestsLoader) run(stdout io.Writer, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := l.command(&stderr, args...)
+	cmd.Stdout = stdout
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// command returns the git command run in the repository
+func (l *ManifestsLoader) command(stderr io.Writer, args ...string) *exec.Cmd {
+	cmd := exec.Command(gitBinary, args...)
+	cmd.Dir = l.repository
+	cmd.Stderr = stderr
+	return cmd
+}
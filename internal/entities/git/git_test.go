@@ -0,0 +1,114 @@
+package git
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+)
+
+const deployments = `# apps
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app-1
+  namespace: prod
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app-2
+  namespace: prod
+`
+
+func gitCommit(t *testing.T, repository string, files map[string]string) string {
+	for name, content := range files {
+		path := filepath.Join(repository, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	for _, args := range [][]string{
+		{"add", "-A"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "update"},
+	} {
+		out, err := exec.Command(gitBinary, append([]string{"-C", repository}, args...)...).CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	out, err := exec.Command(gitBinary, "-C", repository, "rev-parse", "HEAD").Output()
+	require.NoError(t, err)
+	return strings.TrimSpace(string(out))
+}
+
+func TestManifestsLoader(t *testing.T) {
+	if _, err := exec.LookPath(gitBinary); err != nil {
+		t.Skip("git is not installed")
+	}
+	repository := t.TempDir()
+	out, err := exec.Command(gitBinary, "init", "-q", repository).CombinedOutput()
+	require.NoError(t, err, string(out))
+
+	first := gitCommit(t, repository, map[string]string{
+		"clusters/prod/apps.yaml":       deployments,
+		"clusters/prod/.flux/sync.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: ignored\n",
+		"charts/values.yaml":            "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: outside\n",
+	})
+
+	sources, err := GetEntitiesSources(repository, "HEAD", "clusters/prod")
+	require.NoError(t, err)
+	require.Len(t, sources, 1)
+	assert.Equal(t, "Deployment", sources[0].Kind())
+
+	ctx := context.Background()
+	list, err := sources[0].List(ctx, &domain.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, list.Data, 2)
+	assert.Equal(t, "app-1", list.Data[0].Name)
+	assert.Equal(t, first, list.Data[0].GitCommit)
+	assert.Equal(t, "clusters/prod/apps.yaml", list.Data[0].File)
+	assert.Equal(t, 2, list.Data[0].Line)
+	assert.Equal(t, 8, list.Data[1].Line)
+
+	// moving the ref reloads the manifests of the new commit
+	second := gitCommit(t, repository, map[string]string{
+		"clusters/prod/apps.yaml": strings.SplitN(deployments, "---\n", 2)[1],
+	})
+	list, err = sources[0].List(ctx, &domain.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, list.Data, 1)
+	assert.Equal(t, "app-2", list.Data[0].Name)
+	assert.Equal(t, second, list.Data[0].GitCommit)
+	assert.Equal(t, 1, list.Data[0].Line)
+
+	// a fixed ref keeps reading its commit
+	list, err = deploymentsSource(t, repository, first).List(ctx, &domain.ListOptions{})
+	require.NoError(t, err)
+	assert.Len(t, list.Data, 2)
+
+	_, err = GetEntitiesSources(repository, "missing", "")
+	assert.Error(t, err)
+	_, err = GetEntitiesSources(repository, "--output=x", "")
+	assert.Error(t, err)
+	_, err = GetEntitiesSources(repository, "HEAD", "missing")
+	assert.Error(t, err)
+
+	// an invalid manifest stops reading the archive
+	gitCommit(t, repository, map[string]string{
+		"clusters/prod/invalid.yaml": "kind: [",
+		"clusters/prod/large.yaml":   strings.Repeat("# padding\n", 100000),
+	})
+	_, err = sources[0].List(ctx, &domain.ListOptions{})
+	assert.Error(t, err)
+}
+
+func deploymentsSource(t *testing.T, repository, ref string) domain.EntitiesSource {
+	sources, err := GetEntitiesSources(repository, ref, "clusters")
+	require.NoError(t, err)
+	require.Len(t, sources, 1)
+	return sources[0]
+}
@@ -0,0 +1,96 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/weaveworks/policy-agent/internal/clients/kube"
+	"github.com/weaveworks/policy-agent/pkg/logger"
+	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+// ClusterContextCollector collects the context of a cluster at startup and periodically,
+// implements github.com/weaveworks/policy-agent/pkg/policy-core/domain.ClusterContextSource
+type ClusterContextCollector struct {
+	kubeClient   *kube.KubeClient
+	agentVersion string
+	interval     time.Duration
+
+	lock    sync.RWMutex
+	context *domain.ClusterContext
+}
+
+// NewClusterContextCollector returns a collector of the cluster context, a non positive interval disables the periodic collection
+func NewClusterContextCollector(kubeClient *kube.KubeClient, agentVersion string, interval time.Duration) *ClusterContextCollector {
+	return &ClusterContextCollector{
+		kubeClient:   kubeClient,
+		agentVersion: agentVersion,
+		interval:     interval,
+	}
+}
+
+// GetClusterContext returns the latest collected cluster context or nil if it was not collected yet
+func (c *ClusterContextCollector) GetClusterContext() *domain.ClusterContext {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.context
+}
+
+// Start collects the cluster context periodically until the context is done
+func (c *ClusterContextCollector) Start(ctx context.Context) error {
+	if c.interval <= 0 {
+		return nil
+	}
+	logger.Infow("starting cluster context collector", "interval", c.interval.String())
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("stopping cluster context collector...")
+			return nil
+		case <-ticker.C:
+			if err := c.Collect(ctx); err != nil {
+				logger.Errorw("failed to collect cluster context", "error", err)
+			}
+		}
+	}
+}
+
+// Collect retrieves the cluster version, provider and nodes count, the previous context is kept on failure
+func (c *ClusterContextCollector) Collect(ctx context.Context) error {
+	serverVersion, err := c.kubeClient.GetServerVersion()
+	if err != nil {
+		return err
+	}
+	provider, err := c.kubeClient.GetClusterProvider(ctx)
+	if err != nil {
+		return err
+	}
+	nodeCount, err := c.kubeClient.GetNodesCount(ctx)
+	if err != nil {
+		return err
+	}
+
+	clusterContext := &domain.ClusterContext{
+		Version:      serverVersion,
+		Provider:     provider,
+		NodeCount:    nodeCount,
+		AgentVersion: c.agentVersion,
+	}
+	parsed, err := version.ParseGeneric(serverVersion)
+	if err != nil {
+		return fmt.Errorf("failed to parse cluster version %s: %w", serverVersion, err)
+	}
+	clusterContext.Major = int(parsed.Major())
+	clusterContext.Minor = int(parsed.Minor())
+
+	c.lock.Lock()
+	c.context = clusterContext
+	c.lock.Unlock()
+	logger.Debugw("collected cluster context", "version", serverVersion, "provider", provider, "nodes", nodeCount)
+	return nil
+}
@@ -0,0 +1,82 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/policy-agent/internal/clients/kube"
+	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+	v1 "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/version"
+	discoverfake "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestClusterContextCollector_Collect(t *testing.T) {
+	node := func(name string) runtime.Object {
+		return &v1.Node{
+			ObjectMeta: meta.ObjectMeta{Name: name},
+			Spec:       v1.NodeSpec{ProviderID: "aws:///us-east-1a/" + name},
+		}
+	}
+	tests := []struct {
+		name    string
+		version string
+		nodes   []runtime.Object
+		want    *domain.ClusterContext
+		wantErr bool
+	}{
+		{
+			name:    "cluster with nodes",
+			version: "v1.27.3-eks-a5565ad",
+			nodes:   []runtime.Object{node("node-1"), node("node-2")},
+			want: &domain.ClusterContext{
+				Version:      "v1.27.3-eks-a5565ad",
+				Major:        1,
+				Minor:        27,
+				Provider:     "aws",
+				NodeCount:    2,
+				AgentVersion: "1.1.0",
+			},
+		},
+		{
+			name:    "cluster without nodes",
+			version: "v1.25.0",
+			want: &domain.ClusterContext{
+				Version:      "v1.25.0",
+				Major:        1,
+				Minor:        25,
+				AgentVersion: "1.1.0",
+			},
+		},
+		{
+			name:    "invalid version",
+			version: "unknown",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cli := fake.NewSimpleClientset(tt.nodes...)
+			discoveryClient := &discoverfake.FakeDiscovery{
+				Fake:               &cli.Fake,
+				FakedServerVersion: &version.Info{GitVersion: tt.version},
+			}
+			collector := NewClusterContextCollector(&kube.KubeClient{ClientSet: cli, DiscoveryClient: discoveryClient}, "1.1.0", 0)
+			assert.Nil(t, collector.GetClusterContext())
+
+			err := collector.Collect(context.Background())
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, collector.GetClusterContext())
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, collector.GetClusterContext())
+		})
+	}
+}
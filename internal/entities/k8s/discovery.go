@@ -0,0 +1,233 @@
+package k8s
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/weaveworks/policy-agent/internal/clients/kube"
+	"github.com/weaveworks/policy-agent/pkg/logger"
+	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// crdSettleDelay waits for changed custom resource definitions to be served by the discovery api
+	crdSettleDelay = 5 * time.Second
+	// discoveryRetryInterval retries a failed discovery, such as of a cluster that is not reachable
+	discoveryRetryInterval = time.Minute
+)
+
+var crdGroupVersionResource = schema.GroupVersionResource{
+	Group:    "apiextensions.k8s.io",
+	Version:  "v1",
+	Resource: "customresourcedefinitions",
+}
+
+// SourcesChangeListener is called with the refreshed entities sources and the kinds denied by the agent permissions
+type SourcesChangeListener func(sources []domain.EntitiesSource, deniedKinds []string)
+
+// SourcesRefresher discovers the entities sources periodically and when custom resource definitions change
+type SourcesRefresher struct {
+	kubeClient *kube.KubeClient
+	filter     SourcesFilter
+	interval   time.Duration
+	watchCRDs  bool
+	listener   SourcesChangeListener
+
+	sources     map[string]domain.EntitiesSource
+	deniedKinds []string
+	// rulesCache keeps the reviewed namespace rules of the agent between refreshes
+	rulesCache *namespaceRulesCache
+	// failed is set when the last discovery failed, the discovery is retried and the listener is called once it succeeds
+	failed bool
+}
+
+// NewSourcesRefresher returns a refresher that starts from the already discovered sources and denied kinds
+func NewSourcesRefresher(
+	kubeClient *kube.KubeClient,
+	filter SourcesFilter,
+	interval time.Duration,
+	watchCRDs bool,
+	sources []domain.EntitiesSource,
+	deniedKinds []string,
+	listener SourcesChangeListener,
+) *SourcesRefresher {
+	return &SourcesRefresher{
+		kubeClient:  kubeClient,
+		filter:      filter,
+		interval:    interval,
+		watchCRDs:   watchCRDs,
+		listener:    listener,
+		sources:     sourcesByKey(sources),
+		deniedKinds: deniedKinds,
+		rulesCache:  newNamespaceRulesCache(),
+	}
+}
+
+// SetDiscoveryFailed marks the initial discovery as failed, the discovery is retried until it succeeds
+func (r *SourcesRefresher) SetDiscoveryFailed() {
+	r.failed = true
+}
+
+// Start refreshes the entities sources until the context is done
+func (r *SourcesRefresher) Start(ctx context.Context) error {
+	logger.Infow("starting entities sources refresher", "interval", r.interval.String(), "watch-crds", r.watchCRDs)
+	crdChanged := make(chan struct{}, 1)
+	if r.watchCRDs {
+		r.startCRDsInformer(ctx, crdChanged)
+	}
+
+	var ticker <-chan time.Time
+	if r.interval > 0 {
+		t := time.NewTicker(r.interval)
+		defer t.Stop()
+		ticker = t.C
+	}
+
+	for {
+		var retry <-chan time.Time
+		if r.failed {
+			retry = time.After(discoveryRetryInterval)
+		}
+		select {
+		case <-ctx.Done():
+			logger.Info("stopping entities sources refresher...")
+			return nil
+		case <-ticker:
+		case <-retry:
+		case <-crdChanged:
+			// a single refresh covers changes made shortly after each other
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(crdSettleDelay):
+			}
+			select {
+			case <-crdChanged:
+			default:
+			}
+		}
+		if err := r.Refresh(ctx); err != nil {
+			logger.Errorw("failed to refresh entities sources", "error", err)
+		}
+	}
+}
+
+// Refresh discovers the entities sources and calls the listener if they changed or the previous discovery failed
+func (r *SourcesRefresher) Refresh(ctx context.Context) error {
+	discovered, deniedKinds, err := discoverEntitiesSources(ctx, r.kubeClient, r.filter, r.rulesCache)
+	if err != nil {
+		r.failed = true
+		return err
+	}
+
+	// the sources are reset after a failed discovery even if they did not change
+	changed := r.failed || !equalStrings(deniedKinds, r.deniedKinds)
+	r.failed = false
+	sources := make(map[string]domain.EntitiesSource, len(discovered))
+	for _, source := range discovered {
+		key := sourceKey(source)
+		if current, ok := r.sources[key]; ok {
+			// keep the current source as it may be used by a running audit
+			sources[key] = current
+			continue
+		}
+		logger.Infow("discovered new entities source", "source", key)
+		sources[key] = source
+		changed = true
+	}
+	for key := range r.sources {
+		if _, ok := sources[key]; !ok {
+			logger.Infow("removed entities source", "source", key)
+			changed = true
+		}
+	}
+	if !changed {
+		logger.Debugw("entities sources did not change", "sources", len(sources))
+		return nil
+	}
+
+	r.sources = sources
+	r.deniedKinds = deniedKinds
+	logger.Infow("entities sources changed", "sources", len(sources), "denied-kinds", deniedKinds)
+	r.listener(sortedSources(sources), deniedKinds)
+	return nil
+}
+
+// startCRDsInformer notifies the changes of custom resource definitions after the initial list
+func (r *SourcesRefresher) startCRDsInformer(ctx context.Context, changed chan<- struct{}) {
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(r.kubeClient.DynamicClient, 0)
+	informer := factory.ForResource(crdGroupVersionResource).Informer()
+	notify := func() {
+		if !informer.HasSynced() {
+			return
+		}
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { notify() },
+		UpdateFunc: func(interface{}, interface{}) { notify() },
+		DeleteFunc: func(interface{}) { notify() },
+	})
+	if err != nil {
+		logger.Errorw("failed to watch custom resource definitions", "error", err)
+		return
+	}
+	factory.Start(ctx.Done())
+}
+
+// sourceKey identifies the source by its resource, allowed resource names and allowed namespaces
+func sourceKey(source domain.EntitiesSource) string {
+	k8sSource, ok := source.(*K8SEntitySource)
+	if !ok {
+		return source.Kind()
+	}
+	key := k8sSource.resource.String()
+	if len(k8sSource.resourceNames) > 0 {
+		key += "[" + strings.Join(k8sSource.resourceNames, ",") + "]"
+	}
+	if k8sSource.allowedNamespaces != nil {
+		key += "@" + strings.Join(k8sSource.allowedNamespaces, ",")
+	}
+	return key
+}
+
+func sourcesByKey(sources []domain.EntitiesSource) map[string]domain.EntitiesSource {
+	byKey := make(map[string]domain.EntitiesSource, len(sources))
+	for _, source := range sources {
+		byKey[sourceKey(source)] = source
+	}
+	return byKey
+}
+
+func sortedSources(byKey map[string]domain.EntitiesSource) []domain.EntitiesSource {
+	keys := make([]string, 0, len(byKey))
+	for key := range byKey {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	sources := make([]domain.EntitiesSource, 0, len(keys))
+	for _, key := range keys {
+		sources = append(sources, byKey[key])
+	}
+	return sources
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,95 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/policy-agent/internal/clients/kube"
+	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+	authv1 "k8s.io/api/authorization/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSourcesRefresher_Refresh(t *testing.T) {
+	ctx := context.Background()
+	rules := []authv1.ResourceRule{
+		{Verbs: []string{"list"}, Resources: []string{"policies"}, APIGroups: []string{"pac.weave.works"}},
+		{Verbs: []string{"list"}, Resources: []string{"deployments"}, APIGroups: []string{"apps"}},
+	}
+	var reviewErr error
+	cli := fake.NewSimpleClientset()
+	reactPermissions(cli, func() ([]authv1.ResourceRule, error) { return rules, reviewErr }, nil)
+	discoveryClient := &DiscoveryMock{
+		ApiList: []*meta.APIResourceList{
+			{
+				GroupVersion: "apps/v1",
+				APIResources: []meta.APIResource{
+					{Name: "deployments", Kind: "Deployment", Verbs: []string{"list"}},
+				},
+			},
+		},
+	}
+	kubeClient := &kube.KubeClient{ClientSet: cli, DiscoveryClient: discoveryClient}
+
+	sources, deniedKinds, err := DiscoverEntitiesSources(ctx, kubeClient, SourcesFilter{})
+	require.NoError(t, err)
+
+	var gotSources []domain.EntitiesSource
+	var gotDenied []string
+	calls := 0
+	refresher := NewSourcesRefresher(kubeClient, SourcesFilter{}, 0, false, sources, deniedKinds,
+		func(sources []domain.EntitiesSource, deniedKinds []string) {
+			calls++
+			gotSources, gotDenied = sources, deniedKinds
+		})
+
+	// nothing changed
+	require.NoError(t, refresher.Refresh(ctx))
+	assert.Equal(t, 0, calls)
+
+	// a new custom resource is installed without list permissions
+	discoveryClient.ApiList = append(discoveryClient.ApiList, &meta.APIResourceList{
+		GroupVersion: "example.com/v1",
+		APIResources: []meta.APIResource{
+			{Name: "widgets", Kind: "Widget", Verbs: []string{"list"}},
+		},
+	})
+	require.NoError(t, refresher.Refresh(ctx))
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, []string{"Widget"}, gotDenied)
+	require.Len(t, gotSources, 1)
+	assert.Same(t, sources[0], gotSources[0], "unchanged sources should be kept")
+
+	// permissions are granted
+	rules = append(rules, authv1.ResourceRule{Verbs: []string{"list"}, Resources: []string{"widgets"}, APIGroups: []string{"example.com"}})
+	require.NoError(t, refresher.Refresh(ctx))
+	assert.Equal(t, 2, calls)
+	assert.Empty(t, gotDenied)
+	var kinds []string
+	for _, source := range gotSources {
+		kinds = append(kinds, source.Kind())
+	}
+	assert.Equal(t, []string{"Deployment", "Widget"}, kinds)
+
+	// the custom resource definition is removed
+	discoveryClient.ApiList = discoveryClient.ApiList[:1]
+	require.NoError(t, refresher.Refresh(ctx))
+	assert.Equal(t, 3, calls)
+	require.Len(t, gotSources, 1)
+	assert.Equal(t, "Deployment", gotSources[0].Kind())
+
+	// the cluster can not be reached, the sources are reset once it is reachable again
+	reviewErr = errors.New("connection refused")
+	require.Error(t, refresher.Refresh(ctx))
+	assert.Equal(t, 3, calls)
+	reviewErr = nil
+	require.NoError(t, refresher.Refresh(ctx))
+	assert.Equal(t, 4, calls)
+	require.Len(t, gotSources, 1)
+	require.NoError(t, refresher.Refresh(ctx))
+	assert.Equal(t, 4, calls)
+}
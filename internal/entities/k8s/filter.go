@@ -0,0 +1,181 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/weaveworks/policy-agent/internal/clients/kube"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fieldSelectors "k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// SourcesFilter limits the kinds and entities retrieved by the kubernetes entities sources
+type SourcesFilter struct {
+	// IncludeKinds and ExcludeKinds match a kind such as Deployment, a resource such as deployments,
+	// a group resource such as deployments.apps or a group version resource such as apps/v1/deployments
+	IncludeKinds []string
+	ExcludeKinds []string
+	// IncludeNamespaces and IncludeNamespaceSelector limit namespaced entities to the matching namespaces
+	IncludeNamespaces        []string
+	IncludeNamespaceSelector labels.Selector
+	ExcludeNamespaces        []string
+	ExcludeNamespaceSelector labels.Selector
+	// LabelSelector limits the entities of all kinds to the matching labels
+	LabelSelector labels.Selector
+	// RemoteCluster skips checking the policies permissions of clusters audited from another cluster, which holds the policies
+	RemoteCluster bool
+	// MetadataFilter lists the metadata of the entities first and retrieves only the manifests of the matching entities
+	MetadataFilter MetadataFilter
+	// MaxManifestSize skips the entities whose json manifest is larger than the size in bytes, 0 disables the limit
+	MaxManifestSize int
+}
+
+// MetadataFilter selects the entities to retrieve from their metadata
+type MetadataFilter interface {
+	// ForKind returns a function matching the metadata of the entities of the kind to retrieve, nil matches all entities
+	ForKind(ctx context.Context, kind string) (func(object meta.Object) bool, error)
+}
+
+// namespaceFilter holds the namespaces resolved from the filter at the beginning of a list
+type namespaceFilter struct {
+	// include is nil when all namespaces are included
+	include []string
+	exclude map[string]struct{}
+}
+
+func (n *namespaceFilter) allowed(namespace string) bool {
+	if _, ok := n.exclude[namespace]; ok {
+		return false
+	}
+	if n.include == nil {
+		return true
+	}
+	for i := range n.include {
+		if n.include[i] == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// restrict limits the included namespaces to the allowed namespaces
+func (n *namespaceFilter) restrict(allowed []string) {
+	if n.include == nil {
+		n.include = []string{}
+		for _, namespace := range allowed {
+			if _, ok := n.exclude[namespace]; !ok {
+				n.include = append(n.include, namespace)
+			}
+		}
+		return
+	}
+	allowedSet := make(map[string]struct{}, len(allowed))
+	for _, namespace := range allowed {
+		allowedSet[namespace] = struct{}{}
+	}
+	include := []string{}
+	for _, namespace := range n.include {
+		if _, ok := allowedSet[namespace]; ok {
+			include = append(include, namespace)
+		}
+	}
+	n.include = include
+}
+
+// fieldSelector excludes the excluded namespaces on the server side
+func (n *namespaceFilter) fieldSelector() fieldSelectors.Selector {
+	var selectors []fieldSelectors.Selector
+	for namespace := range n.exclude {
+		selectors = append(selectors, fieldSelectors.OneTermNotEqualSelector(entityMetadataNamespace, namespace))
+	}
+	return fieldSelectors.AndSelectors(selectors...)
+}
+
+// matchResource checks if the resource should be listed
+func (f *SourcesFilter) matchResource(resource schema.GroupVersionResource, kind string) bool {
+	if len(f.IncludeKinds) > 0 && !matchKind(f.IncludeKinds, resource, kind) {
+		return false
+	}
+	return !matchKind(f.ExcludeKinds, resource, kind)
+}
+
+func (f *SourcesFilter) labelSelector() string {
+	if f.LabelSelector == nil || f.LabelSelector.Empty() {
+		return ""
+	}
+	return f.LabelSelector.String()
+}
+
+// resolveNamespaces returns the namespaces allowed by the filter, the ignored namespace is always excluded
+func (f *SourcesFilter) resolveNamespaces(ctx context.Context, kubeClient *kube.KubeClient, ignoredNamespace string) (*namespaceFilter, error) {
+	filter := &namespaceFilter{exclude: map[string]struct{}{}}
+	if ignoredNamespace != "" {
+		filter.exclude[ignoredNamespace] = struct{}{}
+	}
+	for _, namespace := range f.ExcludeNamespaces {
+		filter.exclude[namespace] = struct{}{}
+	}
+	if f.ExcludeNamespaceSelector != nil && !f.ExcludeNamespaceSelector.Empty() {
+		namespaces, err := listNamespaces(ctx, kubeClient, f.ExcludeNamespaceSelector)
+		if err != nil {
+			return nil, err
+		}
+		for _, namespace := range namespaces {
+			filter.exclude[namespace] = struct{}{}
+		}
+	}
+
+	if len(f.IncludeNamespaces) == 0 && (f.IncludeNamespaceSelector == nil || f.IncludeNamespaceSelector.Empty()) {
+		return filter, nil
+	}
+	included := map[string]struct{}{}
+	filter.include = []string{}
+	add := func(namespace string) {
+		if _, ok := included[namespace]; ok {
+			return
+		}
+		if _, ok := filter.exclude[namespace]; ok {
+			return
+		}
+		included[namespace] = struct{}{}
+		filter.include = append(filter.include, namespace)
+	}
+	for _, namespace := range f.IncludeNamespaces {
+		add(namespace)
+	}
+	if f.IncludeNamespaceSelector != nil && !f.IncludeNamespaceSelector.Empty() {
+		namespaces, err := listNamespaces(ctx, kubeClient, f.IncludeNamespaceSelector)
+		if err != nil {
+			return nil, err
+		}
+		for _, namespace := range namespaces {
+			add(namespace)
+		}
+	}
+	return filter, nil
+}
+
+func listNamespaces(ctx context.Context, kubeClient *kube.KubeClient, selector labels.Selector) ([]string, error) {
+	list, err := kubeClient.ClientSet.CoreV1().Namespaces().List(ctx, meta.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list namespaces matching %s: %w", selector.String(), err)
+	}
+	namespaces := make([]string, 0, len(list.Items))
+	for i := range list.Items {
+		namespaces = append(namespaces, list.Items[i].Name)
+	}
+	return namespaces, nil
+}
+
+func matchKind(kinds []string, resource schema.GroupVersionResource, kind string) bool {
+	for _, entry := range kinds {
+		switch entry {
+		case kind, resource.Resource, resource.GroupResource().String(), path.Join(resource.Group, resource.Version, resource.Resource):
+			return true
+		}
+	}
+	return false
+}
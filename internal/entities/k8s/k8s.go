@@ -4,12 +4,17 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 
 	pacv2 "github.com/weaveworks/policy-agent/api/v2beta3"
 	"github.com/weaveworks/policy-agent/internal/clients/kube"
 	"github.com/weaveworks/policy-agent/pkg/logger"
 	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	fieldSelectors "k8s.io/apimachinery/pkg/fields"
@@ -21,6 +26,11 @@ const (
 	listVerb                = "list"
 	entityMetadataName      = "metadata.name"
 	entityMetadataNamespace = "metadata.namespace"
+	// queryKeySetSeparator separates the list query index from the continue token in key sets
+	queryKeySetSeparator = "/"
+	// sparseMatchesRatio retrieves the matching items of a metadata page one by one when less than one item out of
+	// the ratio matches, otherwise the page is listed again with the manifests
+	sparseMatchesRatio = 4
 )
 
 type rulesCache struct {
@@ -50,59 +60,39 @@ func checkAllowed(subject string, rules map[string]struct{}) bool {
 	return checkExplicit || checkAll
 }
 
-func getValidateRules(ctx context.Context, kubeClient *kube.KubeClient) ([]rulesCache, error) {
-	permissions, err := kubeClient.GetAgentPermissions(ctx)
-	if err != nil {
-		return nil, err
-	}
-	var rulesCaches []rulesCache
-	rules := permissions.Status.ResourceRules
-	foundPolicicesRule := false
-	for i := range rules {
-		rule := rules[i]
-		cache := newRulesCache(rule.ResourceNames)
-		allowList := false
-		for k := range rule.Verbs {
-			if rule.Verbs[k] == listVerb || rule.Verbs[k] == allAllowed {
-				allowList = true
-				break
-			}
-		}
-		if allowList {
-			for k := range rule.Resources {
-				cache.resources[rule.Resources[k]] = struct{}{}
-			}
-			for k := range rule.APIGroups {
-				cache.apiGroups[rule.APIGroups[k]] = struct{}{}
-			}
-			rulesCaches = append(rulesCaches, cache)
-			checkPoliciesResource := checkAllowed(pacv2.PolicyResourceName, cache.resources)
-			checkPoliciesGroup := checkAllowed(pacv2.GroupVersion.Group, cache.apiGroups)
-			if checkPoliciesResource && checkPoliciesGroup {
-				foundPolicicesRule = true
-			}
-		}
-	}
-	if !foundPolicicesRule {
-		return nil, errors.New("missing weaveworks policies resource permissions")
-	}
-	return rulesCaches, nil
+// GetEntitiesSources returns entities sources based on allowed list permissions and limited by the filter
+func GetEntitiesSources(ctx context.Context, kubeClient *kube.KubeClient, filter SourcesFilter) ([]domain.EntitiesSource, error) {
+	sources, _, err := DiscoverEntitiesSources(ctx, kubeClient, filter)
+	return sources, err
 }
 
-// GetEntitiesSources returns entities sources based on allowed list permissions
-func GetEntitiesSources(ctx context.Context, kubeClient *kube.KubeClient) ([]domain.EntitiesSource, error) {
-	rulesCaches, err := getValidateRules(ctx, kubeClient)
+// DiscoverEntitiesSources returns entities sources based on allowed list permissions and limited by the filter,
+// along with the listable kinds matching the filter that are denied by the agent permissions
+func DiscoverEntitiesSources(ctx context.Context, kubeClient *kube.KubeClient, filter SourcesFilter) ([]domain.EntitiesSource, []string, error) {
+	return discoverEntitiesSources(ctx, kubeClient, filter, nil)
+}
+
+// discoverEntitiesSources discovers the entities sources reusing the namespace rules of the cache if any
+func discoverEntitiesSources(ctx context.Context, kubeClient *kube.KubeClient, filter SourcesFilter, rulesCache *namespaceRulesCache) ([]domain.EntitiesSource, []string, error) {
+	permissions, err := getAgentPermissions(ctx, kubeClient, rulesCache)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	if !filter.RemoteCluster {
+		if err := permissions.checkPolicies(ctx); err != nil {
+			return nil, nil, err
+		}
 	}
 
 	apiResourceList, err := kubeClient.GetAPIResources(ctx)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	ignoredNamespace := kubeClient.GetAgentNamespace()
 	var sources []domain.EntitiesSource
+	allowedKinds := map[string]struct{}{}
+	deniedKinds := map[string]struct{}{}
 	for i := range apiResourceList {
 		list := apiResourceList[i]
 		groupVersion, err := schema.ParseGroupVersion(list.GroupVersion)
@@ -127,32 +117,57 @@ func GetEntitiesSources(ctx context.Context, kubeClient *kube.KubeClient) ([]dom
 				continue
 			}
 
-			for j := range rulesCaches {
-				cache := rulesCaches[j]
-				groupAllowed := checkAllowed(groupVersion.Group, cache.apiGroups)
-				resourceAllowed := checkAllowed(apiResource.Name, cache.resources)
-				if groupAllowed && resourceAllowed {
-					resource := schema.GroupVersionResource{
-						Group:    groupVersion.Group,
-						Version:  groupVersion.Version,
-						Resource: apiResource.Name}
-					if resource.String() == pacv2.PolicyGroupVersionResource.String() {
-						continue
-					}
+			resource := schema.GroupVersionResource{
+				Group:    groupVersion.Group,
+				Version:  groupVersion.Version,
+				Resource: apiResource.Name}
+			if resource.String() == pacv2.PolicyGroupVersionResource.String() {
+				continue
+			}
+			if !filter.matchResource(resource, apiResource.Kind) {
+				logger.Debugw("skipping filtered resource", "resource", resource.String())
+				continue
+			}
 
-					sources = append(sources, &K8SEntitySource{
-						resource:         resource,
-						kubeClient:       kubeClient,
-						kind:             apiResource.Kind,
-						resourceNames:    cache.resourceNames,
-						ignoredNamespace: ignoredNamespace,
-					})
-					break
+			namespaces, resourceNames, allowed := permissions.allowed(ctx, groupVersion.Group, apiResource.Name, apiResource.Namespaced)
+			var allowedNamespaces []string
+			if !allowed && apiResource.Namespaced {
+				allowedNamespaces = make([]string, 0, len(namespaces))
+				for _, namespace := range namespaces {
+					if namespace != ignoredNamespace {
+						allowedNamespaces = append(allowedNamespaces, namespace)
+					}
 				}
+				allowed = len(allowedNamespaces) > 0
+			}
+			if allowed {
+				sources = append(sources, &K8SEntitySource{
+					resource:          resource,
+					kubeClient:        kubeClient,
+					kind:              apiResource.Kind,
+					resourceNames:     resourceNames,
+					ignoredNamespace:  ignoredNamespace,
+					namespaced:        apiResource.Namespaced,
+					filter:            filter,
+					allowedNamespaces: allowedNamespaces,
+				})
 			}
+			if allowed {
+				allowedKinds[apiResource.Kind] = struct{}{}
+			} else {
+				deniedKinds[apiResource.Kind] = struct{}{}
+			}
+		}
+	}
+
+	var denied []string
+	for kind := range deniedKinds {
+		if _, ok := allowedKinds[kind]; !ok {
+			denied = append(denied, kind)
 		}
 	}
-	return sources, nil
+	sort.Strings(denied)
+	return sources, denied, nil
 }
 
 // K8SEntitySource allows retrieving of items of a specific group version resource
@@ -162,43 +177,50 @@ type K8SEntitySource struct {
 	kind             string
 	resourceNames    []string
 	ignoredNamespace string
+	namespaced       bool
+	filter           SourcesFilter
+	// allowedNamespaces limits the listed namespaces to the ones the agent is allowed to list, nil when allowed cluster wide
+	allowedNamespaces []string
+
+	lock sync.Mutex
+	// namespaces holds the namespaces allowed by the filter, resolved when listing the first page
+	namespaces *namespaceFilter
 }
 
 // List returns list of resources from the entities source
 func (k *K8SEntitySource) List(ctx context.Context, listOptions *domain.ListOptions) (*domain.EntitiesList, error) {
-	metaListOptions := meta.ListOptions{
-		Limit:    int64(listOptions.Limit),
-		Continue: listOptions.KeySet,
-	}
-	var entitiesList *unstructured.UnstructuredList
-	var err error
-	if len(k.resourceNames) != 0 {
-		var items []unstructured.Unstructured
-		for i := range k.resourceNames {
-			selector := fieldSelectors.OneTermEqualSelector(entityMetadataName, k.resourceNames[i])
-			opts := meta.ListOptions{FieldSelector: selector.String()}
-			entitiesList, err = k.kubeClient.ListResourceItems(ctx, k.resource, corev1.NamespaceAll, opts)
-			if err != nil {
-				return nil, fmt.Errorf("error while getting resource with name %s: %w", k.resourceNames[i], err)
-			}
-			items = append(items, entitiesList.Items...)
-		}
-		entitiesList.Items = items
-	} else {
-		entitiesList, err = k.kubeClient.ListResourceItems(ctx, k.resource, corev1.NamespaceAll, metaListOptions)
+	namespaces, err := k.getNamespaces(ctx, listOptions.KeySet == "")
+	if err != nil {
+		return nil, err
+	}
+
+	var match func(object meta.Object) bool
+	if k.filter.MetadataFilter != nil {
+		match, err = k.filter.MetadataFilter.ForKind(ctx, k.kind)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("failed to filter %s entities: %w", k.kind, err)
+		}
+	}
+	var list listFunc = k.listItems
+	if match != nil {
+		list = func(ctx context.Context, query listQuery, listOptions meta.ListOptions) ([]unstructured.Unstructured, string, error) {
+			return k.listMatchingItems(ctx, query, listOptions, match)
 		}
 	}
 
-	keySet := entitiesList.GetContinue()
-	var data []domain.Entity
+	items, keySet, err := k.runQueries(ctx, k.queries(namespaces), listOptions, list)
+	if err != nil {
+		return nil, err
+	}
 
-	for i := range entitiesList.Items {
-		if entitiesList.Items[i].GetNamespace() != k.ignoredNamespace {
-			entity := domain.NewEntityFromSpec(entitiesList.Items[i].Object)
-			data = append(data, entity)
+	var data []domain.Entity
+	for i := range items {
+		namespace := items[i].GetNamespace()
+		if namespace != "" && !namespaces.allowed(namespace) {
+			continue
 		}
+		entity := domain.NewEntityFromSpec(items[i].Object)
+		data = append(data, entity)
 	}
 	return &domain.EntitiesList{
 		HasNext: keySet != "",
@@ -207,6 +229,204 @@ func (k *K8SEntitySource) List(ctx context.Context, listOptions *domain.ListOpti
 	}, nil
 }
 
+// listQuery is a list request of the source in a namespace
+type listQuery struct {
+	namespace     string
+	fieldSelector fieldSelectors.Selector
+	// resourceName is set when the query lists a single allowed resource name
+	resourceName string
+}
+
+// listFunc lists a page of the query items and returns the continue token of the next page
+type listFunc func(ctx context.Context, query listQuery, listOptions meta.ListOptions) ([]unstructured.Unstructured, string, error)
+
+// queries returns the list requests of the source, included namespaces and allowed resource names are listed one by one
+func (k *K8SEntitySource) queries(namespaces *namespaceFilter) []listQuery {
+	fieldSelector := fieldSelectors.Everything()
+	listNamespaces := []string{corev1.NamespaceAll}
+	if k.namespaced {
+		fieldSelector = namespaces.fieldSelector()
+		if namespaces.include != nil {
+			listNamespaces = namespaces.include
+		}
+	}
+
+	var queries []listQuery
+	for _, namespace := range listNamespaces {
+		if len(k.resourceNames) == 0 {
+			queries = append(queries, listQuery{namespace: namespace, fieldSelector: fieldSelector})
+			continue
+		}
+		for _, name := range k.resourceNames {
+			queries = append(queries, listQuery{
+				namespace: namespace,
+				fieldSelector: fieldSelectors.AndSelectors(
+					fieldSelectors.OneTermEqualSelector(entityMetadataName, name),
+					fieldSelector,
+				),
+				resourceName: name,
+			})
+		}
+	}
+	return queries
+}
+
+// runQueries lists the queries in order until the limit is reached, the key set holds the index of the
+// listed query and the continue token of its list
+func (k *K8SEntitySource) runQueries(
+	ctx context.Context,
+	queries []listQuery,
+	listOptions *domain.ListOptions,
+	list listFunc) ([]unstructured.Unstructured, string, error) {
+
+	index := 0
+	continueToken := ""
+	if listOptions.KeySet != "" {
+		indexStr, token, _ := strings.Cut(listOptions.KeySet, queryKeySetSeparator)
+		var err error
+		index, err = strconv.Atoi(indexStr)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid key set %s: %w", listOptions.KeySet, err)
+		}
+		continueToken = token
+	}
+
+	var items []unstructured.Unstructured
+	for index < len(queries) {
+		query := queries[index]
+		metaListOptions := meta.ListOptions{
+			Continue:      continueToken,
+			LabelSelector: k.filter.labelSelector(),
+			FieldSelector: query.fieldSelector.String(),
+		}
+		if listOptions.Limit > 0 {
+			metaListOptions.Limit = int64(listOptions.Limit - len(items))
+		}
+		queryItems, token, err := list(ctx, query, metaListOptions)
+		if err != nil && query.resourceName != "" && query.namespace != corev1.NamespaceAll && apierrors.IsForbidden(err) {
+			// resource names are merged across the allowed namespaces, a name may not be allowed in every one of them
+			err, token = nil, ""
+		}
+		if err != nil {
+			if query.resourceName != "" {
+				return nil, "", fmt.Errorf("error while getting resource with name %s: %w", query.resourceName, err)
+			}
+			return nil, "", err
+		}
+		items = append(items, queryItems...)
+		continueToken = token
+		if continueToken == "" {
+			index++
+		}
+		if listOptions.Limit > 0 && len(items) >= listOptions.Limit {
+			break
+		}
+	}
+	if index >= len(queries) {
+		return items, "", nil
+	}
+	return items, fmt.Sprintf("%d%s%s", index, queryKeySetSeparator, continueToken), nil
+}
+
+// listItems lists a page of the query items with their manifests, items exceeding the max manifest size are skipped
+func (k *K8SEntitySource) listItems(
+	ctx context.Context,
+	query listQuery,
+	listOptions meta.ListOptions) ([]unstructured.Unstructured, string, error) {
+
+	list, skipped, err := k.kubeClient.ListSizedResourceItems(ctx, k.resource, query.namespace, listOptions, k.filter.MaxManifestSize)
+	if err != nil {
+		return nil, "", err
+	}
+	for i := range skipped {
+		k.logMaxManifestSize(skipped[i].Namespace, skipped[i].Name)
+	}
+	return list.Items, list.GetContinue(), nil
+}
+
+// listMatchingItems lists a page of the query items metadata and returns the manifests of the matching items only,
+// the page is listed again with the manifests unless the matching items are few enough to be retrieved one by one
+func (k *K8SEntitySource) listMatchingItems(
+	ctx context.Context,
+	query listQuery,
+	listOptions meta.ListOptions,
+	match func(object meta.Object) bool) ([]unstructured.Unstructured, string, error) {
+
+	list, err := k.kubeClient.ListResourceMetadata(ctx, k.resource, query.namespace, listOptions)
+	if err != nil {
+		return nil, "", err
+	}
+	var matching []meta.Object
+	for i := range list.Items {
+		if match(&list.Items[i]) {
+			matching = append(matching, &list.Items[i])
+		}
+	}
+	if len(matching) == 0 {
+		return nil, list.GetContinue(), nil
+	}
+
+	if len(matching)*sparseMatchesRatio >= len(list.Items) {
+		// the same page is listed, its items are matched again as they may have changed since the metadata list
+		items, continueToken, err := k.listItems(ctx, query, listOptions)
+		if err != nil {
+			return nil, "", err
+		}
+		var matchingItems []unstructured.Unstructured
+		for i := range items {
+			if match(&items[i]) {
+				matchingItems = append(matchingItems, items[i])
+			}
+		}
+		return matchingItems, continueToken, nil
+	}
+
+	var items []unstructured.Unstructured
+	for _, object := range matching {
+		item, err := k.kubeClient.GetListedResourceItem(ctx, k.resource, object.GetNamespace(), object.GetName(), k.filter.MaxManifestSize)
+		if err != nil {
+			if errors.Is(err, kube.ErrManifestTooLarge) {
+				k.logMaxManifestSize(object.GetNamespace(), object.GetName())
+				continue
+			}
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, "", err
+		}
+		items = append(items, *item)
+	}
+	return items, list.GetContinue(), nil
+}
+
+// logMaxManifestSize logs an entity skipped for exceeding the max manifest size
+func (k *K8SEntitySource) logMaxManifestSize(namespace, name string) {
+	logger.Warnw(
+		"skipping entity exceeding the max manifest size",
+		"kind", k.kind,
+		"name", name,
+		"namespace", namespace,
+		"max-size", k.filter.MaxManifestSize,
+	)
+}
+
+// getNamespaces returns the namespaces allowed by the filter, resolves them again when refresh is set
+func (k *K8SEntitySource) getNamespaces(ctx context.Context, refresh bool) (*namespaceFilter, error) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	if refresh || k.namespaces == nil {
+		namespaces, err := k.filter.resolveNamespaces(ctx, k.kubeClient, k.ignoredNamespace)
+		if err != nil {
+			return nil, err
+		}
+		if k.allowedNamespaces != nil {
+			namespaces.restrict(k.allowedNamespaces)
+		}
+		k.namespaces = namespaces
+	}
+	return k.namespaces, nil
+}
+
 // Kind indicates the k8s kind of the source
 func (k *K8SEntitySource) Kind() string {
 	return k.kind
@@ -2,22 +2,31 @@ package k8s
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 	"github.com/weaveworks/policy-agent/internal/clients/kube"
 	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
 	authv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/discovery"
 	discoverfake "k8s.io/client-go/discovery/fake"
 	"k8s.io/client-go/dynamic"
 	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
+	metadatafake "k8s.io/client-go/metadata/fake"
+	"k8s.io/client-go/rest"
 	k8stesting "k8s.io/client-go/testing"
 )
 
@@ -47,10 +56,11 @@ func TestGetEntitiesSources(t *testing.T) {
 		discoveryClient discovery.DiscoveryInterface
 	}
 	tests := []struct {
-		name    string
-		args    args
-		want    []domain.EntitiesSource
-		wantErr bool
+		name       string
+		args       args
+		want       []domain.EntitiesSource
+		wantDenied []string
+		wantErr    bool
 	}{
 		{
 			name: "standard test",
@@ -440,6 +450,7 @@ func TestGetEntitiesSources(t *testing.T) {
 					kind: "Deployment",
 				},
 			},
+			wantDenied: []string{"Pod"},
 		},
 		{
 			name: "* groups permissions",
@@ -588,6 +599,7 @@ func TestGetEntitiesSources(t *testing.T) {
 					kind: "ReplicaSet",
 				},
 			},
+			wantDenied: []string{"Pod"},
 		},
 		{
 			name: "permissions with resource names",
@@ -682,8 +694,7 @@ func TestGetEntitiesSources(t *testing.T) {
 						Version:  "v1",
 						Resource: "deployments",
 					},
-					kind:          "Deployment",
-					resourceNames: []string{},
+					kind: "Deployment",
 				},
 			},
 		},
@@ -693,18 +704,19 @@ func TestGetEntitiesSources(t *testing.T) {
 			assert := require.New(t)
 			ctx := context.Background()
 			cli := fake.NewSimpleClientset()
-			cli.PrependReactor("create", "selfsubjectrulesreviews", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+			reactPermissions(cli, func() ([]authv1.ResourceRule, error) {
 				if test.args.permissions.err != nil {
-					return true, nil, test.args.permissions.err
+					return nil, test.args.permissions.err
 				}
-				return true, test.args.permissions.review, nil
-			})
+				return test.args.permissions.review.Status.ResourceRules, nil
+			}, nil)
 			kubeClient := &kube.KubeClient{
 				ClientSet:       cli,
 				DynamicClient:   test.args.dynamicClient,
 				DiscoveryClient: test.args.discoveryClient}
-			gotSources, err := GetEntitiesSources(ctx, kubeClient)
+			gotSources, gotDenied, err := DiscoverEntitiesSources(ctx, kubeClient, SourcesFilter{})
 			assert.Equal(test.wantErr, err != nil, "unexpected error result")
+			assert.Equal(test.wantDenied, gotDenied, "unexpected denied kinds")
 			assert.Equal(len(test.want), len(gotSources), "unexpected entities sources number")
 
 			for i := range test.want {
@@ -964,3 +976,260 @@ func TestK8SEntitySource_Kind(t *testing.T) {
 		})
 	}
 }
+
+func TestSourcesFilter_matchResource(t *testing.T) {
+	deployments := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	events := schema.GroupVersionResource{Version: "v1", Resource: "events"}
+	leases := schema.GroupVersionResource{Group: "coordination.k8s.io", Version: "v1", Resource: "leases"}
+
+	filter := SourcesFilter{ExcludeKinds: []string{"Event", "leases.coordination.k8s.io"}}
+	require.True(t, filter.matchResource(deployments, "Deployment"))
+	require.False(t, filter.matchResource(events, "Event"))
+	require.False(t, filter.matchResource(leases, "Lease"))
+
+	filter = SourcesFilter{IncludeKinds: []string{"apps/v1/deployments", "v1/events"}, ExcludeKinds: []string{"events"}}
+	require.True(t, filter.matchResource(deployments, "Deployment"))
+	require.False(t, filter.matchResource(events, "Event"))
+	require.False(t, filter.matchResource(leases, "Lease"))
+}
+
+func TestK8SEntitySource_ListFiltered(t *testing.T) {
+	assert := require.New(t)
+	newNamespace := func(name string, labels map[string]string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: meta.ObjectMeta{Name: name, Labels: labels}}
+	}
+	cli := fake.NewSimpleClientset(
+		newNamespace("team-a", map[string]string{"team": "a"}),
+		newNamespace("team-a-sandbox", map[string]string{"team": "a", "sandbox": "true"}),
+		newNamespace("team-b", map[string]string{"team": "b"}),
+	)
+	scheme := runtime.NewScheme()
+	scheme.AddKnownTypeWithName(schema.GroupVersionKind{Kind: "DeploymentList", Version: "v1", Group: "apps"}, &unstructured.UnstructuredList{})
+	dynamicCli := dynamicfake.NewSimpleDynamicClient(scheme)
+
+	var requests []string
+	dynamicCli.PrependReactor("list", "deployments", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+		listAction := action.(k8stesting.ListActionImpl)
+		restrictions := listAction.GetListRestrictions()
+		requests = append(requests, fmt.Sprintf("%s?%s&%s", listAction.GetNamespace(), restrictions.Labels, restrictions.Fields))
+		list := &unstructured.UnstructuredList{}
+		list.SetContinue("")
+		item := unstructured.Unstructured{}
+		item.SetAPIVersion("apps/v1")
+		item.SetKind("Deployment")
+		item.SetName("app")
+		item.SetNamespace(listAction.GetNamespace())
+		item.SetLabels(map[string]string{"app": "web"})
+		list.Items = append(list.Items, item)
+		return true, list, nil
+	})
+
+	includeSelector, err := labels.Parse("team=a")
+	assert.NoError(err)
+	excludeSelector, err := labels.Parse("sandbox=true")
+	assert.NoError(err)
+	labelSelector, err := labels.Parse("app=web")
+	assert.NoError(err)
+
+	k := &K8SEntitySource{
+		resource:   schema.GroupVersionResource{Resource: "deployments", Version: "v1", Group: "apps"},
+		kubeClient: &kube.KubeClient{ClientSet: cli, DynamicClient: dynamicCli, DiscoveryClient: &DiscoveryMock{}},
+		kind:       "Deployment",
+		namespaced: true,
+		filter: SourcesFilter{
+			IncludeNamespaces:        []string{"team-b"},
+			IncludeNamespaceSelector: includeSelector,
+			ExcludeNamespaceSelector: excludeSelector,
+			LabelSelector:            labelSelector,
+		},
+	}
+
+	var namespaces []string
+	listOptions := &domain.ListOptions{Limit: 10}
+	for {
+		list, err := k.List(context.Background(), listOptions)
+		assert.NoError(err)
+		for _, entity := range list.Data {
+			namespaces = append(namespaces, entity.Namespace)
+		}
+		if !list.HasNext {
+			break
+		}
+		listOptions.KeySet = list.KeySet
+	}
+	assert.Equal([]string{"team-b", "team-a"}, namespaces)
+	assert.Equal([]string{
+		"team-b?app=web&metadata.namespace!=team-a-sandbox",
+		"team-a?app=web&metadata.namespace!=team-a-sandbox",
+	}, requests)
+}
+
+func newDeployment(namespace, name string, labels map[string]string) *unstructured.Unstructured {
+	item := &unstructured.Unstructured{}
+	item.SetAPIVersion("apps/v1")
+	item.SetKind("Deployment")
+	item.SetNamespace(namespace)
+	item.SetName(name)
+	item.SetLabels(labels)
+	return item
+}
+
+func listAllEntities(t *testing.T, source domain.EntitiesSource, limit int) ([]string, int) {
+	var names []string
+	pages := 0
+	listOptions := &domain.ListOptions{Limit: limit}
+	for {
+		list, err := source.List(context.Background(), listOptions)
+		require.NoError(t, err)
+		pages++
+		for _, entity := range list.Data {
+			names = append(names, entity.Namespace+"/"+entity.Name)
+		}
+		if !list.HasNext {
+			return names, pages
+		}
+		listOptions = &domain.ListOptions{Limit: limit, KeySet: list.KeySet}
+	}
+}
+
+func TestK8SEntitySource_ListResourceNamesPaged(t *testing.T) {
+	assert := require.New(t)
+	scheme := runtime.NewScheme()
+	scheme.AddKnownTypeWithName(schema.GroupVersionKind{Kind: "DeploymentList", Version: "v1", Group: "apps"}, &unstructured.UnstructuredList{})
+	dynamicCli := dynamicfake.NewSimpleDynamicClient(scheme)
+
+	var requests []string
+	dynamicCli.PrependReactor("list", "deployments", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+		listAction := action.(k8stesting.ListActionImpl)
+		fields := listAction.GetListRestrictions().Fields
+		requests = append(requests, listAction.GetNamespace()+"?"+fields.String())
+		name, _ := fields.RequiresExactMatch(entityMetadataName)
+		list := &unstructured.UnstructuredList{}
+		list.Items = append(list.Items, *newDeployment(listAction.GetNamespace(), name, nil))
+		return true, list, nil
+	})
+
+	k := &K8SEntitySource{
+		resource:          schema.GroupVersionResource{Resource: "deployments", Version: "v1", Group: "apps"},
+		kubeClient:        &kube.KubeClient{ClientSet: fake.NewSimpleClientset(), DynamicClient: dynamicCli, DiscoveryClient: &DiscoveryMock{}},
+		kind:              "Deployment",
+		namespaced:        true,
+		resourceNames:     []string{"app-1", "app-2", "app-3"},
+		allowedNamespaces: []string{"team-a"},
+	}
+
+	names, pages := listAllEntities(t, k, 2)
+	assert.Equal([]string{"team-a/app-1", "team-a/app-2", "team-a/app-3"}, names)
+	assert.Equal(2, pages)
+	assert.Equal([]string{
+		"team-a?metadata.name=app-1",
+		"team-a?metadata.name=app-2",
+		"team-a?metadata.name=app-3",
+	}, requests)
+}
+
+type metadataFilterFunc func(object meta.Object) bool
+
+func (f metadataFilterFunc) ForKind(context.Context, string) (func(object meta.Object) bool, error) {
+	return f, nil
+}
+
+func TestK8SEntitySource_ListMetadataFiltered(t *testing.T) {
+	newDeployments := func(workers int) []*unstructured.Unstructured {
+		deployments := []*unstructured.Unstructured{
+			newDeployment("default", "web", map[string]string{"app": "web"}),
+			newDeployment("default", "api", map[string]string{"app": "api"}),
+		}
+		// the api deployment manifest exceeds the max manifest size
+		unstructured.SetNestedField(deployments[1].Object, strings.Repeat("x", 1024), "spec", "template", "metadata", "annotations", "big")
+		for i := 0; i < workers; i++ {
+			deployments = append(deployments, newDeployment("default", fmt.Sprintf("worker-%d", i), map[string]string{"app": "worker"}))
+		}
+		return deployments
+	}
+
+	cases := []struct {
+		name        string
+		deployments []*unstructured.Unstructured
+		requests    []string
+	}{
+		{
+			name:        "dense matches list the page again",
+			deployments: newDeployments(2),
+			requests:    []string{"/apis/apps/v1/deployments?limit=10"},
+		},
+		{
+			name:        "sparse matches are retrieved one by one",
+			deployments: newDeployments(8),
+			requests: []string{
+				"/apis/apps/v1/namespaces/default/deployments/api",
+				"/apis/apps/v1/namespaces/default/deployments/web",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert := require.New(t)
+			var requests []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests = append(requests, r.URL.String())
+				var body interface{}
+				if name := strings.TrimPrefix(r.URL.Path, "/apis/apps/v1/namespaces/default/deployments/"); name != r.URL.Path {
+					for _, deployment := range c.deployments {
+						if deployment.GetName() == name {
+							body = deployment.Object
+						}
+					}
+				} else {
+					// the api server omits the kind of the list items
+					var items []interface{}
+					for _, deployment := range c.deployments {
+						item := deployment.DeepCopy()
+						item.SetAPIVersion("")
+						item.SetKind("")
+						items = append(items, item.Object)
+					}
+					body = map[string]interface{}{"apiVersion": "apps/v1", "kind": "DeploymentList", "metadata": map[string]interface{}{}, "items": items}
+				}
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(body)
+			}))
+			defer server.Close()
+			clientSet, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+			assert.NoError(err)
+
+			metadataScheme := runtime.NewScheme()
+			meta.AddMetaToScheme(metadataScheme)
+			var metadataObjects []runtime.Object
+			for _, deployment := range c.deployments {
+				metadataObjects = append(metadataObjects, &meta.PartialObjectMetadata{
+					TypeMeta:   meta.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+					ObjectMeta: meta.ObjectMeta{Namespace: deployment.GetNamespace(), Name: deployment.GetName(), Labels: deployment.GetLabels()},
+				})
+			}
+
+			k := &K8SEntitySource{
+				resource: schema.GroupVersionResource{Resource: "deployments", Version: "v1", Group: "apps"},
+				kubeClient: &kube.KubeClient{
+					ClientSet:       fake.NewSimpleClientset(),
+					DiscoveryClient: &DiscoveryMock{},
+					MetadataClient:  metadatafake.NewSimpleMetadataClient(metadataScheme, metadataObjects...),
+					RESTClient:      clientSet.Discovery().RESTClient(),
+				},
+				kind:       "Deployment",
+				namespaced: true,
+				filter: SourcesFilter{
+					MetadataFilter: metadataFilterFunc(func(object meta.Object) bool {
+						return object.GetLabels()["app"] != "worker"
+					}),
+					MaxManifestSize: 512,
+				},
+			}
+
+			names, _ := listAllEntities(t, k, 10)
+			assert.Equal([]string{"default/web"}, names)
+			assert.Equal(c.requests, requests)
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package k8s
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/weaveworks/policy-agent/internal/clients/kube"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const namespaceCacheTTL = time.Minute
+
+var namespaceGroupVersionResource = schema.GroupVersionResource{
+	Version:  "v1",
+	Resource: "namespaces",
+}
+
+type cachedNamespace struct {
+	namespace map[string]interface{}
+	expiresAt time.Time
+}
+
+// NamespaceResolver gets namespaces from the cluster and caches them for a short period,
+// implements github.com/weaveworks/policy-agent/pkg/policy-core/domain.NamespaceResolver
+type NamespaceResolver struct {
+	kubeClient *kube.KubeClient
+
+	lock         sync.Mutex
+	cache        map[string]cachedNamespace
+	nextEviction time.Time
+}
+
+// NewNamespaceResolver returns a namespace resolver that retrieves namespaces from the cluster
+func NewNamespaceResolver(kubeClient *kube.KubeClient) *NamespaceResolver {
+	return &NamespaceResolver{
+		kubeClient: kubeClient,
+		cache:      make(map[string]cachedNamespace),
+	}
+}
+
+// GetNamespace returns the namespace object or nil if the namespace does not exist
+func (n *NamespaceResolver) GetNamespace(ctx context.Context, name string) (map[string]interface{}, error) {
+	now := time.Now()
+	n.lock.Lock()
+	n.evictExpired(now)
+	cached, ok := n.cache[name]
+	n.lock.Unlock()
+	if ok && now.Before(cached.expiresAt) {
+		return cached.namespace, nil
+	}
+
+	var namespace map[string]interface{}
+	item, err := n.kubeClient.GetResourceItem(ctx, namespaceGroupVersionResource, "", name)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+	if err == nil {
+		namespace = item.Object
+	}
+
+	n.lock.Lock()
+	n.cache[name] = cachedNamespace{namespace: namespace, expiresAt: time.Now().Add(namespaceCacheTTL)}
+	n.lock.Unlock()
+	return namespace, nil
+}
+
+// evictExpired drops the expired namespaces once every ttl, must be called with the lock held
+func (n *NamespaceResolver) evictExpired(now time.Time) {
+	if now.Before(n.nextEviction) {
+		return
+	}
+	for name, cached := range n.cache {
+		if !now.Before(cached.expiresAt) {
+			delete(n.cache, name)
+		}
+	}
+	n.nextEviction = now.Add(namespaceCacheTTL)
+}
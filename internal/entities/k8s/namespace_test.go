@@ -0,0 +1,27 @@
+package k8s
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNamespaceResolver_EvictExpired(t *testing.T) {
+	resolver := NewNamespaceResolver(nil)
+	now := time.Now()
+	resolver.cache["expired"] = cachedNamespace{expiresAt: now.Add(-time.Second)}
+	resolver.cache["valid"] = cachedNamespace{expiresAt: now.Add(time.Second)}
+
+	resolver.evictExpired(now)
+	require.NotContains(t, resolver.cache, "expired")
+	require.Contains(t, resolver.cache, "valid")
+
+	// eviction runs once every ttl
+	resolver.cache["expired"] = cachedNamespace{expiresAt: now.Add(-time.Second)}
+	resolver.evictExpired(now.Add(time.Second))
+	require.Contains(t, resolver.cache, "expired")
+	resolver.evictExpired(now.Add(namespaceCacheTTL))
+	require.NotContains(t, resolver.cache, "expired")
+	require.NotContains(t, resolver.cache, "valid")
+}
@@ -0,0 +1,201 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/weaveworks/policy-agent/pkg/logger"
+	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	maxOwnerDepth = 10
+	ownerCacheTTL = 10 * time.Minute
+	// ownerCacheSyncTimeout bounds the wait for the informer of an owner kind to sync
+	ownerCacheSyncTimeout = 5 * time.Second
+	// ownerCacheRetryInterval is the period the owners of a kind are read from the api server after a cache failure
+	// before the cache is tried again
+	ownerCacheRetryInterval = time.Minute
+)
+
+type cachedOwner struct {
+	owner     *domain.EntityOwner
+	expiresAt time.Time
+}
+
+// OwnerResolver finds the top level owner of entities by following their controller owner references,
+// implements github.com/weaveworks/policy-agent/pkg/policy-core/domain.OwnerResolver
+type OwnerResolver struct {
+	// reader reads the owners metadata from the informers cache
+	reader client.Reader
+	// apiReader reads the owners of the kinds whose informers failed to sync from the api server
+	apiReader client.Reader
+	mapper    meta.RESTMapper
+
+	lock sync.Mutex
+	// cache holds the top level owner of each direct owner
+	cache        map[types.UID]cachedOwner
+	nextEviction time.Time
+	// uncachedKinds are the owner kinds read from the api server until the time the cache is tried again
+	uncachedKinds map[schema.GroupVersionKind]time.Time
+}
+
+// NewOwnerResolver returns an owner resolver that reads the owners metadata from the informers cache of the reader,
+// owners of kinds whose informers fail to sync, e.g. due to missing watch permissions, are read by the api reader
+func NewOwnerResolver(reader, apiReader client.Reader, mapper meta.RESTMapper) *OwnerResolver {
+	return &OwnerResolver{
+		reader:        reader,
+		apiReader:     apiReader,
+		mapper:        mapper,
+		cache:         make(map[types.UID]cachedOwner),
+		uncachedKinds: make(map[schema.GroupVersionKind]time.Time),
+	}
+}
+
+// Resolve returns the top level owner of the entity or nil if the entity has no owner
+func (o *OwnerResolver) Resolve(ctx context.Context, entity domain.Entity) (*domain.EntityOwner, error) {
+	manifest := unstructured.Unstructured{Object: entity.Manifest}
+	ownerRef := controllerRef(manifest.GetOwnerReferences())
+	if ownerRef == nil {
+		return nil, nil
+	}
+
+	now := time.Now()
+	o.lock.Lock()
+	o.evictExpired(now)
+	cached, ok := o.cache[ownerRef.UID]
+	o.lock.Unlock()
+	if ok && now.Before(cached.expiresAt) {
+		return cached.owner, nil
+	}
+
+	owner, complete, err := o.resolve(ctx, entity.Namespace, ownerRef)
+	if err != nil {
+		return owner, err
+	}
+	// an owner missing from the cache may not be synced yet, the partial chain is resolved again on the next lookup
+	if !complete {
+		return owner, nil
+	}
+
+	o.lock.Lock()
+	o.cache[ownerRef.UID] = cachedOwner{owner: owner, expiresAt: time.Now().Add(ownerCacheTTL)}
+	o.lock.Unlock()
+	return owner, nil
+}
+
+// evictExpired drops the expired owners once every ttl, must be called with the lock held
+func (o *OwnerResolver) evictExpired(now time.Time) {
+	if now.Before(o.nextEviction) {
+		return
+	}
+	for uid, cached := range o.cache {
+		if !now.Before(cached.expiresAt) {
+			delete(o.cache, uid)
+		}
+	}
+	o.nextEviction = now.Add(ownerCacheTTL)
+}
+
+// resolve follows the owner references up to the top level owner and reports whether the chain is complete,
+// it is not when an owner was not found
+func (o *OwnerResolver) resolve(ctx context.Context, namespace string, ownerRef *metav1.OwnerReference) (*domain.EntityOwner, bool, error) {
+	var owner *domain.EntityOwner
+	var controllers []string
+	for depth := 0; ownerRef != nil && depth < maxOwnerDepth; depth++ {
+		gv, err := schema.ParseGroupVersion(ownerRef.APIVersion)
+		if err != nil {
+			return owner, false, fmt.Errorf("failed to parse owner api version %s: %w", ownerRef.APIVersion, err)
+		}
+		gvk := gv.WithKind(ownerRef.Kind)
+		mapping, err := o.mapper.RESTMapping(gvk.GroupKind(), gv.Version)
+		if err != nil {
+			return owner, false, fmt.Errorf("failed to get resource of owner kind %s: %w", ownerRef.Kind, err)
+		}
+		ownerNamespace := namespace
+		if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+			ownerNamespace = ""
+		}
+		if owner != nil {
+			controllers = append(controllers, owner.APIVersion+"/"+owner.Kind)
+		}
+		owner = &domain.EntityOwner{
+			ID:          string(ownerRef.UID),
+			APIVersion:  ownerRef.APIVersion,
+			Kind:        ownerRef.Kind,
+			Name:        ownerRef.Name,
+			Namespace:   ownerNamespace,
+			Controllers: controllers,
+		}
+
+		item, err := o.get(ctx, gvk, ownerNamespace, ownerRef.Name)
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				return owner, false, nil
+			}
+			return owner, false, err
+		}
+		ownerRef = controllerRef(item.GetOwnerReferences())
+	}
+	return owner, true, nil
+}
+
+// get reads the owner metadata from the informers cache, or from the api server for ownerCacheRetryInterval
+// after the cache of its kind failed
+func (o *OwnerResolver) get(ctx context.Context, gvk schema.GroupVersionKind, namespace, name string) (*metav1.PartialObjectMetadata, error) {
+	item := &metav1.PartialObjectMetadata{}
+	item.SetGroupVersionKind(gvk)
+	key := client.ObjectKey{Namespace: namespace, Name: name}
+
+	o.lock.Lock()
+	retryAt, uncached := o.uncachedKinds[gvk]
+	o.lock.Unlock()
+	if uncached && time.Now().Before(retryAt) {
+		return item, o.apiReader.Get(ctx, key, item)
+	}
+
+	cacheCtx, cancel := context.WithTimeout(ctx, ownerCacheSyncTimeout)
+	defer cancel()
+	err := o.reader.Get(cacheCtx, key, item)
+	if err == nil || apierrors.IsNotFound(err) || ctx.Err() != nil {
+		if uncached && ctx.Err() == nil {
+			o.lock.Lock()
+			delete(o.uncachedKinds, gvk)
+			o.lock.Unlock()
+		}
+		return item, err
+	}
+	var notStarted *cache.ErrCacheNotStarted
+	if errors.As(err, &notStarted) {
+		return item, o.apiReader.Get(ctx, key, item)
+	}
+	logger.Warnw("failed to read owner from cache, reading owners of its kind from the api server", "kind", gvk.String(), "retryAfter", ownerCacheRetryInterval.String(), "error", err)
+	o.lock.Lock()
+	o.uncachedKinds[gvk] = time.Now().Add(ownerCacheRetryInterval)
+	o.lock.Unlock()
+	return item, o.apiReader.Get(ctx, key, item)
+}
+
+// controllerRef returns the managing controller of an object or its first owner if none is marked as controller
+func controllerRef(ownerRefs []metav1.OwnerReference) *metav1.OwnerReference {
+	if len(ownerRefs) == 0 {
+		return nil
+	}
+	for i := range ownerRefs {
+		if ownerRefs[i].Controller != nil && *ownerRefs[i].Controller {
+			return &ownerRefs[i]
+		}
+	}
+	return &ownerRefs[0]
+}
@@ -0,0 +1,206 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newOwnedObject(apiVersion, kind, name, namespace, uid string, owner *unstructured.Unstructured) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(apiVersion)
+	obj.SetKind(kind)
+	obj.SetName(name)
+	obj.SetNamespace(namespace)
+	obj.SetUID(types.UID(uid))
+	if owner != nil {
+		controller := true
+		obj.SetOwnerReferences([]metav1.OwnerReference{
+			{
+				APIVersion: owner.GetAPIVersion(),
+				Kind:       owner.GetKind(),
+				Name:       owner.GetName(),
+				UID:        owner.GetUID(),
+				Controller: &controller,
+			},
+		})
+	}
+	return obj
+}
+
+func TestOwnerResolver_Resolve(t *testing.T) {
+	deployment := newOwnedObject("apps/v1", "Deployment", "nginx", "default", "deployment-uid", nil)
+	replicaSet := newOwnedObject("apps/v1", "ReplicaSet", "nginx-5d8f", "default", "replicaset-uid", deployment)
+	pod := newOwnedObject("v1", "Pod", "nginx-5d8f-x2k", "default", "pod-uid", replicaSet)
+	orphanReplicaSet := newOwnedObject("apps/v1", "ReplicaSet", "orphan", "default", "orphan-uid", nil)
+	orphanPod := newOwnedObject("v1", "Pod", "orphan-x2k", "default", "orphan-pod-uid", orphanReplicaSet)
+	deletedOwnerPod := newOwnedObject("v1", "Pod", "deleted-x2k", "default", "deleted-pod-uid",
+		newOwnedObject("apps/v1", "ReplicaSet", "deleted", "default", "deleted-uid", nil))
+	standalonePod := newOwnedObject("v1", "Pod", "standalone", "default", "standalone-uid", nil)
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "ReplicaSet"}, meta.RESTScopeNamespace)
+
+	reader := fake.NewClientBuilder().
+		WithScheme(clientgoscheme.Scheme).
+		WithObjects(deployment, replicaSet, orphanReplicaSet).
+		Build()
+	resolver := NewOwnerResolver(reader, reader, mapper)
+
+	tests := []struct {
+		name   string
+		entity *unstructured.Unstructured
+		want   *domain.EntityOwner
+	}{
+		{
+			name:   "pod owned by deployment",
+			entity: pod,
+			want: &domain.EntityOwner{
+				ID:          "deployment-uid",
+				APIVersion:  "apps/v1",
+				Kind:        "Deployment",
+				Name:        "nginx",
+				Namespace:   "default",
+				Controllers: []string{"apps/v1/ReplicaSet"},
+			},
+		},
+		{
+			name:   "replicaset owned by deployment",
+			entity: replicaSet,
+			want: &domain.EntityOwner{
+				ID:         "deployment-uid",
+				APIVersion: "apps/v1",
+				Kind:       "Deployment",
+				Name:       "nginx",
+				Namespace:  "default",
+			},
+		},
+		{
+			name:   "pod owned by replicaset without owner",
+			entity: orphanPod,
+			want: &domain.EntityOwner{
+				ID:         "orphan-uid",
+				APIVersion: "apps/v1",
+				Kind:       "ReplicaSet",
+				Name:       "orphan",
+				Namespace:  "default",
+			},
+		},
+		{
+			name:   "pod owned by deleted replicaset",
+			entity: deletedOwnerPod,
+			want: &domain.EntityOwner{
+				ID:         "deleted-uid",
+				APIVersion: "apps/v1",
+				Kind:       "ReplicaSet",
+				Name:       "deleted",
+				Namespace:  "default",
+			},
+		},
+		{
+			name:   "pod without owner",
+			entity: standalonePod,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entity := domain.NewEntityFromSpec(tt.entity.Object)
+			owner, err := resolver.Resolve(context.Background(), entity)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, owner)
+		})
+	}
+}
+
+func TestOwnerResolver_EvictExpired(t *testing.T) {
+	resolver := NewOwnerResolver(nil, nil, nil)
+	now := time.Now()
+	resolver.cache["expired"] = cachedOwner{expiresAt: now.Add(-time.Second)}
+	resolver.cache["valid"] = cachedOwner{expiresAt: now.Add(time.Minute)}
+
+	resolver.evictExpired(now)
+	require.NotContains(t, resolver.cache, types.UID("expired"))
+	require.Contains(t, resolver.cache, types.UID("valid"))
+
+	// eviction runs once every ttl
+	resolver.cache["expired"] = cachedOwner{expiresAt: now.Add(-time.Second)}
+	resolver.evictExpired(now.Add(time.Minute))
+	require.Contains(t, resolver.cache, types.UID("expired"))
+	resolver.evictExpired(now.Add(ownerCacheTTL))
+	require.NotContains(t, resolver.cache, types.UID("expired"))
+}
+
+func TestOwnerResolver_ResolveOwnerNotSynced(t *testing.T) {
+	deployment := newOwnedObject("apps/v1", "Deployment", "nginx", "default", "deployment-uid", nil)
+	replicaSet := newOwnedObject("apps/v1", "ReplicaSet", "nginx-5d8f", "default", "replicaset-uid", deployment)
+	pod := newOwnedObject("v1", "Pod", "nginx-5d8f-x2k", "default", "pod-uid", replicaSet)
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "ReplicaSet"}, meta.RESTScopeNamespace)
+
+	reader := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(deployment).Build()
+	resolver := NewOwnerResolver(reader, reader, mapper)
+	entity := domain.NewEntityFromSpec(pod.Object)
+
+	// the replicaset is not in the cache yet, the partial chain is not cached
+	owner, err := resolver.Resolve(context.Background(), entity)
+	require.NoError(t, err)
+	require.Equal(t, "replicaset-uid", owner.ID)
+	require.Empty(t, resolver.cache)
+
+	require.NoError(t, reader.Create(context.Background(), replicaSet))
+	owner, err = resolver.Resolve(context.Background(), entity)
+	require.NoError(t, err)
+	require.Equal(t, "deployment-uid", owner.ID)
+	require.Contains(t, resolver.cache, types.UID("replicaset-uid"))
+}
+
+// failingReader fails the first reads of the owners
+type failingReader struct {
+	client.Reader
+	failures int
+}
+
+func (r *failingReader) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	if r.failures > 0 {
+		r.failures--
+		return errors.New("timeout waiting for cache to be synced")
+	}
+	return r.Reader.Get(ctx, key, obj, opts...)
+}
+
+func TestOwnerResolver_RetryCache(t *testing.T) {
+	replicaSet := newOwnedObject("apps/v1", "ReplicaSet", "nginx-5d8f", "default", "replicaset-uid", nil)
+	gvk := schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "ReplicaSet"}
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(gvk, meta.RESTScopeNamespace)
+
+	apiReader := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(replicaSet).Build()
+	reader := &failingReader{Reader: apiReader, failures: 1}
+	resolver := NewOwnerResolver(reader, apiReader, mapper)
+
+	// a cache failure reads the kind from the api server until the retry time
+	_, err := resolver.get(context.Background(), gvk, "default", "nginx-5d8f")
+	require.NoError(t, err)
+	require.Contains(t, resolver.uncachedKinds, gvk)
+
+	resolver.uncachedKinds[gvk] = time.Now().Add(-time.Second)
+	_, err = resolver.get(context.Background(), gvk, "default", "nginx-5d8f")
+	require.NoError(t, err)
+	require.NotContains(t, resolver.uncachedKinds, gvk)
+}
@@ -0,0 +1,267 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	pacv2 "github.com/weaveworks/policy-agent/api/v2beta3"
+	"github.com/weaveworks/policy-agent/internal/clients/kube"
+	"github.com/weaveworks/policy-agent/pkg/logger"
+	authv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// namespaceRulesTTL bounds the reuse of the reviewed rules of a namespace, role binding changes do not change the
+// resource version of the namespace
+const namespaceRulesTTL = time.Hour
+
+// namespaceRulesCache keeps the reviewed agent rules of each namespace between discoveries, the rules of a namespace
+// are reviewed again when its resource version changes or after namespaceRulesTTL
+type namespaceRulesCache struct {
+	lock    sync.Mutex
+	entries map[string]namespaceRules
+}
+
+type namespaceRules struct {
+	resourceVersion string
+	rules           []rulesCache
+	reviewedAt      time.Time
+}
+
+func newNamespaceRulesCache() *namespaceRulesCache {
+	return &namespaceRulesCache{entries: make(map[string]namespaceRules)}
+}
+
+// clusterWideResult is the cluster wide review of a resource, reused for its other versions
+type clusterWideResult struct {
+	resourceNames []string
+	allowed       bool
+}
+
+// agentPermissions holds the list permissions of the agent, resources are allowed cluster wide only when the agent
+// can list them across all namespaces, otherwise the rules of each namespace are reviewed
+type agentPermissions struct {
+	kubeClient *kube.KubeClient
+	// agentRules are the list rules in the agent namespace, they include the rules of the cluster roles
+	agentRules []rulesCache
+	// namespaces are the namespaces reviewed for namespaced permissions, nil until the rules are reviewed
+	namespaces []string
+	// rules holds the list rules of each namespace, namespaces whose review failed are left out
+	rules map[string][]rulesCache
+	// rulesCache reuses the namespace rules of the previous discoveries, the namespaces are reviewed every time when nil
+	rulesCache *namespaceRulesCache
+	// clusterWide holds the cluster wide reviews by group and resource
+	clusterWide map[string]clusterWideResult
+}
+
+// getAgentPermissions reviews the agent rules in its namespace, the rules of the other namespaces are reviewed on first use
+// or taken from the rules cache if any
+func getAgentPermissions(ctx context.Context, kubeClient *kube.KubeClient, rulesCache *namespaceRulesCache) (*agentPermissions, error) {
+	rules, err := getNamespaceRules(ctx, kubeClient, kubeClient.GetAgentNamespace())
+	if err != nil {
+		return nil, err
+	}
+	return &agentPermissions{
+		kubeClient:  kubeClient,
+		agentRules:  rules,
+		rulesCache:  rulesCache,
+		clusterWide: make(map[string]clusterWideResult),
+	}, nil
+}
+
+// checkPolicies checks that the agent can list policies, which are cluster scoped
+func (p *agentPermissions) checkPolicies(ctx context.Context) error {
+	allowed, err := p.kubeClient.CanListAllNamespaces(ctx, pacv2.GroupVersion.Group, pacv2.PolicyResourceName, "")
+	if err != nil {
+		return fmt.Errorf("failed to check weaveworks policies resource permissions: %w", err)
+	}
+	if !allowed {
+		return errors.New("missing weaveworks policies resource permissions")
+	}
+	return nil
+}
+
+// allowed returns whether the resource can be listed in all namespaces with the allowed resource names, otherwise
+// the namespaces where the namespaced resource can be listed with the resource names allowed in any of them
+func (p *agentPermissions) allowed(ctx context.Context, group, resource string, namespaced bool) ([]string, []string, bool) {
+	resourceNames, clusterWide := p.allowedClusterWide(ctx, group, resource)
+	if clusterWide || !namespaced {
+		return nil, resourceNames, clusterWide
+	}
+
+	p.reviewNamespaces(ctx)
+	var namespaces []string
+	allNames := false
+	names := make(map[string]struct{})
+	for _, namespace := range p.namespaces {
+		rules, ok := p.rules[namespace]
+		if !ok {
+			continue
+		}
+		namespaceNames, ok := allowedInRules(rules, group, resource)
+		if !ok {
+			continue
+		}
+		namespaces = append(namespaces, namespace)
+		if len(namespaceNames) == 0 {
+			allNames = true
+			continue
+		}
+		for _, name := range namespaceNames {
+			if _, ok := names[name]; !ok {
+				names[name] = struct{}{}
+				resourceNames = append(resourceNames, name)
+			}
+		}
+	}
+	// namespaces allowing every name are listed by the names allowed in the other namespaces
+	if allNames && len(resourceNames) == 0 {
+		resourceNames = nil
+	}
+	return namespaces, resourceNames, false
+}
+
+// allowedClusterWide checks if the resource can be listed across all namespaces once for all its versions, the names
+// allowed by the agent rules are checked one by one when not every name is allowed
+func (p *agentPermissions) allowedClusterWide(ctx context.Context, group, resource string) ([]string, bool) {
+	key := group + "/" + resource
+	if result, ok := p.clusterWide[key]; ok {
+		return result.resourceNames, result.allowed
+	}
+	resourceNames, allowed := p.reviewClusterWide(ctx, group, resource)
+	if ctx.Err() == nil {
+		p.clusterWide[key] = clusterWideResult{resourceNames: resourceNames, allowed: allowed}
+	}
+	return resourceNames, allowed
+}
+
+func (p *agentPermissions) reviewClusterWide(ctx context.Context, group, resource string) ([]string, bool) {
+	key := group + "/" + resource
+	allowed, err := p.kubeClient.CanListAllNamespaces(ctx, group, resource, "")
+	if err != nil {
+		logger.Warnw("failed to review cluster wide permissions", "resource", key, "error", err)
+		return nil, false
+	}
+	if allowed {
+		return nil, true
+	}
+	candidates, ok := allowedInRules(p.agentRules, group, resource)
+	if !ok {
+		return nil, false
+	}
+	var resourceNames []string
+	for _, name := range candidates {
+		allowed, err := p.kubeClient.CanListAllNamespaces(ctx, group, resource, name)
+		if err != nil {
+			logger.Warnw("failed to review cluster wide permissions", "resource", key, "name", name, "error", err)
+			continue
+		}
+		if allowed {
+			resourceNames = append(resourceNames, name)
+		}
+	}
+	return resourceNames, len(resourceNames) > 0
+}
+
+// reviewNamespaces reviews the agent rules in every namespace once, namespaces whose review fails are skipped
+func (p *agentPermissions) reviewNamespaces(ctx context.Context) {
+	if p.namespaces != nil {
+		return
+	}
+	p.rules = make(map[string][]rulesCache)
+	list, err := p.kubeClient.ClientSet.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		logger.Warnw("unable to list namespaces, only resources allowed cluster wide are audited", "error", err)
+		p.namespaces = []string{}
+		return
+	}
+
+	var cached map[string]namespaceRules
+	if p.rulesCache != nil {
+		p.rulesCache.lock.Lock()
+		defer p.rulesCache.lock.Unlock()
+		cached = p.rulesCache.entries
+	}
+	reviewed := make(map[string]namespaceRules, len(list.Items))
+	now := time.Now()
+	p.namespaces = make([]string, 0, len(list.Items))
+	for i := range list.Items {
+		namespace, resourceVersion := list.Items[i].Name, list.Items[i].ResourceVersion
+		p.namespaces = append(p.namespaces, namespace)
+		if entry, ok := cached[namespace]; ok && entry.resourceVersion == resourceVersion && now.Sub(entry.reviewedAt) < namespaceRulesTTL {
+			p.rules[namespace] = entry.rules
+			reviewed[namespace] = entry
+			continue
+		}
+		if ctx.Err() != nil {
+			continue
+		}
+		rules, err := getNamespaceRules(ctx, p.kubeClient, namespace)
+		if err != nil {
+			logger.Warnw("failed to review agent permissions, skipping namespace", "namespace", namespace, "error", err)
+			continue
+		}
+		p.rules[namespace] = rules
+		reviewed[namespace] = namespaceRules{resourceVersion: resourceVersion, rules: rules, reviewedAt: now}
+	}
+	// the rules of the deleted namespaces are dropped
+	if p.rulesCache != nil {
+		p.rulesCache.entries = reviewed
+	}
+}
+
+// allowedInRules returns the resource names allowed by the rules, empty when all names are allowed
+func allowedInRules(rulesCaches []rulesCache, group, resource string) ([]string, bool) {
+	var resourceNames []string
+	allowed := false
+	for i := range rulesCaches {
+		cache := rulesCaches[i]
+		if !checkAllowed(group, cache.apiGroups) || !checkAllowed(resource, cache.resources) {
+			continue
+		}
+		if len(cache.resourceNames) == 0 {
+			return nil, true
+		}
+		allowed = true
+		resourceNames = append(resourceNames, cache.resourceNames...)
+	}
+	return resourceNames, allowed
+}
+
+// getNamespaceRules returns the list rules of the agent in the namespace
+func getNamespaceRules(ctx context.Context, kubeClient *kube.KubeClient, namespace string) ([]rulesCache, error) {
+	permissions, err := kubeClient.GetAgentPermissions(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+	return parseRules(permissions.Status.ResourceRules), nil
+}
+
+func parseRules(rules []authv1.ResourceRule) []rulesCache {
+	var rulesCaches []rulesCache
+	for i := range rules {
+		rule := rules[i]
+		allowList := false
+		for k := range rule.Verbs {
+			if rule.Verbs[k] == listVerb || rule.Verbs[k] == allAllowed {
+				allowList = true
+				break
+			}
+		}
+		if !allowList {
+			continue
+		}
+		cache := newRulesCache(rule.ResourceNames)
+		for k := range rule.Resources {
+			cache.resources[rule.Resources[k]] = struct{}{}
+		}
+		for k := range rule.APIGroups {
+			cache.apiGroups[rule.APIGroups[k]] = struct{}{}
+		}
+		rulesCaches = append(rulesCaches, cache)
+	}
+	return rulesCaches
+}
@@ -0,0 +1,167 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/policy-agent/internal/clients/kube"
+	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+	authv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// reactPermissions answers the agent permission reviews, the cluster rules are granted by cluster roles in every
+// namespace and across all namespaces, the namespace rules are granted by role bindings in their namespace
+func reactPermissions(cli *fake.Clientset, clusterRules func() ([]authv1.ResourceRule, error), namespaceRules map[string][]authv1.ResourceRule) {
+	cli.PrependReactor("create", "selfsubjectrulesreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authv1.SelfSubjectRulesReview)
+		rules, err := clusterRules()
+		if err != nil {
+			return true, nil, err
+		}
+		rules = append(append([]authv1.ResourceRule{}, rules...), namespaceRules[review.Spec.Namespace]...)
+		return true, &authv1.SelfSubjectRulesReview{
+			Status: authv1.SubjectRulesReviewStatus{ResourceRules: rules},
+		}, nil
+	})
+	cli.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authv1.SelfSubjectAccessReview)
+		rules, err := clusterRules()
+		if err != nil {
+			return true, nil, err
+		}
+		attributes := review.Spec.ResourceAttributes
+		names, allowed := allowedInRules(parseRules(rules), attributes.Group, attributes.Resource)
+		if allowed && len(names) > 0 {
+			allowed = false
+			for _, name := range names {
+				if attributes.Name != "" && name == attributes.Name {
+					allowed = true
+				}
+			}
+		}
+		review.Status.Allowed = allowed
+		return true, review, nil
+	})
+}
+
+func TestDiscoverEntitiesSources_NamespacedPermissions(t *testing.T) {
+	clusterRules := []authv1.ResourceRule{
+		{Verbs: []string{"list"}, Resources: []string{"policies"}, APIGroups: []string{"pac.weave.works"}},
+		{Verbs: []string{"list"}, Resources: []string{"configmaps"}, APIGroups: []string{""}},
+		{Verbs: []string{"list"}, Resources: []string{"namespaces"}, APIGroups: []string{""}, ResourceNames: []string{"team-a"}},
+	}
+	namespaceRules := map[string][]authv1.ResourceRule{
+		"team-a": {
+			{Verbs: []string{"list"}, Resources: []string{"pods"}, APIGroups: []string{""}},
+			{Verbs: []string{"list"}, Resources: []string{"secrets"}, APIGroups: []string{""}, ResourceNames: []string{"app-a"}},
+			// cluster scoped resources can not be listed through a role binding
+			{Verbs: []string{"list"}, Resources: []string{"nodes"}, APIGroups: []string{""}},
+		},
+		"team-b": {
+			{Verbs: []string{"list"}, Resources: []string{"pods"}, APIGroups: []string{""}},
+			{Verbs: []string{"list"}, Resources: []string{"secrets"}, APIGroups: []string{""}, ResourceNames: []string{"app-b", "app-a"}},
+		},
+		"team-c": {
+			{Verbs: []string{"get"}, Resources: []string{"pods"}, APIGroups: []string{""}},
+		},
+	}
+
+	cli := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: meta.ObjectMeta{Name: "team-a"}},
+		&corev1.Namespace{ObjectMeta: meta.ObjectMeta{Name: "team-b"}},
+		&corev1.Namespace{ObjectMeta: meta.ObjectMeta{Name: "team-c"}},
+		&corev1.Namespace{ObjectMeta: meta.ObjectMeta{Name: "team-d"}},
+	)
+	reactPermissions(cli, func() ([]authv1.ResourceRule, error) { return clusterRules, nil }, namespaceRules)
+	// a failed review skips its namespace only
+	cli.PrependReactor("create", "selfsubjectrulesreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authv1.SelfSubjectRulesReview)
+		if review.Spec.Namespace == "team-d" {
+			return true, nil, errors.New("review failed")
+		}
+		return false, nil, nil
+	})
+
+	scheme := runtime.NewScheme()
+	scheme.AddKnownTypeWithName(schema.GroupVersionKind{Version: "v1", Kind: "PodList"}, &unstructured.UnstructuredList{})
+	dynamicCli := dynamicfake.NewSimpleDynamicClient(scheme)
+	var listedNamespaces []string
+	dynamicCli.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		listedNamespaces = append(listedNamespaces, action.GetNamespace())
+		return true, &unstructured.UnstructuredList{}, nil
+	})
+
+	kubeClient := &kube.KubeClient{
+		ClientSet:     cli,
+		DynamicClient: dynamicCli,
+		DiscoveryClient: &DiscoveryMock{
+			ApiList: []*meta.APIResourceList{
+				{
+					GroupVersion: "v1",
+					APIResources: []meta.APIResource{
+						{Name: "pods", Kind: "Pod", Namespaced: true, Verbs: []string{"list"}},
+						{Name: "configmaps", Kind: "ConfigMap", Namespaced: true, Verbs: []string{"list"}},
+						{Name: "secrets", Kind: "Secret", Namespaced: true, Verbs: []string{"list"}},
+						{Name: "nodes", Kind: "Node", Verbs: []string{"list"}},
+						{Name: "namespaces", Kind: "Namespace", Verbs: []string{"list"}},
+					},
+				},
+			},
+		},
+	}
+
+	sources, deniedKinds, err := DiscoverEntitiesSources(context.Background(), kubeClient, SourcesFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Node"}, deniedKinds)
+	require.Len(t, sources, 4)
+
+	// allowed by role bindings in every reviewed namespace, still listed namespace by namespace
+	pods := sources[0].(*K8SEntitySource)
+	assert.Equal(t, "Pod", pods.kind)
+	assert.Equal(t, []string{"team-a", "team-b"}, pods.allowedNamespaces)
+	configMaps := sources[1].(*K8SEntitySource)
+	assert.Equal(t, "ConfigMap", configMaps.kind)
+	assert.Nil(t, configMaps.allowedNamespaces)
+	secrets := sources[2].(*K8SEntitySource)
+	assert.Equal(t, "Secret", secrets.kind)
+	assert.Equal(t, []string{"team-a", "team-b"}, secrets.allowedNamespaces)
+	assert.Equal(t, []string{"app-a", "app-b"}, secrets.resourceNames)
+	// names allowed by a cluster role are listed cluster wide
+	namespaces := sources[3].(*K8SEntitySource)
+	assert.Equal(t, "Namespace", namespaces.kind)
+	assert.Nil(t, namespaces.allowedNamespaces)
+	assert.Equal(t, []string{"team-a"}, namespaces.resourceNames)
+
+	_, err = pods.List(context.Background(), &domain.ListOptions{Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"team-a", "team-b"}, listedNamespaces)
+
+	// the namespace rules are reused by the next discoveries, the namespaces whose review failed are reviewed again
+	var reviewedNamespaces []string
+	cli.PrependReactor("create", "selfsubjectrulesreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authv1.SelfSubjectRulesReview)
+		reviewedNamespaces = append(reviewedNamespaces, review.Spec.Namespace)
+		return false, nil, nil
+	})
+	rulesCache := newNamespaceRulesCache()
+	_, _, err = discoverEntitiesSources(context.Background(), kubeClient, SourcesFilter{}, rulesCache)
+	require.NoError(t, err)
+	assert.Equal(t, []string{kubeClient.GetAgentNamespace(), "team-a", "team-b", "team-c", "team-d"}, reviewedNamespaces)
+
+	reviewedNamespaces = nil
+	sources, _, err = discoverEntitiesSources(context.Background(), kubeClient, SourcesFilter{}, rulesCache)
+	require.NoError(t, err)
+	assert.Equal(t, []string{kubeClient.GetAgentNamespace(), "team-d"}, reviewedNamespaces)
+	assert.Equal(t, []string{"team-a", "team-b"}, sources[0].(*K8SEntitySource).allowedNamespaces)
+}
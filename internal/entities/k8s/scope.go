@@ -0,0 +1,32 @@
+package k8s
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// ScopeResolver gets the scope of the kinds from the rest mapper of the cluster,
+// implements github.com/weaveworks/policy-agent/pkg/policy-core/domain.ScopeResolver
+type ScopeResolver struct {
+	mapper meta.RESTMapper
+}
+
+// NewScopeResolver returns a scope resolver of the kinds known by the rest mapper
+func NewScopeResolver(mapper meta.RESTMapper) *ScopeResolver {
+	return &ScopeResolver{mapper: mapper}
+}
+
+// IsNamespaced checks if the entities of the kind of the api version are namespaced
+func (s *ScopeResolver) IsNamespaced(apiVersion, kind string) (bool, error) {
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return false, fmt.Errorf("invalid api version %s: %w", apiVersion, err)
+	}
+	mapping, err := s.mapper.RESTMapping(gv.WithKind(kind).GroupKind(), gv.Version)
+	if err != nil {
+		return false, fmt.Errorf("failed to get the scope of kind %s: %w", kind, err)
+	}
+	return mapping.Scope.Name() == meta.RESTScopeNameNamespace, nil
+}
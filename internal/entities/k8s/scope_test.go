@@ -0,0 +1,41 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestScopeResolver_IsNamespaced(t *testing.T) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole"}, meta.RESTScopeRoot)
+	resolver := NewScopeResolver(mapper)
+
+	cases := []struct {
+		name       string
+		apiVersion string
+		kind       string
+		namespaced bool
+		wantErr    bool
+	}{
+		{name: "namespaced kind", apiVersion: "apps/v1", kind: "Deployment", namespaced: true},
+		{name: "cluster scoped kind", apiVersion: "rbac.authorization.k8s.io/v1", kind: "ClusterRole"},
+		{name: "unknown kind", apiVersion: "example.com/v1", kind: "Widget", wantErr: true},
+		{name: "invalid api version", apiVersion: "a/b/c", kind: "Widget", wantErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			namespaced, err := resolver.IsNamespaced(c.apiVersion, c.kind)
+			if c.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, c.namespaced, namespaced)
+		})
+	}
+}
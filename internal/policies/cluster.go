@@ -0,0 +1,72 @@
+package crd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// namespaceLabelsFunc returns the labels of a namespace of the cluster of the entity
+type namespaceLabelsFunc func(ctx context.Context, namespace string) (map[string]string, error)
+
+// policyConfigSource is implemented by the policies sources of this package, it matches the policy configs
+// with the namespace labels of the cluster of the entity
+type policyConfigSource interface {
+	getPolicyConfig(ctx context.Context, entity domain.Entity, namespaceLabels namespaceLabelsFunc) (*domain.PolicyConfig, error)
+}
+
+// getSourcePolicyConfig returns the policy config of the entity from the source with the namespace labels,
+// sources of other packages resolve the namespace labels themselves
+func getSourcePolicyConfig(ctx context.Context, source domain.PoliciesSource, entity domain.Entity, namespaceLabels namespaceLabelsFunc) (*domain.PolicyConfig, error) {
+	if configSource, ok := source.(policyConfigSource); ok {
+		return configSource.getPolicyConfig(ctx, entity, namespaceLabels)
+	}
+	return source.GetPolicyConfig(ctx, entity)
+}
+
+// ClusterPolicies matches the policy configs of a policies source with the namespaces of another cluster
+type ClusterPolicies struct {
+	source     domain.PoliciesSource
+	namespaces domain.NamespaceResolver
+}
+
+// NewClusterPolicies returns a policies source returning the policies of source, its policy configs are matched
+// with the labels of the namespaces found by the namespace resolver of the audited cluster
+func NewClusterPolicies(source domain.PoliciesSource, namespaces domain.NamespaceResolver) *ClusterPolicies {
+	return &ClusterPolicies{
+		source:     source,
+		namespaces: namespaces,
+	}
+}
+
+// GetAll returns the policies of the underlying source, implements github.com/weaveworks/policy-agent/pkg/policy-core/domain.PoliciesSource
+func (c *ClusterPolicies) GetAll(ctx context.Context) ([]domain.Policy, error) {
+	return c.source.GetAll(ctx)
+}
+
+// GetPolicyConfig returns the policy config of the entity matched with the namespaces of the cluster,
+// implements github.com/weaveworks/policy-agent/pkg/policy-core/domain.PoliciesSource
+func (c *ClusterPolicies) GetPolicyConfig(ctx context.Context, entity domain.Entity) (*domain.PolicyConfig, error) {
+	return getSourcePolicyConfig(ctx, c.source, entity, c.namespaceLabels)
+}
+
+// getPolicyConfig matches the policy configs with the given namespace labels, a cluster policies source wrapped again
+// for another cluster matches the namespaces of the outer cluster
+func (c *ClusterPolicies) getPolicyConfig(ctx context.Context, entity domain.Entity, namespaceLabels namespaceLabelsFunc) (*domain.PolicyConfig, error) {
+	return getSourcePolicyConfig(ctx, c.source, entity, namespaceLabels)
+}
+
+func (c *ClusterPolicies) namespaceLabels(ctx context.Context, name string) (map[string]string, error) {
+	namespace, err := c.namespaces.GetNamespace(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get entity namespace: %w", err)
+	}
+	// namespaces without labels are still matched by namespace selectors
+	labels := map[string]string{}
+	for key, value := range (&unstructured.Unstructured{Object: namespace}).GetLabels() {
+		labels[key] = value
+	}
+	return labels, nil
+}
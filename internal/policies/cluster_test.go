@@ -0,0 +1,76 @@
+package crd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pacv2 "github.com/weaveworks/policy-agent/api/v2beta3"
+	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+type namespacesMock map[string]map[string]interface{}
+
+func (n namespacesMock) GetNamespace(_ context.Context, name string) (map[string]interface{}, error) {
+	return n[name], nil
+}
+
+func TestClusterPolicies(t *testing.T) {
+	config := newTestPolicyConfig("staging", pacv2.PolicyConfigTarget{
+		NamespaceSelector: &v1.LabelSelector{MatchLabels: map[string]string{"env": "staging"}},
+	}, map[string]string{"replicas": "2"})
+	schema := runtime.NewScheme()
+	pacv2.AddToScheme(schema)
+	corev1.AddToScheme(schema)
+	// the hub namespace does not match the selector, the remote namespace does
+	watcher := &PoliciesWatcher{cache: NewFakeCache(schema,
+		config,
+		&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "apps", Labels: map[string]string{"env": "prod"}}},
+	)}
+	remote := namespacesMock{
+		"apps": {"metadata": map[string]interface{}{"name": "apps", "labels": map[string]interface{}{"env": "staging"}}},
+	}
+
+	cases := []struct {
+		name    string
+		source  domain.PoliciesSource
+		entity  domain.Entity
+		matched bool
+	}{
+		{
+			name:   "hub namespace labels",
+			source: watcher,
+			entity: domain.Entity{Kind: "Deployment", Name: "api", Namespace: "apps"},
+		},
+		{
+			name:    "remote namespace labels",
+			source:  NewClusterPolicies(watcher, remote),
+			entity:  domain.Entity{Kind: "Deployment", Name: "api", Namespace: "apps"},
+			matched: true,
+		},
+		{
+			name:    "remote namespace labels through filter",
+			source:  NewClusterPolicies(NewPoliciesFilter(watcher, []string{"policy-1"}), remote),
+			entity:  domain.Entity{Kind: "Deployment", Name: "api", Namespace: "apps"},
+			matched: true,
+		},
+		{
+			name:   "namespace missing in remote cluster",
+			source: NewClusterPolicies(watcher, remote),
+			entity: domain.Entity{Kind: "Deployment", Name: "api", Namespace: "jobs"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			result, err := c.source.GetPolicyConfig(context.Background(), c.entity)
+			require.NoError(t, err)
+			_, ok := result.Config["policy-1"]
+			assert.Equal(t, c.matched, ok)
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package crd
+
+import (
+	"time"
+
+	pacv2 "github.com/weaveworks/policy-agent/api/v2beta3"
+	"github.com/weaveworks/policy-agent/pkg/logger"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+)
+
+// ExclusionExpiredReason is the reason of the warning event emitted on a policy when one of its exclusion entries expires
+const ExclusionExpiredReason = "ExclusionExpired"
+
+// ExpiredExclusions returns the exclusion entries expired at the given time and the time the next entry expires if any
+func ExpiredExclusions(entries []pacv2.PolicyExclusionEntry, now time.Time) ([]pacv2.PolicyExclusionEntry, *time.Time) {
+	var expired []pacv2.PolicyExclusionEntry
+	var nextExpiry *time.Time
+	for _, entry := range entries {
+		if entry.ExpiresAt == nil {
+			continue
+		}
+		expiresAt := entry.ExpiresAt.Time
+		if now.Before(expiresAt) {
+			if nextExpiry == nil || expiresAt.Before(*nextExpiry) {
+				nextExpiry = &expiresAt
+			}
+			continue
+		}
+		expired = append(expired, entry)
+	}
+	return expired, nextExpiry
+}
+
+// SameExclusionEntry checks if the exclusion entries have the same patterns and expiry, the reason is ignored
+func SameExclusionEntry(a, b pacv2.PolicyExclusionEntry) bool {
+	if a.Kind != b.Kind || a.Namespace != b.Namespace || a.Name != b.Name {
+		return false
+	}
+	if a.ExpiresAt == nil || b.ExpiresAt == nil {
+		return a.ExpiresAt == b.ExpiresAt
+	}
+	return a.ExpiresAt.Equal(b.ExpiresAt)
+}
+
+// ReportExpiredExclusion logs the expired exclusion entry and emits a warning event on the policy when the recorder is set
+func ReportExpiredExclusion(recorder record.EventRecorder, policy runtime.Object, name string, entry pacv2.PolicyExclusionEntry) {
+	expiresAt := entry.ExpiresAt.UTC().Format(time.RFC3339)
+	logger.Warnw("policy exclusion expired", "policy", name, "kind", entry.Kind, "namespace", entry.Namespace, "name", entry.Name, "expiresAt", expiresAt)
+	if recorder == nil {
+		return
+	}
+	recorder.Eventf(policy, corev1.EventTypeWarning, ExclusionExpiredReason,
+		"exclusion of kind '%s', namespace '%s' and name '%s' expired at %s and no longer applies",
+		entry.Kind, entry.Namespace, entry.Name, expiresAt)
+}
@@ -0,0 +1,317 @@
+package crd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	pacv2 "github.com/weaveworks/policy-agent/api/v2beta3"
+	"github.com/weaveworks/policy-agent/internal/entities/filesystem"
+	"github.com/weaveworks/policy-agent/pkg/logger"
+	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+)
+
+// expiredExclusionsInterval is the period the expired exclusion entries are checked when reloading is disabled
+const expiredExclusionsInterval = time.Minute
+
+// FilesystemPolicies is a policies source loading the policies, policy configs and policy sets from the manifests
+// of a directory or an OCI image layout, the manifests are loaded again when the files change,
+// implements github.com/weaveworks/policy-agent/pkg/policy-core/domain.PoliciesSource
+type FilesystemPolicies struct {
+	path     string
+	provider string
+	mode     string
+	interval time.Duration
+	// recorder emits a warning event on the policies when one of their exclusion entries expires
+	recorder record.EventRecorder
+
+	lock sync.RWMutex
+	// reportedUntil is the time the expired exclusion entries were last reported
+	reportedUntil time.Time
+	// fingerprint identifies the state of the files the resources were loaded from
+	fingerprint       string
+	policies          []pacv2.Policy
+	namespacePolicies []pacv2.NamespacePolicy
+	// namespaceEvaluators are the namespace policies compiled when they are loaded
+	namespaceEvaluators []domain.PolicyEvaluator
+	configs             []pacv2.PolicyConfig
+	configSelectors     []policyConfigSelectors
+	policySets          []pacv2.PolicySet
+}
+
+// NewFilesystemPolicies loads the resources of the path, a directory or an OCI image layout, the policies are limited
+// to the provider and the ones selected by the policy sets of the mode if any, a non positive interval disables reloading
+func NewFilesystemPolicies(path, provider, mode string, interval time.Duration) (*FilesystemPolicies, error) {
+	f := &FilesystemPolicies{
+		path:     path,
+		provider: provider,
+		mode:     mode,
+		interval: interval,
+	}
+	if _, err := f.Reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// GetAll returns the policies of the provider enabled in the mode and selected by its policy sets, or all of them when the mode has no policy sets
+func (f *FilesystemPolicies) GetAll(_ context.Context) ([]domain.Policy, error) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	var policySets []pacv2.PolicySet
+	if f.mode != "" {
+		for i := range f.policySets {
+			if f.policySets[i].Spec.Mode == f.mode {
+				policySets = append(policySets, f.policySets[i])
+			}
+		}
+	}
+
+	var policies []domain.Policy
+	for i := range f.policies {
+		if f.policies[i].Spec.Provider != f.provider || !f.policies[i].Spec.EnabledIn(f.mode) || !matchPolicySets(policySets, f.policies[i]) {
+			continue
+		}
+		policies = append(policies, toDomainPolicy(f.policies[i]))
+	}
+	if f.provider == pacv2.PolicyKubernetesProvider {
+		policies = append(policies, toNamespaceDomainPolicies(f.namespacePolicies, f.namespaceEvaluators, f.mode)...)
+	}
+	return policies, nil
+}
+
+// GetPolicyConfig returns the merged policy configs targeting the entity, workspaces and namespace selectors are not matched
+// as namespaces are not loaded from files, wrap the source with NewClusterPolicies to match them with the cluster namespaces
+func (f *FilesystemPolicies) GetPolicyConfig(ctx context.Context, entity domain.Entity) (*domain.PolicyConfig, error) {
+	return f.getPolicyConfig(ctx, entity, nil)
+}
+
+func (f *FilesystemPolicies) getPolicyConfig(ctx context.Context, entity domain.Entity, namespaceLabels namespaceLabelsFunc) (*domain.PolicyConfig, error) {
+	var labels map[string]string
+	if entity.Namespace != "" && namespaceLabels != nil {
+		var err error
+		labels, err = namespaceLabels(ctx, entity.Namespace)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return matchPolicyConfigs(f.configs, f.configSelectors, entity, labels)
+}
+
+// SetRecorder sets the recorder emitting a warning event on the policies and namespace policies when one of their
+// exclusion entries expires, the events are emitted by Start
+func (f *FilesystemPolicies) SetRecorder(recorder record.EventRecorder) {
+	f.recorder = recorder
+}
+
+// Start reloads the resources periodically when the files change and reports the exclusion entries expiring
+// once started until the context is done
+func (f *FilesystemPolicies) Start(ctx context.Context) error {
+	if f.interval <= 0 && f.recorder == nil {
+		return nil
+	}
+	interval := f.interval
+	if interval <= 0 {
+		interval = expiredExclusionsInterval
+	}
+	f.lock.Lock()
+	f.reportedUntil = time.Now()
+	f.lock.Unlock()
+	logger.Infow("starting filesystem policies reloader", "path", f.path, "interval", interval.String())
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("stopping filesystem policies reloader...")
+			return nil
+		case <-ticker.C:
+			if f.interval > 0 {
+				if _, err := f.Reload(); err != nil {
+					logger.Errorw("failed to reload filesystem policies, keeping the previous ones", "path", f.path, "error", err)
+				}
+			}
+			if f.recorder != nil {
+				f.reportExpiredExclusions(time.Now())
+			}
+		}
+	}
+}
+
+// reportExpiredExclusions reports the exclusion entries of the policies and namespace policies expired since the
+// last report, the entries expired before the reloader started are not reported
+func (f *FilesystemPolicies) reportExpiredExclusions(now time.Time) {
+	f.lock.Lock()
+	since := f.reportedUntil
+	f.reportedUntil = now
+	policies := f.policies
+	namespacePolicies := f.namespacePolicies
+	f.lock.Unlock()
+
+	report := func(policy runtime.Object, name string, entries []pacv2.PolicyExclusionEntry) {
+		expired, _ := ExpiredExclusions(entries, now)
+		for _, entry := range expired {
+			if entry.ExpiresAt.Time.After(since) {
+				ReportExpiredExclusion(f.recorder, policy, name, entry)
+			}
+		}
+	}
+	for i := range policies {
+		report(&policies[i], policies[i].Name, policies[i].Spec.Exclude.Entries)
+	}
+	for i := range namespacePolicies {
+		report(&namespacePolicies[i], namespacePolicies[i].Namespace+"/"+namespacePolicies[i].Name, namespacePolicies[i].Spec.Exclude.Entries)
+	}
+}
+
+// Reload loads the resources again if the files changed since the last load and reports whether they were loaded,
+// the previous resources are kept on failure
+func (f *FilesystemPolicies) Reload() (bool, error) {
+	fingerprint, err := fingerprintFiles(f.path)
+	if err != nil {
+		return false, err
+	}
+	f.lock.RLock()
+	unchanged := fingerprint == f.fingerprint
+	f.lock.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	var manifests []filesystem.Manifest
+	if isOCILayout(f.path) {
+		manifests, err = loadOCILayout(f.path)
+	} else {
+		manifests, err = filesystem.LoadManifests(f.path)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var policies []pacv2.Policy
+	var namespacePolicies []pacv2.NamespacePolicy
+	var namespaceEvaluators []domain.PolicyEvaluator
+	var configs []pacv2.PolicyConfig
+	var configSelectors []policyConfigSelectors
+	var policySets []pacv2.PolicySet
+	policyIDs := make(map[string]string)
+	for _, manifest := range manifests {
+		apiVersion, _ := manifest.Object["apiVersion"].(string)
+		kind, _ := manifest.Object["kind"].(string)
+		if apiVersion != pacv2.GroupVersion.Identifier() {
+			continue
+		}
+		switch kind {
+		case pacv2.PolicyKind:
+			policy, err := decodePolicy(manifest.Object)
+			if err != nil {
+				return false, fmt.Errorf("failed to decode policy in %s:%d: %w", manifest.Path, manifest.Line, err)
+			}
+			if path, ok := policyIDs[policy.Spec.ID]; ok {
+				logger.Warnw("skipping policy with duplicate id", "id", policy.Spec.ID, "path", manifest.Path, "first", path)
+				continue
+			}
+			policyIDs[policy.Spec.ID] = manifest.Path
+			policies = append(policies, policy)
+		case pacv2.NamespacePolicyKind:
+			policy, err := decodePolicy(manifest.Object)
+			if err != nil {
+				return false, fmt.Errorf("failed to decode namespace policy in %s:%d: %w", manifest.Path, manifest.Line, err)
+			}
+			if policy.Namespace == "" {
+				return false, fmt.Errorf("namespace policy in %s:%d has no namespace", manifest.Path, manifest.Line)
+			}
+			namespacePolicy := pacv2.NamespacePolicy{
+				TypeMeta:   policy.TypeMeta,
+				ObjectMeta: policy.ObjectMeta,
+				Spec:       policy.Spec,
+			}
+			namespacePolicies = append(namespacePolicies, namespacePolicy)
+			namespaceEvaluators = append(namespaceEvaluators, prepareNamespacePolicy(context.Background(), namespacePolicy))
+		case pacv2.PolicyConfigKind:
+			config := pacv2.PolicyConfig{}
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(manifest.Object, &config); err != nil {
+				return false, fmt.Errorf("failed to decode policy config in %s:%d: %w", manifest.Path, manifest.Line, err)
+			}
+			if err := config.Validate(); err != nil {
+				return false, fmt.Errorf("invalid policy config in %s:%d: %w", manifest.Path, manifest.Line, err)
+			}
+			configs = append(configs, config)
+			configSelectors = append(configSelectors, parseConfigSelectors(config))
+		case pacv2.PolicySetKind:
+			policySet := pacv2.PolicySet{}
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(manifest.Object, &policySet); err != nil {
+				return false, fmt.Errorf("failed to decode policy set in %s:%d: %w", manifest.Path, manifest.Line, err)
+			}
+			policySets = append(policySets, policySet)
+		}
+	}
+
+	f.lock.Lock()
+	f.fingerprint = fingerprint
+	f.policies = policies
+	f.namespacePolicies = namespacePolicies
+	f.namespaceEvaluators = namespaceEvaluators
+	f.configs = configs
+	f.configSelectors = configSelectors
+	f.policySets = policySets
+	f.lock.Unlock()
+	logger.Infow("loaded filesystem policies", "path", f.path, "policies", len(policies), "namespacePolicies", len(namespacePolicies), "policyConfigs", len(configs), "policySets", len(policySets))
+	return true, nil
+}
+
+// decodePolicy converts the policy or namespace policy manifest applying the defaults of the policy resource definition
+func decodePolicy(object map[string]interface{}) (pacv2.Policy, error) {
+	policy := pacv2.Policy{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(object, &policy); err != nil {
+		return policy, err
+	}
+	if _, ok, _ := unstructured.NestedFieldNoCopy(object, "spec", "enforce"); !ok {
+		policy.Spec.Enforce = true
+	}
+	if policy.Spec.Provider == "" {
+		policy.Spec.Provider = pacv2.PolicyKubernetesProvider
+	}
+	return policy, nil
+}
+
+// fingerprintFiles hashes the paths, sizes and modification times of the files under root,
+// symlinks are followed to detect mounted config maps updates
+func fingerprintFiles(root string) (string, error) {
+	hash := sha256.New()
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(hash, "%s:%d:%d\n", path, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", root, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
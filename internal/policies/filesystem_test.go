@@ -0,0 +1,311 @@
+package crd
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pacv2 "github.com/weaveworks/policy-agent/api/v2beta3"
+	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+	"k8s.io/client-go/tools/record"
+)
+
+const filesystemPolicies = `apiVersion: pac.weave.works/v2beta3
+kind: Policy
+metadata:
+  name: policy-1
+spec:
+  id: policy-1
+  name: policy 1
+  category: category-x
+  severity: high
+  code: |
+    package test
+    violation[result] { result = {"msg": "violation"} }
+  parameters:
+    - name: replicas
+      type: integer
+      value: 3
+---
+apiVersion: pac.weave.works/v2beta3
+kind: Policy
+metadata:
+  name: policy-2
+spec:
+  id: policy-2
+  name: policy 2
+  category: category-y
+  severity: low
+  enforce: false
+  code: package test
+---
+apiVersion: pac.weave.works/v2beta3
+kind: Policy
+metadata:
+  name: policy-3
+spec:
+  id: policy-3
+  name: policy 3
+  provider: terraform
+  code: package test
+`
+
+const filesystemConfigs = `apiVersion: pac.weave.works/v2beta3
+kind: PolicyConfig
+metadata:
+  name: dev-config
+spec:
+  match:
+    namespaces:
+      - dev
+  config:
+    policy-1:
+      parameters:
+        replicas: 5
+---
+apiVersion: pac.weave.works/v2beta3
+kind: PolicyConfig
+metadata:
+  name: staging-config
+spec:
+  match:
+    namespaceSelector:
+      matchLabels:
+        env: staging
+  config:
+    policy-1:
+      parameters:
+        replicas: 4
+---
+apiVersion: pac.weave.works/v2beta3
+kind: PolicySet
+metadata:
+  name: audit
+spec:
+  mode: audit
+  filters:
+    categories:
+      - category-y
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: ignored
+`
+
+func policyIDs(policies []domain.Policy) []string {
+	var ids []string
+	for _, policy := range policies {
+		ids = append(ids, policy.ID)
+	}
+	return ids
+}
+
+func TestFilesystemPolicies(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "policies.yaml"), []byte(filesystemPolicies), 0o644))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "configs"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "configs", "configs.yaml"), []byte(filesystemConfigs), 0o644))
+
+	ctx := context.Background()
+	source, err := NewFilesystemPolicies(dir, pacv2.PolicyKubernetesProvider, "", 0)
+	require.NoError(t, err)
+
+	policies, err := source.GetAll(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"policy-1", "policy-2"}, policyIDs(policies))
+	// policies without enforce are enforced as in the policy resource definition
+	assert.True(t, policies[0].Enforce)
+	assert.False(t, policies[1].Enforce)
+	assert.Equal(t, float64(3), policies[0].Parameters[0].Value)
+
+	config, err := source.GetPolicyConfig(ctx, domain.Entity{Name: "app", Kind: "Deployment", Namespace: "dev"})
+	require.NoError(t, err)
+	assert.Equal(t, float64(5), config.Config["policy-1"].Parameters["replicas"].Value)
+	assert.Equal(t, "dev-config", config.Config["policy-1"].Parameters["replicas"].ConfigRef)
+
+	config, err = source.GetPolicyConfig(ctx, domain.Entity{Name: "app", Kind: "Deployment", Namespace: "prod"})
+	require.NoError(t, err)
+	assert.Empty(t, config.Config)
+
+	// namespace selectors are matched with the labels of the cluster namespaces
+	staging := domain.Entity{Name: "app", Kind: "Deployment", Namespace: "staging"}
+	config, err = source.GetPolicyConfig(ctx, staging)
+	require.NoError(t, err)
+	assert.Empty(t, config.Config)
+	namespaces := namespacesMock{
+		"staging": {"metadata": map[string]interface{}{"name": "staging", "labels": map[string]interface{}{"env": "staging"}}},
+	}
+	config, err = NewClusterPolicies(source, namespaces).GetPolicyConfig(ctx, staging)
+	require.NoError(t, err)
+	assert.Equal(t, float64(4), config.Config["policy-1"].Parameters["replicas"].Value)
+	assert.Equal(t, "staging-config", config.Config["policy-1"].Parameters["replicas"].ConfigRef)
+
+	auditSource, err := NewFilesystemPolicies(dir, pacv2.PolicyKubernetesProvider, pacv2.PolicySetAuditMode, 0)
+	require.NoError(t, err)
+	policies, err = auditSource.GetAll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"policy-2"}, policyIDs(policies))
+
+	terraformSource, err := NewFilesystemPolicies(dir, pacv2.PolicyTerraformProvider, "", 0)
+	require.NoError(t, err)
+	policies, err = terraformSource.GetAll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"policy-3"}, policyIDs(policies))
+
+	// unchanged files are not loaded again
+	reloaded, err := source.Reload()
+	require.NoError(t, err)
+	assert.False(t, reloaded)
+
+	require.NoError(t, os.Remove(filepath.Join(dir, "configs", "configs.yaml")))
+	reloaded, err = source.Reload()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+	config, err = source.GetPolicyConfig(ctx, domain.Entity{Name: "app", Kind: "Deployment", Namespace: "dev"})
+	require.NoError(t, err)
+	assert.Empty(t, config.Config)
+
+	// invalid files keep the previous policies
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "invalid.yaml"), []byte("apiVersion: pac.weave.works/v2beta3\nkind: Policy\nspec: []\n"), 0o644))
+	_, err = source.Reload()
+	assert.Error(t, err)
+	policies, err = source.GetAll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"policy-1", "policy-2"}, policyIDs(policies))
+}
+
+func TestFilesystemPoliciesStart(t *testing.T) {
+	dir := t.TempDir()
+	source, err := NewFilesystemPolicies(dir, pacv2.PolicyKubernetesProvider, "", 10*time.Millisecond)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go source.Start(ctx)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "policies.yaml"), []byte(filesystemPolicies), 0o644))
+	assert.Eventually(t, func() bool {
+		policies, _ := source.GetAll(ctx)
+		return len(policies) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+// writeBlob writes the blob to the image layout and returns its descriptor
+func writeBlob(t *testing.T, root, mediaType string, data []byte, annotations map[string]string) ociDescriptor {
+	sum := sha256.Sum256(data)
+	encoded := hex.EncodeToString(sum[:])
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "blobs", "sha256"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "blobs", "sha256", encoded), data, 0o644))
+	return ociDescriptor{MediaType: mediaType, Digest: "sha256:" + encoded, Annotations: annotations}
+}
+
+func TestFilesystemPoliciesOCILayout(t *testing.T) {
+	var archive bytes.Buffer
+	gzipWriter := gzip.NewWriter(&archive)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for name, content := range map[string]string{
+		"policies/policies.yaml": filesystemPolicies,
+		".hidden/configs.yaml":   filesystemConfigs,
+		"README.md":              "# policies",
+	} {
+		require.NoError(t, tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		_, err := tarWriter.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tarWriter.Close())
+	require.NoError(t, gzipWriter.Close())
+
+	root := t.TempDir()
+	layers := []ociDescriptor{
+		writeBlob(t, root, "application/vnd.cncf.flux.content.v1.tar+gzip", archive.Bytes(), nil),
+		writeBlob(t, root, "application/yaml", []byte(filesystemConfigs), map[string]string{ociTitleAnnotation: "configs.yaml"}),
+	}
+	manifest, err := json.Marshal(ociManifest{Layers: layers})
+	require.NoError(t, err)
+	manifestDescriptor := writeBlob(t, root, "application/vnd.oci.image.manifest.v1+json", manifest, nil)
+	index, err := json.Marshal(ociManifest{Manifests: []ociDescriptor{manifestDescriptor}})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(root, ociIndexFile), index, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, ociLayoutFile), []byte(`{"imageLayoutVersion": "1.0.0"}`), 0o644))
+
+	ctx := context.Background()
+	source, err := NewFilesystemPolicies(root, pacv2.PolicyKubernetesProvider, "", 0)
+	require.NoError(t, err)
+	policies, err := source.GetAll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"policy-1", "policy-2"}, policyIDs(policies))
+	config, err := source.GetPolicyConfig(ctx, domain.Entity{Name: "app", Kind: "Deployment", Namespace: "dev"})
+	require.NoError(t, err)
+	assert.Equal(t, float64(5), config.Config["policy-1"].Parameters["replicas"].Value)
+
+	// blobs not matching their digest are rejected
+	require.NoError(t, os.WriteFile(filepath.Join(root, "blobs", layers[1].Digest[:6], layers[1].Digest[7:]), []byte("tampered"), 0o644))
+	_, err = NewFilesystemPolicies(root, pacv2.PolicyKubernetesProvider, "", 0)
+	assert.ErrorContains(t, err, "does not match its digest")
+}
+
+func TestFilesystemPoliciesExpiredExclusions(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	manifest := fmt.Sprintf(`apiVersion: pac.weave.works/v2beta3
+kind: Policy
+metadata:
+  name: waivers
+spec:
+  id: waivers
+  name: waivers
+  code: package test
+  exclude:
+    entries:
+      - namespace: dev
+        expiresAt: %s
+      - namespace: staging
+        expiresAt: %s
+---
+apiVersion: pac.weave.works/v2beta3
+kind: NamespacePolicy
+metadata:
+  name: tenant-waivers
+  namespace: team-a
+spec:
+  id: tenant-waivers
+  name: tenant waivers
+  code: package test
+  exclude:
+    entries:
+      - name: legacy-*
+        expiresAt: %s
+`, now.Add(-time.Hour).Format(time.RFC3339), now.Add(time.Hour).Format(time.RFC3339), now.Add(-time.Minute).Format(time.RFC3339))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "policies.yaml"), []byte(manifest), 0644))
+
+	f, err := NewFilesystemPolicies(dir, pacv2.PolicyKubernetesProvider, "", 0)
+	require.NoError(t, err)
+	recorder := record.NewFakeRecorder(10)
+	f.SetRecorder(recorder)
+	f.reportedUntil = now.Add(-30 * time.Minute)
+
+	// the entries expired since the last report are reported once
+	f.reportExpiredExclusions(now)
+	require.Len(t, recorder.Events, 1)
+	event := <-recorder.Events
+	assert.Contains(t, event, "Warning ExclusionExpired")
+	assert.Contains(t, event, "name 'legacy-*'")
+
+	f.reportExpiredExclusions(now.Add(time.Minute))
+	assert.Empty(t, recorder.Events)
+
+	f.reportExpiredExclusions(now.Add(2 * time.Hour))
+	require.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, "namespace 'staging'")
+}
@@ -0,0 +1,49 @@
+package crd
+
+import (
+	"context"
+
+	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+)
+
+// PoliciesFilter limits a policies source to specific policies
+type PoliciesFilter struct {
+	source domain.PoliciesSource
+	ids    map[string]struct{}
+}
+
+// NewPoliciesFilter returns a policies source that returns only the policies of the given ids from source
+func NewPoliciesFilter(source domain.PoliciesSource, ids []string) *PoliciesFilter {
+	filter := &PoliciesFilter{
+		source: source,
+		ids:    make(map[string]struct{}, len(ids)),
+	}
+	for _, id := range ids {
+		filter.ids[id] = struct{}{}
+	}
+	return filter
+}
+
+// GetAll returns the policies of the filter ids, implements github.com/weaveworks/policy-agent/pkg/policy-core/domain.PoliciesSource
+func (f *PoliciesFilter) GetAll(ctx context.Context) ([]domain.Policy, error) {
+	policies, err := f.source.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var filtered []domain.Policy
+	for i := range policies {
+		if _, ok := f.ids[policies[i].ID]; ok {
+			filtered = append(filtered, policies[i])
+		}
+	}
+	return filtered, nil
+}
+
+// GetPolicyConfig returns the policy config of the entity from the underlying source, implements github.com/weaveworks/policy-agent/pkg/policy-core/domain.PoliciesSource
+func (f *PoliciesFilter) GetPolicyConfig(ctx context.Context, entity domain.Entity) (*domain.PolicyConfig, error) {
+	return f.source.GetPolicyConfig(ctx, entity)
+}
+
+func (f *PoliciesFilter) getPolicyConfig(ctx context.Context, entity domain.Entity, namespaceLabels namespaceLabelsFunc) (*domain.PolicyConfig, error) {
+	return getSourcePolicyConfig(ctx, f.source, entity, namespaceLabels)
+}
@@ -0,0 +1,75 @@
+package crd
+
+import (
+	"context"
+	"strings"
+
+	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+	"github.com/weaveworks/policy-agent/pkg/policy-core/validation"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PoliciesMetadataFilter selects the entities targeted by at least one policy from their metadata,
+// implements github.com/weaveworks/policy-agent/internal/entities/k8s.MetadataFilter
+type PoliciesMetadataFilter struct {
+	source domain.PoliciesSource
+}
+
+// NewPoliciesMetadataFilter returns a metadata filter matching the targets of the source policies
+func NewPoliciesMetadataFilter(source domain.PoliciesSource) *PoliciesMetadataFilter {
+	return &PoliciesMetadataFilter{source: source}
+}
+
+// ForKind returns a function matching the entities of the kind targeted by a policy, nil when a policy targets all of them.
+// Namespace label targets are ignored as they are checked against the namespace of the retrieved entities,
+// and api versions and groups as the entities of the kind are retrieved from their preferred version
+func (f *PoliciesMetadataFilter) ForKind(ctx context.Context, kind string) (func(object metav1.Object) bool, error) {
+	policies, err := f.source.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var targeting []domain.Policy
+	for i := range policies {
+		policy := policies[i]
+		if !targetsKind(policy, kind) {
+			continue
+		}
+		policy.Targets.NamespaceLabels = nil
+		policy.Targets.Kinds = nil
+		policy.Targets.APIGroups = nil
+		targets := policy.Targets
+		if len(targets.Namespaces) == 0 && len(targets.Labels) == 0 && targets.LabelSelector == nil &&
+			len(targets.Names) == 0 && (targets.Scope == "" || targets.Scope == "*") {
+			return nil, nil
+		}
+		targeting = append(targeting, policy)
+	}
+
+	return func(object metav1.Object) bool {
+		entity := domain.Entity{
+			Kind:      kind,
+			Name:      object.GetName(),
+			Namespace: object.GetNamespace(),
+			Labels:    object.GetLabels(),
+		}
+		for i := range targeting {
+			if validation.MatchTargets(entity, nil, targeting[i]) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+func targetsKind(policy domain.Policy, kind string) bool {
+	if len(policy.Targets.Kinds) == 0 {
+		return true
+	}
+	for _, targetKind := range policy.Targets.Kinds {
+		if targetKind == kind || strings.HasSuffix(targetKind, "/"+kind) {
+			return true
+		}
+	}
+	return false
+}
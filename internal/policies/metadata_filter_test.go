@@ -0,0 +1,49 @@
+package crd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPoliciesMetadataFilter_ForKind(t *testing.T) {
+	source := &staticPoliciesSource{policies: []domain.Policy{
+		{ID: "pods", Targets: domain.PolicyTargets{Kinds: []string{"Pod"}}},
+		{ID: "prod-deployments", Targets: domain.PolicyTargets{Kinds: []string{"Deployment"}, Namespaces: []string{"prod"}}},
+		{ID: "web", Targets: domain.PolicyTargets{Labels: []map[string]string{{"app": "web"}}}},
+		{ID: "env", Targets: domain.PolicyTargets{Kinds: []string{"Service"}, NamespaceLabels: []map[string]string{{"env": "prod"}}}},
+		{ID: "workers", Targets: domain.PolicyTargets{Kinds: []string{"batch/v1/Job"}, APIGroups: []string{"batch"}, Names: []string{"*-worker"}}},
+	}}
+	filter := NewPoliciesMetadataFilter(source)
+	ctx := context.Background()
+
+	match, err := filter.ForKind(ctx, "Pod")
+	require.NoError(t, err)
+	assert.Nil(t, match, "all pods are targeted")
+
+	match, err = filter.ForKind(ctx, "Service")
+	require.NoError(t, err)
+	assert.Nil(t, match, "namespace labels are checked after retrieving the entities")
+
+	match, err = filter.ForKind(ctx, "Deployment")
+	require.NoError(t, err)
+	require.NotNil(t, match)
+	assert.True(t, match(&v1.ObjectMeta{Namespace: "prod", Name: "api"}))
+	assert.True(t, match(&v1.ObjectMeta{Namespace: "dev", Name: "web", Labels: map[string]string{"app": "web"}}))
+	assert.False(t, match(&v1.ObjectMeta{Namespace: "dev", Name: "api"}))
+
+	match, err = filter.ForKind(ctx, "Job")
+	require.NoError(t, err)
+	require.NotNil(t, match)
+	assert.True(t, match(&v1.ObjectMeta{Namespace: "dev", Name: "report-worker"}))
+	assert.False(t, match(&v1.ObjectMeta{Namespace: "dev", Name: "migration"}))
+
+	match, err = filter.ForKind(ctx, "ConfigMap")
+	require.NoError(t, err)
+	require.NotNil(t, match)
+	assert.False(t, match(&v1.ObjectMeta{Namespace: "prod", Name: "config"}))
+}
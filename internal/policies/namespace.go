@@ -0,0 +1,31 @@
+package crd
+
+import (
+	"context"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// GetNamespace returns the namespace object from the cache or nil if it does not exist,
+// implements github.com/weaveworks/policy-agent/pkg/policy-core/domain.NamespaceResolver
+func (p *PoliciesWatcher) GetNamespace(ctx context.Context, name string) (map[string]interface{}, error) {
+	var ns v1.Namespace
+	if err := p.cache.Get(ctx, client.ObjectKey{Name: name}, &ns); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get namespace %s: %w", name, err)
+	}
+	namespace, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&ns)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert namespace %s: %w", name, err)
+	}
+	// objects read from the cache have no type meta
+	namespace["apiVersion"] = "v1"
+	namespace["kind"] = "Namespace"
+	return namespace, nil
+}
@@ -0,0 +1,37 @@
+package crd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestGetNamespace(t *testing.T) {
+	schema := runtime.NewScheme()
+	corev1.AddToScheme(schema)
+
+	cache := NewFakeCache(schema, &corev1.Namespace{
+		ObjectMeta: v1.ObjectMeta{
+			Name:   "prod",
+			Labels: map[string]string{"env": "prod"},
+		},
+	})
+	watcher := PoliciesWatcher{cache: cache}
+
+	namespace, err := watcher.GetNamespace(context.Background(), "prod")
+	assert.NoError(t, err)
+	object := unstructured.Unstructured{Object: namespace}
+	assert.Equal(t, "Namespace", object.GetKind())
+	assert.Equal(t, "v1", object.GetAPIVersion())
+	assert.Equal(t, "prod", object.GetName())
+	assert.Equal(t, map[string]string{"env": "prod"}, object.GetLabels())
+
+	namespace, err = watcher.GetNamespace(context.Background(), "missing")
+	assert.NoError(t, err)
+	assert.Nil(t, namespace)
+}
@@ -0,0 +1,171 @@
+package crd
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/weaveworks/policy-agent/internal/entities/filesystem"
+)
+
+const (
+	ociLayoutFile = "oci-layout"
+	ociIndexFile  = "index.json"
+	// ociTitleAnnotation is the file name of a layer that is not an archive
+	ociTitleAnnotation = "org.opencontainers.image.title"
+)
+
+// ociDescriptor references a blob of the image layout
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// ociManifest is an image index or an image manifest, an index lists manifests and a manifest lists layers
+type ociManifest struct {
+	Manifests []ociDescriptor `json:"manifests"`
+	Layers    []ociDescriptor `json:"layers"`
+}
+
+// isOCILayout checks if the directory is an OCI image layout
+func isOCILayout(root string) bool {
+	info, err := os.Stat(filepath.Join(root, ociLayoutFile))
+	return err == nil && !info.IsDir()
+}
+
+// loadOCILayout returns the manifests of the layers of the images of the layout index, archive layers are expanded to
+// their manifest files and yaml or json layers are decoded as a file named after their title annotation
+func loadOCILayout(root string) ([]filesystem.Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(root, ociIndexFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read oci layout %s: %w", root, err)
+	}
+	index := ociManifest{}
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("failed to decode oci layout index %s: %w", root, err)
+	}
+	manifests, err := loadOCIManifests(root, index.Manifests)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load oci layout %s: %w", root, err)
+	}
+	return manifests, nil
+}
+
+// loadOCIManifests returns the manifests of the layers of the images, nested indexes are followed
+func loadOCIManifests(root string, descriptors []ociDescriptor) ([]filesystem.Manifest, error) {
+	var manifests []filesystem.Manifest
+	for _, descriptor := range descriptors {
+		data, err := readOCIBlob(root, descriptor.Digest)
+		if err != nil {
+			return nil, err
+		}
+		manifest := ociManifest{}
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return nil, fmt.Errorf("failed to decode oci manifest %s: %w", descriptor.Digest, err)
+		}
+		nested, err := loadOCIManifests(root, manifest.Manifests)
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, nested...)
+		for _, layer := range manifest.Layers {
+			layerManifests, err := loadOCILayer(root, layer)
+			if err != nil {
+				return nil, err
+			}
+			manifests = append(manifests, layerManifests...)
+		}
+	}
+	return manifests, nil
+}
+
+// loadOCILayer returns the manifests of a layer, layers that are neither archives nor yaml or json files are skipped
+func loadOCILayer(root string, layer ociDescriptor) ([]filesystem.Manifest, error) {
+	mediaType := strings.ToLower(layer.MediaType)
+	switch {
+	case strings.Contains(mediaType, "tar"):
+		data, err := readOCIBlob(root, layer.Digest)
+		if err != nil {
+			return nil, err
+		}
+		return readArchiveManifests(data, layer.Digest)
+	case strings.HasSuffix(mediaType, "yaml") || strings.HasSuffix(mediaType, "json"):
+		data, err := readOCIBlob(root, layer.Digest)
+		if err != nil {
+			return nil, err
+		}
+		name := layer.Annotations[ociTitleAnnotation]
+		if name == "" {
+			name = layer.Digest
+		}
+		return filesystem.DecodeManifests(bytes.NewReader(data), name)
+	}
+	return nil, nil
+}
+
+// readArchiveManifests returns the manifests of the files of a tar archive, compressed or not
+func readArchiveManifests(data []byte, digest string) ([]filesystem.Manifest, error) {
+	buffered := bufio.NewReader(bytes.NewReader(data))
+	var reader io.Reader = buffered
+	// layers are usually gzip compressed whatever their media type
+	if magic, err := buffered.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gzipReader, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress oci layer %s: %w", digest, err)
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	}
+
+	var manifests []filesystem.Manifest
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			return manifests, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read oci layer %s: %w", digest, err)
+		}
+		name := strings.TrimPrefix(path.Clean("/"+header.Name), "/")
+		if header.Typeflag != tar.TypeReg || filesystem.IsHiddenPath(name) || !filesystem.IsManifestFile(name) {
+			continue
+		}
+		fileManifests, err := filesystem.DecodeManifests(tarReader, name)
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, fileManifests...)
+	}
+}
+
+// readOCIBlob reads the blob of the digest and verifies its content for sha256 digests
+func readOCIBlob(root, digest string) ([]byte, error) {
+	algorithm, encoded, ok := strings.Cut(digest, ":")
+	if !ok || algorithm == "" || encoded == "" || strings.ContainsAny(digest, "/\\") || strings.Contains(digest, "..") {
+		return nil, fmt.Errorf("invalid oci digest %q", digest)
+	}
+	data, err := os.ReadFile(filepath.Join(root, "blobs", algorithm, encoded))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read oci blob %s: %w", digest, err)
+	}
+	if algorithm == "sha256" {
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != encoded {
+			return nil, fmt.Errorf("oci blob %s does not match its digest", digest)
+		}
+	}
+	return data, nil
+}
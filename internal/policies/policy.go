@@ -4,11 +4,16 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sync"
 
 	pacv2 "github.com/weaveworks/policy-agent/api/v2beta3"
 	"github.com/weaveworks/policy-agent/pkg/logger"
 	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+	"github.com/weaveworks/policy-agent/pkg/policy-core/validation"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	ctrlCache "sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -17,17 +22,36 @@ import (
 type PoliciesWatcher struct {
 	cache    ctrlCache.Cache
 	Provider string
+	// Mode is the policy set mode selecting the policies, policy sets are ignored when empty
+	Mode string
+
+	selectorsLock sync.Mutex
+	// selectors are the parsed label selectors of the policy configs by uid
+	selectors map[types.UID]policyConfigSelectors
+
+	evaluatorsLock sync.Mutex
+	// evaluators are the compiled namespace policies by uid
+	evaluators map[types.UID]namespacePolicyEvaluator
 }
 
-// NewPoliciesWatcher returns a policies source that fetches them from Kubernetes API
-func NewPoliciesWatcher(ctx context.Context, mgr ctrl.Manager, provider string) (*PoliciesWatcher, error) {
+// namespacePolicyEvaluator is the namespace policy compiled at the generation
+type namespacePolicyEvaluator struct {
+	generation int64
+	evaluator  domain.PolicyEvaluator
+}
+
+// NewPoliciesWatcher returns a policies source that fetches them from Kubernetes API,
+// the policies are limited to the ones selected by the policy sets of the mode if any
+func NewPoliciesWatcher(ctx context.Context, mgr ctrl.Manager, provider, mode string) (*PoliciesWatcher, error) {
 	return &PoliciesWatcher{
 		cache:    mgr.GetCache(),
 		Provider: provider,
+		Mode:     mode,
 	}, nil
 }
 
-// GetAll returns all policies, implements github.com/weaveworks/policy-agent/pkg/policy-core/domain.PoliciesSource
+// GetAll returns the policies of the provider enabled in the mode and selected by its policy sets, or all of them when the mode has no policy sets,
+// implements github.com/weaveworks/policy-agent/pkg/policy-core/domain.PoliciesSource
 func (p *PoliciesWatcher) GetAll(ctx context.Context) ([]domain.Policy, error) {
 	policiesCRD := &pacv2.PolicyList{}
 	err := p.cache.List(ctx, policiesCRD, &client.ListOptions{})
@@ -37,74 +61,238 @@ func (p *PoliciesWatcher) GetAll(ctx context.Context) ([]domain.Policy, error) {
 
 	logger.Debugw("retrieved CRD policies from cache", "count", len(policiesCRD.Items))
 
+	policySets, err := p.getPolicySets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	var policies []domain.Policy
 	for i := range policiesCRD.Items {
-		if !p.match(policiesCRD.Items[i]) {
+		if !p.match(policiesCRD.Items[i]) || !matchPolicySets(policySets, policiesCRD.Items[i]) {
 			continue
 		}
 
-		policyCRD := policiesCRD.Items[i].Spec
-		policy := domain.Policy{
-			Name:    policyCRD.Name,
-			ID:      policyCRD.ID,
-			Code:    policyCRD.Code,
-			Enforce: policyCRD.Enforce,
-			Targets: domain.PolicyTargets{
-				Kinds:      policyCRD.Targets.Kinds,
-				Labels:     policyCRD.Targets.Labels,
-				Namespaces: policyCRD.Targets.Namespaces,
-			},
-			Description: policyCRD.Description,
-			HowToSolve:  policyCRD.HowToSolve,
-			Category:    policyCRD.Category,
-			Tags:        policyCRD.Tags,
-			Severity:    policyCRD.Severity,
-			Reference: v1.ObjectReference{
-				APIVersion:      policiesCRD.Items[i].APIVersion,
-				Kind:            policiesCRD.Items[i].Kind,
-				UID:             policiesCRD.Items[i].UID,
-				Name:            policiesCRD.Items[i].Name,
-				Namespace:       policiesCRD.Items[i].Namespace,
-				ResourceVersion: policiesCRD.Items[i].ResourceVersion,
-			},
-			Mutate: policyCRD.Mutate,
-			Exclude: domain.PolicyExclusions{
-				Namespaces: policyCRD.Exclude.Namespaces,
-				Resources:  policyCRD.Exclude.Resources,
-				Labels:     policyCRD.Exclude.Labels,
-			},
-		}
+		policies = append(policies, toDomainPolicy(policiesCRD.Items[i]))
+	}
 
-		for _, standardCRD := range policyCRD.Standards {
-			standard := domain.PolicyStandard{
-				ID:       standardCRD.ID,
-				Controls: standardCRD.Controls,
-			}
-			policy.Standards = append(policy.Standards, standard)
+	if p.Provider != pacv2.PolicyKubernetesProvider {
+		return policies, nil
+	}
+	namespacePolicies, err := p.getNamespacePolicies(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return append(policies, namespacePolicies...), nil
+}
+
+// getNamespacePolicies returns the kubernetes namespace policies enabled in the mode
+func (p *PoliciesWatcher) getNamespacePolicies(ctx context.Context) ([]domain.Policy, error) {
+	namespacePoliciesCRD := &pacv2.NamespacePolicyList{}
+	err := p.cache.List(ctx, namespacePoliciesCRD, &client.ListOptions{})
+	if err != nil {
+		if meta.IsNoMatchError(err) {
+			logger.Debugw("namespace policies resource is not installed")
+			return nil, nil
 		}
+		return nil, fmt.Errorf("error while retrieving namespace policies CRD from cache: %w", err)
+	}
+	namespacePolicies := namespacePoliciesCRD.Items
+	return toNamespaceDomainPolicies(namespacePolicies, p.namespaceEvaluators(ctx, namespacePolicies), p.Mode), nil
+}
 
-		for k := range policyCRD.Parameters {
-			paramCRD := policyCRD.Parameters[k]
-			param := domain.PolicyParameters{
-				Name:     paramCRD.Name,
-				Type:     paramCRD.Type,
-				Required: paramCRD.Required,
-			}
-			if paramCRD.Value != nil {
-				err = json.Unmarshal(paramCRD.Value.Raw, &param.Value)
-				if err != nil {
-					logger.Errorw("failed to load policy parameter value", "error", err)
-				}
-			}
-			policy.Parameters = append(policy.Parameters, param)
+// namespaceEvaluators returns the compiled namespace policies, they are compiled again only when the policy generation changes
+// and the evaluators of the deleted policies are dropped
+func (p *PoliciesWatcher) namespaceEvaluators(ctx context.Context, namespacePolicies []pacv2.NamespacePolicy) []domain.PolicyEvaluator {
+	p.evaluatorsLock.Lock()
+	defer p.evaluatorsLock.Unlock()
+	if p.evaluators == nil || len(p.evaluators) > len(namespacePolicies) {
+		p.evaluators = make(map[types.UID]namespacePolicyEvaluator, len(namespacePolicies))
+	}
+	result := make([]domain.PolicyEvaluator, len(namespacePolicies))
+	for i := range namespacePolicies {
+		uid := namespacePolicies[i].UID
+		if cached, ok := p.evaluators[uid]; ok && uid != "" && cached.generation == namespacePolicies[i].Generation {
+			result[i] = cached.evaluator
+			continue
+		}
+		result[i] = prepareNamespacePolicy(ctx, namespacePolicies[i])
+		if uid != "" {
+			p.evaluators[uid] = namespacePolicyEvaluator{generation: namespacePolicies[i].Generation, evaluator: result[i]}
 		}
+	}
+	return result
+}
 
+// prepareNamespacePolicy compiles the namespace policy code, nil is returned when the code does not compile and the
+// compile error is then reported by each validation
+func prepareNamespacePolicy(ctx context.Context, namespacePolicy pacv2.NamespacePolicy) domain.PolicyEvaluator {
+	evaluator, err := validation.PrepareSandboxed(ctx, namespacePolicy.Spec.Code)
+	if err != nil {
+		logger.Warnw("failed to compile namespace policy", "policy", namespacePolicy.Name, "namespace", namespacePolicy.Namespace, "error", err)
+		return nil
+	}
+	return evaluator
+}
+
+// toNamespaceDomainPolicies returns the kubernetes namespace policies enabled in the mode targeting only the entities of their namespace,
+// evaluators holds the compiled policy of each namespace policy
+func toNamespaceDomainPolicies(namespacePolicies []pacv2.NamespacePolicy, evaluators []domain.PolicyEvaluator, mode string) []domain.Policy {
+	var policies []domain.Policy
+	for i := range namespacePolicies {
+		namespacePolicy := namespacePolicies[i]
+		if namespacePolicy.Spec.Provider != pacv2.PolicyKubernetesProvider || !namespacePolicy.Spec.EnabledIn(mode) {
+			continue
+		}
+		policy := toNamespaceDomainPolicy(namespacePolicy)
+		policy.Evaluator = evaluators[i]
 		policies = append(policies, policy)
 	}
-	return policies, nil
+	return policies
+}
+
+// toNamespaceDomainPolicy converts the namespace policy to a policy targeting only the entities of its namespace,
+// namespace policies can only report violations and do not mutate entities. The id is qualified with the namespace
+// so that it can not replace a cluster policy or the policy of another namespace, and the policy is evaluated in a sandbox
+// as it is written by the tenants of the namespace
+func toNamespaceDomainPolicy(namespacePolicy pacv2.NamespacePolicy) domain.Policy {
+	policy := toDomainPolicy(pacv2.Policy{
+		// objects read from the cache have no type meta
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: pacv2.GroupVersion.Identifier(),
+			Kind:       pacv2.NamespacePolicyKind,
+		},
+		ObjectMeta: namespacePolicy.ObjectMeta,
+		Spec:       namespacePolicy.Spec,
+	})
+	policy.ID = namespacePolicyID(namespacePolicy.Namespace, namespacePolicy.Spec.ID)
+	policy.Targets.Namespaces = []string{namespacePolicy.Namespace}
+	policy.Mutate = false
+	policy.Sandboxed = true
+	return policy
+}
+
+// namespacePolicyID returns the id of the policy validations of a namespace policy with the id in the namespace
+func namespacePolicyID(namespace, id string) string {
+	return namespace + "/" + id
+}
+
+// toDomainPolicy converts the policy resource to the policy validated by the agent
+func toDomainPolicy(policyItem pacv2.Policy) domain.Policy {
+	policyCRD := policyItem.Spec
+	policy := domain.Policy{
+		Name:    policyCRD.Name,
+		ID:      policyCRD.ID,
+		Code:    policyCRD.Code,
+		Enforce: policyCRD.Enforce,
+		Targets: domain.PolicyTargets{
+			Kinds:           policyCRD.Targets.Kinds,
+			Labels:          policyCRD.Targets.Labels,
+			Namespaces:      policyCRD.Targets.Namespaces,
+			NamespaceLabels: policyCRD.Targets.NamespaceLabels,
+			LabelSelector:   policyCRD.Targets.LabelSelector,
+			APIGroups:       policyCRD.Targets.APIGroups,
+			Names:           policyCRD.Targets.Names,
+			Scope:           policyCRD.Targets.Scope,
+		},
+		Description: policyCRD.Description,
+		HowToSolve:  policyCRD.HowToSolve,
+		Category:    policyCRD.Category,
+		Tags:        policyCRD.Tags,
+		Severity:    policyCRD.Severity,
+		Reference: v1.ObjectReference{
+			APIVersion:      policyItem.APIVersion,
+			Kind:            policyItem.Kind,
+			UID:             policyItem.UID,
+			Name:            policyItem.Name,
+			Namespace:       policyItem.Namespace,
+			ResourceVersion: policyItem.ResourceVersion,
+		},
+		Mutate: policyCRD.MutationEnabled(),
+		Exclude: domain.PolicyExclusions{
+			Namespaces: policyCRD.Exclude.Namespaces,
+			Resources:  policyCRD.Exclude.Resources,
+			Labels:     policyCRD.Exclude.Labels,
+		},
+	}
+
+	// the label selector is parsed once for all the entities matched against the policy
+	if policyCRD.Targets.LabelSelector != nil {
+		policy.Targets.ParsedLabelSelector = validation.ParseLabelSelector(policyCRD.Targets.LabelSelector)
+	}
+
+	for _, entryCRD := range policyCRD.Exclude.Entries {
+		entry := domain.PolicyExclusionEntry{
+			Kind:      entryCRD.Kind,
+			Namespace: entryCRD.Namespace,
+			Name:      entryCRD.Name,
+		}
+		if entryCRD.ExpiresAt != nil {
+			expiresAt := entryCRD.ExpiresAt.Time
+			entry.ExpiresAt = &expiresAt
+		}
+		policy.Exclude.Entries = append(policy.Exclude.Entries, entry)
+	}
+	// the regular expressions of the names and exclusions are compiled once for all the entities as well
+	policy.ParsedPatterns = validation.ParsePatterns(policy)
+
+	for _, standardCRD := range policyCRD.Standards {
+		standard := domain.PolicyStandard{
+			ID:       standardCRD.ID,
+			Controls: standardCRD.Controls,
+		}
+		policy.Standards = append(policy.Standards, standard)
+	}
+
+	for k := range policyCRD.Parameters {
+		paramCRD := policyCRD.Parameters[k]
+		param := domain.PolicyParameters{
+			Name:     paramCRD.Name,
+			Type:     paramCRD.Type,
+			Required: paramCRD.Required,
+		}
+		if paramCRD.Value != nil {
+			if err := json.Unmarshal(paramCRD.Value.Raw, &param.Value); err != nil {
+				logger.Errorw("failed to load policy parameter value", "error", err)
+			}
+		}
+		policy.Parameters = append(policy.Parameters, param)
+	}
+	return policy
 }
 
 func (p *PoliciesWatcher) match(policy pacv2.Policy) bool {
-	// check provider
-	return policy.Spec.Provider == p.Provider
+	// check provider and suspension
+	return policy.Spec.Provider == p.Provider && policy.Spec.EnabledIn(p.Mode)
+}
+
+// getPolicySets returns the policy sets of the watcher mode
+func (p *PoliciesWatcher) getPolicySets(ctx context.Context) ([]pacv2.PolicySet, error) {
+	if p.Mode == "" {
+		return nil, nil
+	}
+	policySetsCRD := &pacv2.PolicySetList{}
+	err := p.cache.List(ctx, policySetsCRD, &client.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error while retrieving policy sets CRD from cache: %w", err)
+	}
+	var policySets []pacv2.PolicySet
+	for i := range policySetsCRD.Items {
+		if policySetsCRD.Items[i].Spec.Mode == p.Mode {
+			policySets = append(policySets, policySetsCRD.Items[i])
+		}
+	}
+	return policySets, nil
+}
+
+// matchPolicySets checks if any of the policy sets selects the policy, all policies match when there are no policy sets
+func matchPolicySets(policySets []pacv2.PolicySet, policy pacv2.Policy) bool {
+	if len(policySets) == 0 {
+		return true
+	}
+	for i := range policySets {
+		if policySets[i].Match(policy) {
+			return true
+		}
+	}
+	return false
 }
@@ -174,3 +174,199 @@ func TestGetPolicies(t *testing.T) {
 		assert.Equal(t, ids, cases[i].expectedPolicies, fmt.Sprintf("testcase: #%d", i))
 	}
 }
+
+// newTestPolicy returns a kubernetes policy named and identified by name with the spec fields
+func newTestPolicy(name string, spec pacv2.PolicySpec) *pacv2.Policy {
+	spec.ID = name
+	if spec.Provider == "" {
+		spec.Provider = pacv2.PolicyKubernetesProvider
+	}
+	return &pacv2.Policy{ObjectMeta: v1.ObjectMeta{Name: name}, Spec: spec}
+}
+
+// newTestNamespacePolicy returns a namespace policy of the namespace, a kubernetes policy unless the spec sets a provider
+func newTestNamespacePolicy(name, namespace string, spec pacv2.PolicySpec) *pacv2.NamespacePolicy {
+	if spec.ID == "" {
+		spec.ID = name
+	}
+	if spec.Provider == "" {
+		spec.Provider = pacv2.PolicyKubernetesProvider
+	}
+	return &pacv2.NamespacePolicy{ObjectMeta: v1.ObjectMeta{Name: name, Namespace: namespace}, Spec: spec}
+}
+
+func TestGetPoliciesWithPolicySets(t *testing.T) {
+	newPolicySet := func(name, mode string, filters pacv2.PolicySetFilters) runtime.Object {
+		return &pacv2.PolicySet{
+			ObjectMeta: v1.ObjectMeta{Name: name},
+			Spec:       pacv2.PolicySetSpec{Mode: mode, Filters: filters},
+		}
+	}
+	objects := []runtime.Object{
+		newTestPolicy("policy-1", pacv2.PolicySpec{Category: "security"}),
+		newTestPolicy("policy-2", pacv2.PolicySpec{Category: "reliability", Tags: []string{"prod"}}),
+		newTestPolicy("policy-3", pacv2.PolicySpec{Category: "cost"}),
+		newPolicySet("audit-security", pacv2.PolicySetAuditMode, pacv2.PolicySetFilters{Categories: []string{"security"}}),
+		newPolicySet("audit-cost", pacv2.PolicySetAuditMode, pacv2.PolicySetFilters{IDs: []string{"policy-3"}}),
+		newPolicySet("admission-prod", pacv2.PolicySetAdmissionMode, pacv2.PolicySetFilters{Tags: []string{"prod"}}),
+	}
+
+	cases := []struct {
+		name             string
+		mode             string
+		expectedPolicies []string
+	}{
+		{
+			name:             "policies of any audit policy set",
+			mode:             pacv2.PolicySetAuditMode,
+			expectedPolicies: []string{"policy-1", "policy-3"},
+		},
+		{
+			name:             "policies of the admission policy set",
+			mode:             pacv2.PolicySetAdmissionMode,
+			expectedPolicies: []string{"policy-2"},
+		},
+		{
+			name:             "all policies when the mode has no policy sets",
+			mode:             pacv2.PolicySetTFAdmissionMode,
+			expectedPolicies: []string{"policy-1", "policy-2", "policy-3"},
+		},
+		{
+			name:             "all policies without mode",
+			expectedPolicies: []string{"policy-1", "policy-2", "policy-3"},
+		},
+	}
+
+	schema := runtime.NewScheme()
+	pacv2.AddToScheme(schema)
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			watcher := PoliciesWatcher{
+				cache:    NewFakeCache(schema, objects...),
+				Provider: pacv2.PolicyKubernetesProvider,
+				Mode:     c.mode,
+			}
+			policies, err := watcher.GetAll(context.Background())
+			assert.NoError(t, err)
+
+			var ids []string
+			for _, policy := range policies {
+				ids = append(ids, policy.ID)
+			}
+			assert.Equal(t, c.expectedPolicies, ids)
+		})
+	}
+}
+
+func TestGetPoliciesSuspended(t *testing.T) {
+	disabled := false
+	objects := []runtime.Object{
+		newTestPolicy("active", pacv2.PolicySpec{Mutate: true}),
+		newTestPolicy("suspended", pacv2.PolicySpec{Mutate: true, Suspend: true}),
+		newTestPolicy("no-audit", pacv2.PolicySpec{Mutate: true, Modes: pacv2.PolicyModes{Audit: &disabled}}),
+		newTestPolicy("no-mutation", pacv2.PolicySpec{Mutate: true, Modes: pacv2.PolicyModes{Mutation: &disabled}}),
+		newTestNamespacePolicy("tenant-policy", "team-a", pacv2.PolicySpec{Modes: pacv2.PolicyModes{Admission: &disabled}}),
+	}
+
+	cases := []struct {
+		name             string
+		mode             string
+		expectedPolicies []string
+		mutatedPolicies  []string
+	}{
+		{
+			name:             "audit",
+			mode:             pacv2.PolicySetAuditMode,
+			expectedPolicies: []string{"active", "no-mutation", "team-a/tenant-policy"},
+			mutatedPolicies:  []string{"active"},
+		},
+		{
+			name:             "admission",
+			mode:             pacv2.PolicySetAdmissionMode,
+			expectedPolicies: []string{"active", "no-audit", "no-mutation"},
+			mutatedPolicies:  []string{"active", "no-audit"},
+		},
+		{
+			name:             "without mode",
+			expectedPolicies: []string{"active", "no-audit", "no-mutation", "team-a/tenant-policy"},
+			mutatedPolicies:  []string{"active", "no-audit"},
+		},
+	}
+
+	schema := runtime.NewScheme()
+	pacv2.AddToScheme(schema)
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			watcher := PoliciesWatcher{
+				cache:    NewFakeCache(schema, objects...),
+				Provider: pacv2.PolicyKubernetesProvider,
+				Mode:     c.mode,
+			}
+			policies, err := watcher.GetAll(context.Background())
+			assert.NoError(t, err)
+
+			var ids, mutated []string
+			for _, policy := range policies {
+				ids = append(ids, policy.ID)
+				if policy.Mutate {
+					mutated = append(mutated, policy.ID)
+				}
+			}
+			assert.Equal(t, c.expectedPolicies, ids)
+			assert.Equal(t, c.mutatedPolicies, mutated)
+		})
+	}
+}
+
+func TestGetPoliciesWithNamespacePolicies(t *testing.T) {
+	// namespace policies target only their namespace and do not mutate entities
+	targets := pacv2.PolicyTargets{Kinds: []string{"Deployment"}, Namespaces: []string{"kube-system"}}
+	tenantPolicy := newTestNamespacePolicy("tenant-policy", "team-a", pacv2.PolicySpec{
+		Mutate:  true,
+		Targets: targets,
+		Exclude: pacv2.PolicyExclusions{Resources: []string{"team-a/regex:legacy-.+"}},
+		Code:    "package tenant\nviolation[result] { result = {\"msg\": \"violation\"} }",
+	})
+	tenantPolicy.UID = "tenant-policy-uid"
+	objects := []runtime.Object{
+		newTestPolicy("policy-1", pacv2.PolicySpec{}),
+		tenantPolicy,
+		newTestNamespacePolicy("shadow", "team-a", pacv2.PolicySpec{ID: "policy-1", Targets: targets}),
+		newTestNamespacePolicy("terraform", "team-a", pacv2.PolicySpec{Provider: pacv2.PolicyTerraformProvider}),
+	}
+
+	schema := runtime.NewScheme()
+	pacv2.AddToScheme(schema)
+	watcher := PoliciesWatcher{
+		cache:    NewFakeCache(schema, objects...),
+		Provider: pacv2.PolicyKubernetesProvider,
+	}
+	policies, err := watcher.GetAll(context.Background())
+	assert.NoError(t, err)
+	// the ids of namespace policies are qualified with their namespace so they can not replace a cluster policy
+	if assert.Len(t, policies, 3) {
+		assert.Equal(t, "policy-1", policies[0].ID)
+		assert.False(t, policies[0].Sandboxed)
+		assert.Equal(t, "team-a/policy-1", policies[1].ID)
+		assert.Equal(t, "team-a/tenant-policy", policies[2].ID)
+		assert.Equal(t, []string{"team-a"}, policies[2].Targets.Namespaces)
+		assert.False(t, policies[2].Mutate)
+		assert.True(t, policies[2].Sandboxed)
+		reference := policies[2].Reference.(corev1.ObjectReference)
+		assert.Equal(t, pacv2.NamespacePolicyKind, reference.Kind)
+		assert.Equal(t, "team-a", reference.Namespace)
+		assert.Nil(t, policies[1].Evaluator, "namespace policies that do not compile are not prepared")
+		assert.NotNil(t, policies[2].Evaluator)
+		assert.Contains(t, policies[2].ParsedPatterns, "regex:legacy-.+")
+
+		// namespace policies are compiled again only when they change
+		policies, err = watcher.GetAll(context.Background())
+		assert.NoError(t, err)
+		assert.Same(t, watcher.evaluators["tenant-policy-uid"].evaluator, policies[2].Evaluator)
+	}
+
+	watcher.Provider = pacv2.PolicyTerraformProvider
+	policies, err = watcher.GetAll(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, policies)
+}
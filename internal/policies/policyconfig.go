@@ -4,12 +4,16 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
 
 	pacv2 "github.com/weaveworks/policy-agent/api/v2beta3"
 	"github.com/weaveworks/policy-agent/internal/utils"
 	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+	"github.com/weaveworks/policy-agent/pkg/policy-core/validation"
 	v1 "k8s.io/api/core/v1"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -17,26 +21,95 @@ const (
 	tenantLabel = "toolkit.fluxcd.io/tenant"
 )
 
+// GetPolicyConfig returns the merged policy configs targeting the entity, implements github.com/weaveworks/policy-agent/pkg/policy-core/domain.PoliciesSource
 func (p *PoliciesWatcher) GetPolicyConfig(ctx context.Context, entity domain.Entity) (*domain.PolicyConfig, error) {
+	return p.getPolicyConfig(ctx, entity, p.namespaceLabels)
+}
+
+func (p *PoliciesWatcher) getPolicyConfig(ctx context.Context, entity domain.Entity, namespaceLabels namespaceLabelsFunc) (*domain.PolicyConfig, error) {
 	configs := pacv2.PolicyConfigList{}
 	err := p.cache.List(ctx, &configs)
 	if err != nil {
 		return nil, err
 	}
 
-	var workspaces, namespaces, apps, appsWithNamespace, resources, resourcesWithNamespace []pacv2.PolicyConfig
+	var labels map[string]string
+	if entity.Namespace != "" {
+		labels, err = namespaceLabels(ctx, entity.Namespace)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	var entityWorkspace string
+	return matchPolicyConfigs(configs.Items, p.configSelectors(configs.Items), entity, labels)
+}
 
-	if entity.Namespace != "" {
-		var ns v1.Namespace
-		if err := p.cache.Get(ctx, client.ObjectKey{Name: entity.Namespace}, &ns); err != nil {
-			return nil, fmt.Errorf("failed to get entity namespace: %w", err)
+// policyConfigSelectors are the parsed label selectors of a policy config, a nil selector is not a target of the config
+type policyConfigSelectors struct {
+	generation int64
+	namespace  labels.Selector
+	object     labels.Selector
+}
+
+// parseConfigSelectors parses the label selectors of the policy config, invalid selectors match nothing
+func parseConfigSelectors(config pacv2.PolicyConfig) policyConfigSelectors {
+	selectors := policyConfigSelectors{generation: config.Generation}
+	if config.Spec.Match.NamespaceSelector != nil {
+		selectors.namespace = validation.ParseLabelSelector(config.Spec.Match.NamespaceSelector)
+	}
+	if config.Spec.Match.ObjectSelector != nil {
+		selectors.object = validation.ParseLabelSelector(config.Spec.Match.ObjectSelector)
+	}
+	return selectors
+}
+
+// configSelectors returns the label selectors of the policy configs, they are parsed again only when the config generation changes
+// and the selectors of the deleted configs are dropped
+func (p *PoliciesWatcher) configSelectors(configs []pacv2.PolicyConfig) []policyConfigSelectors {
+	p.selectorsLock.Lock()
+	defer p.selectorsLock.Unlock()
+	if p.selectors == nil || len(p.selectors) > len(configs) {
+		p.selectors = make(map[types.UID]policyConfigSelectors, len(configs))
+	}
+	result := make([]policyConfigSelectors, len(configs))
+	for i := range configs {
+		uid := configs[i].UID
+		if selectors, ok := p.selectors[uid]; ok && uid != "" && selectors.generation == configs[i].Generation {
+			result[i] = selectors
+			continue
+		}
+		result[i] = parseConfigSelectors(configs[i])
+		if uid != "" {
+			p.selectors[uid] = result[i]
 		}
-		entityWorkspace = ns.GetLabels()[tenantLabel]
 	}
+	return result
+}
 
-	for _, config := range configs.Items {
+// namespaceLabels returns the labels of the namespace from the cache
+func (p *PoliciesWatcher) namespaceLabels(ctx context.Context, name string) (map[string]string, error) {
+	var ns v1.Namespace
+	if err := p.cache.Get(ctx, client.ObjectKey{Name: name}, &ns); err != nil {
+		return nil, fmt.Errorf("failed to get entity namespace: %w", err)
+	}
+	// namespaces without labels are still matched by namespace selectors
+	labels := map[string]string{}
+	for key, value := range ns.GetLabels() {
+		labels[key] = value
+	}
+	return labels, nil
+}
+
+// matchPolicyConfigs merges the policy configs targeting the entity, configs with more specific targets override the others,
+// from the least to the most specific: workspaces, namespace selectors, namespaces, object selectors, apps and resources.
+// Configs of the same selector target override the configs whose selector has less requirements, then the configs
+// with the same number of requirements are merged by name. Namespace selectors match only when the namespace labels are known
+func matchPolicyConfigs(configs []pacv2.PolicyConfig, selectors []policyConfigSelectors, entity domain.Entity, namespaceLabels map[string]string) (*domain.PolicyConfig, error) {
+	var workspaces, namespaces, apps, appsWithNamespace, resources, resourcesWithNamespace []pacv2.PolicyConfig
+	var namespaceSelectors, objectSelectors []selectorMatch
+
+	entityWorkspace := namespaceLabels[tenantLabel]
+	for i, config := range configs {
 		if entityWorkspace != "" {
 			for _, workspace := range config.Spec.Match.Workspaces {
 				if workspace == entityWorkspace {
@@ -46,6 +119,10 @@ func (p *PoliciesWatcher) GetPolicyConfig(ctx context.Context, entity domain.Ent
 			}
 		}
 
+		if selector := selectors[i].namespace; selector != nil && namespaceLabels != nil && selector.Matches(labels.Set(namespaceLabels)) {
+			namespaceSelectors = append(namespaceSelectors, newSelectorMatch(config, selector))
+		}
+
 		for _, namespace := range config.Spec.Match.Namespaces {
 			if namespace == entity.Namespace {
 				namespaces = append(namespaces, config)
@@ -53,6 +130,10 @@ func (p *PoliciesWatcher) GetPolicyConfig(ctx context.Context, entity domain.Ent
 			}
 		}
 
+		if selector := selectors[i].object; selector != nil && selector.Matches(labels.Set(entity.Labels)) {
+			objectSelectors = append(objectSelectors, newSelectorMatch(config, selector))
+		}
+
 		if fluxApp := utils.GetFluxObject(entity.Labels); fluxApp != nil {
 			for _, app := range config.Spec.Match.Applications {
 				if app.Name == fluxApp.GetName() && app.Kind == fluxApp.GetKind() {
@@ -83,7 +164,9 @@ func (p *PoliciesWatcher) GetPolicyConfig(ctx context.Context, entity domain.Ent
 
 	allConfigs := []pacv2.PolicyConfig{}
 	allConfigs = append(allConfigs, workspaces...)
+	allConfigs = append(allConfigs, sortBySelector(namespaceSelectors)...)
 	allConfigs = append(allConfigs, namespaces...)
+	allConfigs = append(allConfigs, sortBySelector(objectSelectors)...)
 	allConfigs = append(allConfigs, apps...)
 	allConfigs = append(allConfigs, appsWithNamespace...)
 	allConfigs = append(allConfigs, resources...)
@@ -92,6 +175,33 @@ func (p *PoliciesWatcher) GetPolicyConfig(ctx context.Context, entity domain.Ent
 	return override(allConfigs)
 }
 
+// selectorMatch is a policy config whose label selector matches the entity
+type selectorMatch struct {
+	config       pacv2.PolicyConfig
+	requirements int
+}
+
+func newSelectorMatch(config pacv2.PolicyConfig, selector labels.Selector) selectorMatch {
+	requirements, _ := selector.Requirements()
+	return selectorMatch{config: config, requirements: len(requirements)}
+}
+
+// sortBySelector returns the policy configs from the least to the most requirements of their selector
+// and by name for the same number of requirements, so that the more specific selectors override the others
+func sortBySelector(matches []selectorMatch) []pacv2.PolicyConfig {
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].requirements != matches[j].requirements {
+			return matches[i].requirements < matches[j].requirements
+		}
+		return matches[i].config.GetName() < matches[j].config.GetName()
+	})
+	configs := make([]pacv2.PolicyConfig, len(matches))
+	for i := range matches {
+		configs[i] = matches[i].config
+	}
+	return configs
+}
+
 func override(configs []pacv2.PolicyConfig) (*domain.PolicyConfig, error) {
 	configCRD := pacv2.PolicyConfig{
 		Spec: pacv2.PolicyConfigSpec{
@@ -8,7 +8,9 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 
 	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
 
@@ -346,3 +348,122 @@ func TestGetPolicyConfig(t *testing.T) {
 	}
 
 }
+
+// newTestPolicyConfig returns a policy config of policy-1 with the match and the raw json parameters
+func newTestPolicyConfig(name string, match pacv2.PolicyConfigTarget, parameters map[string]string) *pacv2.PolicyConfig {
+	config := &pacv2.PolicyConfig{
+		ObjectMeta: v1.ObjectMeta{Name: name},
+		Spec: pacv2.PolicyConfigSpec{
+			Match:  match,
+			Config: map[string]pacv2.PolicyConfigConfig{"policy-1": {Parameters: map[string]apiextensionsv1.JSON{}}},
+		},
+	}
+	for key, value := range parameters {
+		config.Spec.Config["policy-1"].Parameters[key] = apiextensionsv1.JSON{Raw: []byte(value)}
+	}
+	return config
+}
+
+func TestGetPolicyConfigWithSelectors(t *testing.T) {
+	items := []runtime.Object{
+		&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "staging", Labels: map[string]string{"env": "staging"}}},
+		&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "prod"}},
+		newTestPolicyConfig("objects", pacv2.PolicyConfigTarget{
+			ObjectSelector: &v1.LabelSelector{MatchLabels: map[string]string{"team": "data"}},
+		}, map[string]string{"param-3": "4"}),
+		newTestPolicyConfig("data-eu", pacv2.PolicyConfigTarget{
+			ObjectSelector: &v1.LabelSelector{MatchLabels: map[string]string{"team": "data", "region": "eu"}},
+		}, map[string]string{"param-3": "5"}),
+		newTestPolicyConfig("namespace", pacv2.PolicyConfigTarget{
+			Namespaces: []string{"staging"},
+		}, map[string]string{"param-2": "3"}),
+		newTestPolicyConfig("namespace-selector-b", pacv2.PolicyConfigTarget{
+			NamespaceSelector: &v1.LabelSelector{MatchLabels: map[string]string{"env": "staging"}},
+		}, map[string]string{"param-1": "1", "param-2": "1", "param-3": "1"}),
+		newTestPolicyConfig("namespace-selector-a", pacv2.PolicyConfigTarget{
+			NamespaceSelector: &v1.LabelSelector{MatchExpressions: []v1.LabelSelectorRequirement{
+				{Key: "env", Operator: v1.LabelSelectorOpIn, Values: []string{"staging", "dev"}},
+			}},
+		}, map[string]string{"param-1": "2"}),
+	}
+
+	cases := []struct {
+		name   string
+		entity domain.Entity
+		result map[string]domain.PolicyConfigParameter
+	}{
+		{
+			name:   "namespace selectors, namespace and object selector",
+			entity: domain.Entity{Kind: "Deployment", Name: "api", Namespace: "staging", Labels: map[string]string{"team": "data"}},
+			result: map[string]domain.PolicyConfigParameter{
+				"param-1": {Value: float64(1), ConfigRef: "namespace-selector-b"},
+				"param-2": {Value: float64(3), ConfigRef: "namespace"},
+				"param-3": {Value: float64(4), ConfigRef: "objects"},
+			},
+		},
+		{
+			name:   "namespace selectors and namespace",
+			entity: domain.Entity{Kind: "Deployment", Name: "api", Namespace: "staging"},
+			result: map[string]domain.PolicyConfigParameter{
+				"param-1": {Value: float64(1), ConfigRef: "namespace-selector-b"},
+				"param-2": {Value: float64(3), ConfigRef: "namespace"},
+				"param-3": {Value: float64(1), ConfigRef: "namespace-selector-b"},
+			},
+		},
+		{
+			name:   "object selector in namespace without labels",
+			entity: domain.Entity{Kind: "Deployment", Name: "api", Namespace: "prod", Labels: map[string]string{"team": "data"}},
+			result: map[string]domain.PolicyConfigParameter{
+				"param-3": {Value: float64(4), ConfigRef: "objects"},
+			},
+		},
+		{
+			name:   "more specific object selector",
+			entity: domain.Entity{Kind: "Deployment", Name: "api", Namespace: "prod", Labels: map[string]string{"team": "data", "region": "eu"}},
+			result: map[string]domain.PolicyConfigParameter{
+				"param-3": {Value: float64(5), ConfigRef: "data-eu"},
+			},
+		},
+		{
+			name:   "object selector of cluster scoped entity",
+			entity: domain.Entity{Kind: "ClusterRole", Name: "reader", Labels: map[string]string{"team": "data"}},
+			result: map[string]domain.PolicyConfigParameter{
+				"param-3": {Value: float64(4), ConfigRef: "objects"},
+			},
+		},
+	}
+
+	schema := runtime.NewScheme()
+	pacv2.AddToScheme(schema)
+	corev1.AddToScheme(schema)
+	watcher := PoliciesWatcher{cache: NewFakeCache(schema, items...)}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			result, err := watcher.GetPolicyConfig(context.Background(), c.entity)
+			assert.NoError(t, err)
+			assert.Equal(t, c.result, result.Config["policy-1"].Parameters)
+		})
+	}
+}
+
+func TestPoliciesWatcherConfigSelectors(t *testing.T) {
+	newConfig := func(uid string, generation int64, selector string) pacv2.PolicyConfig {
+		config := pacv2.PolicyConfig{ObjectMeta: v1.ObjectMeta{Name: uid, UID: types.UID(uid), Generation: generation}}
+		config.Spec.Match.ObjectSelector = &v1.LabelSelector{MatchLabels: map[string]string{"team": selector}}
+		return config
+	}
+	watcher := PoliciesWatcher{}
+
+	selectors := watcher.configSelectors([]pacv2.PolicyConfig{newConfig("a", 1, "data"), newConfig("b", 1, "web")})
+	assert.True(t, selectors[0].object.Matches(labels.Set{"team": "data"}))
+	assert.True(t, selectors[1].object.Matches(labels.Set{"team": "web"}))
+	assert.Nil(t, selectors[0].namespace)
+	assert.Len(t, watcher.selectors, 2)
+
+	// the selectors are parsed again when the generation changes and dropped when the config is deleted
+	selectors = watcher.configSelectors([]pacv2.PolicyConfig{newConfig("a", 2, "ops")})
+	assert.True(t, selectors[0].object.Matches(labels.Set{"team": "ops"}))
+	assert.Len(t, watcher.selectors, 1)
+	assert.Equal(t, int64(2), watcher.selectors["a"].generation)
+}
@@ -0,0 +1,91 @@
+package crd
+
+import (
+	"context"
+	"fmt"
+
+	pacv2 "github.com/weaveworks/policy-agent/api/v2beta3"
+	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// PolicySetFilter limits a policies source to the policies matching a policy set
+type PolicySetFilter struct {
+	source    domain.PoliciesSource
+	reader    client.Reader
+	policySet string
+}
+
+// NewPolicySetFilter returns a policies source that returns only the policies of source matching the named policy set
+func NewPolicySetFilter(source domain.PoliciesSource, reader client.Reader, policySet string) *PolicySetFilter {
+	return &PolicySetFilter{
+		source:    source,
+		reader:    reader,
+		policySet: policySet,
+	}
+}
+
+// GetAll returns the policies matching the policy set, implements github.com/weaveworks/policy-agent/pkg/policy-core/domain.PoliciesSource
+func (f *PolicySetFilter) GetAll(ctx context.Context) ([]domain.Policy, error) {
+	policySet := pacv2.PolicySet{}
+	err := f.reader.Get(ctx, types.NamespacedName{Name: f.policySet}, &policySet)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get policy set %s: %w", f.policySet, err)
+	}
+	policies, err := f.source.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var filtered []domain.Policy
+	for i := range policies {
+		if matchPolicySet(policySet.Spec.Filters, policies[i]) {
+			filtered = append(filtered, policies[i])
+		}
+	}
+	return filtered, nil
+}
+
+// GetPolicyConfig returns the policy config of the entity from the underlying source, implements github.com/weaveworks/policy-agent/pkg/policy-core/domain.PoliciesSource
+func (f *PolicySetFilter) GetPolicyConfig(ctx context.Context, entity domain.Entity) (*domain.PolicyConfig, error) {
+	return f.source.GetPolicyConfig(ctx, entity)
+}
+
+func (f *PolicySetFilter) getPolicyConfig(ctx context.Context, entity domain.Entity, namespaceLabels namespaceLabelsFunc) (*domain.PolicyConfig, error) {
+	return getSourcePolicyConfig(ctx, f.source, entity, namespaceLabels)
+}
+
+// matchPolicySet checks if the policy matches any of the policy set filters, ids match the policy resource name
+func matchPolicySet(filters pacv2.PolicySetFilters, policy domain.Policy) bool {
+	for _, id := range filters.IDs {
+		if reference, ok := policy.Reference.(v1.ObjectReference); ok && reference.Name == id {
+			return true
+		}
+	}
+	for _, category := range filters.Categories {
+		if policy.Category == category {
+			return true
+		}
+	}
+	for _, severity := range filters.Severities {
+		if policy.Severity == severity {
+			return true
+		}
+	}
+	for _, standard := range filters.Standards {
+		for i := range policy.Standards {
+			if policy.Standards[i].ID == standard {
+				return true
+			}
+		}
+	}
+	for _, tag := range filters.Tags {
+		for i := range policy.Tags {
+			if policy.Tags[i] == tag {
+				return true
+			}
+		}
+	}
+	return false
+}
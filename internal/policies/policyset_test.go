@@ -0,0 +1,61 @@
+package crd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pacv2 "github.com/weaveworks/policy-agent/api/v2beta3"
+	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+type staticPoliciesSource struct {
+	policies []domain.Policy
+}
+
+func (s *staticPoliciesSource) GetAll(_ context.Context) ([]domain.Policy, error) {
+	return s.policies, nil
+}
+
+func (s *staticPoliciesSource) GetPolicyConfig(_ context.Context, _ domain.Entity) (*domain.PolicyConfig, error) {
+	return nil, nil
+}
+
+func TestPolicySetFilter(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, pacv2.AddToScheme(scheme))
+	client := fake.NewClientBuilder().WithScheme(scheme).WithObjects(&pacv2.PolicySet{
+		ObjectMeta: v1.ObjectMeta{Name: "edge"},
+		Spec: pacv2.PolicySetSpec{
+			Mode: pacv2.PolicySetAuditMode,
+			Filters: pacv2.PolicySetFilters{
+				IDs:       []string{"policy-1"},
+				Standards: []string{"pci-dss"},
+				Tags:      []string{"edge"},
+			},
+		},
+	}).Build()
+
+	source := &staticPoliciesSource{policies: []domain.Policy{
+		{ID: "policy-1", Reference: corev1.ObjectReference{Name: "policy-1"}},
+		{ID: "policy-2", Standards: []domain.PolicyStandard{{ID: "pci-dss"}}},
+		{ID: "policy-3", Tags: []string{"edge"}},
+		{ID: "policy-4", Tags: []string{"core"}},
+	}}
+
+	policies, err := NewPolicySetFilter(source, client, "edge").GetAll(context.Background())
+	require.NoError(t, err)
+	var ids []string
+	for i := range policies {
+		ids = append(ids, policies[i].ID)
+	}
+	assert.Equal(t, []string{"policy-1", "policy-2", "policy-3"}, ids)
+
+	_, err = NewPolicySetFilter(source, client, "missing").GetAll(context.Background())
+	assert.Error(t, err)
+}
@@ -60,6 +60,10 @@ func (k *K8sEventSink) Stop() {
 func (k *K8sEventSink) Write(_ context.Context, results []domain.PolicyValidation) error {
 	logger.Infow("writing validation results", "sink", "k8s_events", "count", len(results))
 	for _, result := range results {
+		// events are created in the cluster of the sink, each audited cluster has its own sink
+		if result.ClusterID != "" && result.ClusterID != k.clusterID {
+			continue
+		}
 		k.resultChan <- result
 	}
 	return nil
@@ -92,6 +96,13 @@ func (k *K8sEventSink) write(ctx context.Context, result domain.PolicyValidation
 		return
 	}
 
+	if owner := result.Entity.Owner; owner != nil {
+		event.InvolvedObject = *owner.ObjectRef()
+		if owner.Namespace != "" {
+			event.Namespace = owner.Namespace
+		}
+	}
+
 	fluxObject := utils.GetFluxObject(result.Entity.Labels)
 	if fluxObject != nil {
 		event.InvolvedObject = v1.ObjectReference{
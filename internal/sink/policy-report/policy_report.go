@@ -0,0 +1,292 @@
+package policy_report
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/weaveworks/policy-agent/internal/auditor"
+	"github.com/weaveworks/policy-agent/pkg/logger"
+	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	reportName      = "weave-policy-agent"
+	reportSource    = "weave-policy-agent"
+	managedByLabel  = "app.kubernetes.io/managed-by"
+	clusterScope    = ""
+	reportsChanSize = 1
+)
+
+type reportEntry struct {
+	entity domain.Entity
+	result PolicyReportResult
+}
+
+type PolicyReportSink struct {
+	dynamicClient dynamic.Interface
+	reportsChan   chan map[string][]PolicyReportResult
+	cancelWorker  context.CancelFunc
+	reportedBy    string
+	clusterID     string
+
+	lock sync.Mutex
+	// entries holds the latest result of each policy and entity grouped by namespace, cluster scoped entities use empty namespace
+	entries map[string]map[string]reportEntry
+	// written holds the entries written during the current audit
+	written map[string]struct{}
+	// reported holds the namespaces that has a report
+	reported map[string]struct{}
+}
+
+// NewPolicyReportSink returns a sink that aggregates audit results of the cluster to PolicyReport and ClusterPolicyReport resources
+func NewPolicyReportSink(dynamicClient dynamic.Interface, reportedBy, clusterID string) (*PolicyReportSink, error) {
+	return &PolicyReportSink{
+		dynamicClient: dynamicClient,
+		reportsChan:   make(chan map[string][]PolicyReportResult, reportsChanSize),
+		reportedBy:    reportedBy,
+		clusterID:     clusterID,
+		entries:       make(map[string]map[string]reportEntry),
+		written:       make(map[string]struct{}),
+		reported:      make(map[string]struct{}),
+	}, nil
+}
+
+// Start starts the writer worker
+func (p *PolicyReportSink) Start(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	p.cancelWorker = cancel
+	return p.writeWorker(ctx)
+}
+
+// Stop stops worker
+func (p *PolicyReportSink) Stop() {
+	p.cancelWorker()
+}
+
+// Write stores results until the audit finishes, implements github.com/weaveworks/policy-agent/pkg/policy-core/domain.PolicyValidationSink
+func (p *PolicyReportSink) Write(_ context.Context, results []domain.PolicyValidation) error {
+	logger.Debugw("writing validation results", "sink", "policy_report", "count", len(results))
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, result := range results {
+		if result.ClusterID != "" && result.ClusterID != p.clusterID {
+			continue
+		}
+		entity := result.Entity
+		key := fmt.Sprintf("%s/%s/%s/%s", result.Policy.ID, entity.Kind, entity.Namespace, entity.Name)
+		if _, ok := p.entries[entity.Namespace]; !ok {
+			p.entries[entity.Namespace] = make(map[string]reportEntry)
+		}
+		p.entries[entity.Namespace][key] = reportEntry{
+			entity: domain.Entity{Kind: entity.Kind, Namespace: entity.Namespace, Name: entity.Name},
+			result: newPolicyReportResult(result),
+		}
+		p.written[key] = struct{}{}
+	}
+	return nil
+}
+
+// OnAuditComplete updates the reports with the results of the finished audit, the results of cancelled audits are kept
+// until the next audit, implements github.com/weaveworks/policy-agent/internal/auditor.AuditEventListener
+func (p *PolicyReportSink) OnAuditComplete(ctx context.Context, auditEvent auditor.AuditEvent) {
+	if auditEvent.Cancelled {
+		p.lock.Lock()
+		p.written = make(map[string]struct{})
+		p.lock.Unlock()
+		return
+	}
+	reports := p.collect(auditEvent)
+	select {
+	case p.reportsChan <- reports:
+	case <-ctx.Done():
+	}
+}
+
+// collect drops results of evaluated entities that were not written during the audit and groups results by namespace
+func (p *PolicyReportSink) collect(auditEvent auditor.AuditEvent) map[string][]PolicyReportResult {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	reports := make(map[string][]PolicyReportResult)
+	for namespace := range p.reported {
+		reports[namespace] = nil
+	}
+	for namespace, entries := range p.entries {
+		for key, entry := range entries {
+			if _, ok := p.written[key]; !ok && auditEvent.Evaluated(p.clusterID, entry.result.Policy, entry.entity) {
+				delete(entries, key)
+				continue
+			}
+			reports[namespace] = append(reports[namespace], entry.result)
+		}
+		if len(entries) == 0 {
+			delete(p.entries, namespace)
+		}
+	}
+	p.written = make(map[string]struct{})
+	p.reported = make(map[string]struct{})
+	for namespace := range reports {
+		p.reported[namespace] = struct{}{}
+	}
+	return reports
+}
+
+func (p *PolicyReportSink) writeWorker(ctx context.Context) error {
+	for {
+		select {
+		case reports := <-p.reportsChan:
+			p.writeReports(ctx, reports)
+		case <-ctx.Done():
+			logger.Info("stopping write worker ...")
+			return nil
+		}
+	}
+}
+
+func (p *PolicyReportSink) writeReports(ctx context.Context, reports map[string][]PolicyReportResult) {
+	for namespace, results := range reports {
+		sort.Slice(results, func(i, j int) bool {
+			if results[i].Policy != results[j].Policy {
+				return results[i].Policy < results[j].Policy
+			}
+			return results[i].Resources[0].Name < results[j].Resources[0].Name
+		})
+		err := p.writeReport(ctx, namespace, results)
+		if err != nil {
+			logger.Errorw("failed to write policy report", "namespace", namespace, "error", err)
+		}
+	}
+}
+
+// writeReport creates the report of the namespace or updates it in place if it exists
+func (p *PolicyReportSink) writeReport(ctx context.Context, namespace string, results []PolicyReportResult) error {
+	var client dynamic.ResourceInterface
+	kind := PolicyReportKind
+	if namespace == clusterScope {
+		kind = ClusterPolicyReportKind
+		client = p.dynamicClient.Resource(ClusterPolicyReportGroupVersionResource)
+	} else {
+		client = p.dynamicClient.Resource(PolicyReportGroupVersionResource).Namespace(namespace)
+	}
+
+	report := PolicyReport{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: GroupVersion.String(),
+			Kind:       kind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      reportName,
+			Namespace: namespace,
+			Labels: map[string]string{
+				managedByLabel: p.reportedBy,
+			},
+		},
+		Summary: newPolicyReportSummary(results),
+		Results: results,
+	}
+	object, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&report)
+	if err != nil {
+		return fmt.Errorf("failed to convert policy report: %w", err)
+	}
+
+	existing, err := client.Get(ctx, reportName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		if len(results) == 0 {
+			return nil
+		}
+		logger.Infow("creating policy report", "kind", kind, "namespace", namespace, "results", len(results))
+		_, err = client.Create(ctx, &unstructured.Unstructured{Object: object}, metav1.CreateOptions{})
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	existing.Object["summary"] = object["summary"]
+	if results, ok := object["results"]; ok {
+		existing.Object["results"] = results
+	} else {
+		delete(existing.Object, "results")
+	}
+	logger.Infow("updating policy report", "kind", kind, "namespace", namespace, "results", len(results))
+	_, err = client.Update(ctx, existing, metav1.UpdateOptions{})
+	return err
+}
+
+func newPolicyReportResult(validation domain.PolicyValidation) PolicyReportResult {
+	result := ResultPass
+	if validation.Status == domain.PolicyValidationStatusViolating {
+		result = ResultWarn
+		if validation.Enforced {
+			result = ResultFail
+		}
+	}
+
+	severity := strings.ToLower(validation.Policy.Severity)
+	switch severity {
+	case "critical", "high", "medium", "low", SeverityInfo:
+	default:
+		severity = SeverityInfo
+	}
+
+	properties := map[string]string{
+		"policy_name": validation.Policy.Name,
+		"occurrences": fmt.Sprint(len(validation.Occurrences)),
+	}
+	for i, occurrence := range validation.Occurrences {
+		properties[fmt.Sprintf("occurrence_%d", i+1)] = occurrence.Message
+	}
+
+	if validation.Entity.GitCommit != "" {
+		properties["git_commit"] = validation.Entity.GitCommit
+	}
+	if validation.Entity.File != "" {
+		properties["file"] = fmt.Sprintf("%s:%d", validation.Entity.File, validation.Entity.Line)
+	}
+
+	resource := validation.Entity.ObjectRef()
+	if owner := validation.Entity.Owner; owner != nil {
+		properties["entity"] = fmt.Sprintf("%s/%s", strings.ToLower(validation.Entity.Kind), validation.Entity.Name)
+		resource = owner.ObjectRef()
+	}
+
+	return PolicyReportResult{
+		Source:     reportSource,
+		Policy:     validation.Policy.ID,
+		Category:   validation.Policy.Category,
+		Severity:   severity,
+		Timestamp:  metav1.Timestamp{Seconds: validation.CreatedAt.Unix(), Nanos: int32(validation.CreatedAt.Nanosecond())},
+		Result:     result,
+		Scored:     true,
+		Message:    validation.Message,
+		Resources:  []v1.ObjectReference{*resource},
+		Properties: properties,
+	}
+}
+
+func newPolicyReportSummary(results []PolicyReportResult) PolicyReportSummary {
+	var summary PolicyReportSummary
+	for i := range results {
+		switch results[i].Result {
+		case ResultPass:
+			summary.Pass++
+		case ResultFail:
+			summary.Fail++
+		case ResultWarn:
+			summary.Warn++
+		case ResultError:
+			summary.Error++
+		case ResultSkip:
+			summary.Skip++
+		}
+	}
+	return summary
+}
@@ -0,0 +1,132 @@
+package policy_report
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/weaveworks/policy-agent/internal/auditor"
+	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+	"github.com/weaveworks/policy-agent/pkg/uuid-go"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func getReport(t *testing.T, client *dynamicfake.FakeDynamicClient, resource schema.GroupVersionResource, namespace string) PolicyReport {
+	obj, err := client.Resource(resource).Namespace(namespace).Get(context.Background(), reportName, metav1.GetOptions{})
+	assert.Nil(t, err)
+	var report PolicyReport
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &report)
+	assert.Nil(t, err)
+	return report
+}
+
+func TestPolicyReportSink(t *testing.T) {
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		PolicyReportGroupVersionResource:        "PolicyReportList",
+		ClusterPolicyReportGroupVersionResource: "ClusterPolicyReportList",
+	})
+	sink, err := NewPolicyReportSink(client, "policy-agent", "cluster-1")
+	assert.Nil(t, err)
+
+	policy := domain.Policy{
+		ID:       "weave.policies.missing-owner-label",
+		Name:     "Missing Owner Label",
+		Category: "weave.categories.organizational-standards",
+		Severity: "high",
+	}
+	deployment := domain.Entity{
+		ID:         uuid.NewV4().String(),
+		APIVersion: "apps/v1",
+		Kind:       "Deployment",
+		Name:       "app",
+		Namespace:  "dev",
+	}
+	clusterRole := domain.Entity{
+		ID:         uuid.NewV4().String(),
+		APIVersion: "rbac.authorization.k8s.io/v1",
+		Kind:       "ClusterRole",
+		Name:       "admin",
+	}
+
+	results := []domain.PolicyValidation{
+		{
+			Policy:      policy,
+			Entity:      deployment,
+			Status:      domain.PolicyValidationStatusViolating,
+			Message:     "Missing Owner Label in deployment app (1 occurrences)",
+			Occurrences: []domain.Occurrence{{Message: "missing owner label in metadata"}},
+			Enforced:    true,
+			CreatedAt:   time.Now(),
+		},
+		{
+			Policy:    policy,
+			Entity:    clusterRole,
+			Status:    domain.PolicyValidationStatusCompliant,
+			CreatedAt: time.Now(),
+		},
+		// results of other clusters are not reported
+		{
+			Policy:    policy,
+			Entity:    domain.Entity{Kind: "Deployment", Name: "remote-app", Namespace: "dev"},
+			Status:    domain.PolicyValidationStatusViolating,
+			ClusterID: "cluster-2",
+			CreatedAt: time.Now(),
+		},
+	}
+
+	ctx := context.Background()
+	err = sink.Write(ctx, results)
+	assert.Nil(t, err)
+	sink.writeReports(ctx, sink.collect(auditor.AuditEvent{}))
+
+	report := getReport(t, client, PolicyReportGroupVersionResource, "dev")
+	assert.Equal(t, PolicyReportSummary{Fail: 1}, report.Summary)
+	assert.Len(t, report.Results, 1)
+	result := report.Results[0]
+	assert.Equal(t, policy.ID, result.Policy)
+	assert.Equal(t, policy.Category, result.Category)
+	assert.Equal(t, "high", result.Severity)
+	assert.Equal(t, ResultFail, result.Result)
+	assert.Equal(t, deployment.Name, result.Resources[0].Name)
+	assert.Equal(t, "1", result.Properties["occurrences"])
+	assert.Equal(t, "missing owner label in metadata", result.Properties["occurrence_1"])
+
+	clusterReport := getReport(t, client, ClusterPolicyReportGroupVersionResource, "")
+	assert.Equal(t, PolicyReportSummary{Pass: 1}, clusterReport.Summary)
+
+	// next audit resolves the deployment violation
+	err = sink.Write(ctx, results[1:])
+	assert.Nil(t, err)
+	sink.writeReports(ctx, sink.collect(auditor.AuditEvent{}))
+
+	report = getReport(t, client, PolicyReportGroupVersionResource, "dev")
+	assert.Equal(t, PolicyReportSummary{}, report.Summary)
+	assert.Len(t, report.Results, 0)
+
+	// scoped audit keeps results of entities out of scope
+	err = sink.Write(ctx, results[:1])
+	assert.Nil(t, err)
+	sink.writeReports(ctx, sink.collect(auditor.AuditEvent{Scope: auditor.AuditScope{Namespaces: []string{"dev"}}}))
+
+	clusterReport = getReport(t, client, ClusterPolicyReportGroupVersionResource, "")
+	assert.Equal(t, PolicyReportSummary{Pass: 1}, clusterReport.Summary)
+	report = getReport(t, client, PolicyReportGroupVersionResource, "dev")
+	assert.Equal(t, PolicyReportSummary{Fail: 1}, report.Summary)
+
+	// results written by a cancelled audit do not keep entities the next audit did not find
+	err = sink.Write(ctx, results[1:2])
+	assert.Nil(t, err)
+	sink.OnAuditComplete(ctx, auditor.AuditEvent{Cancelled: true})
+	err = sink.Write(ctx, results[:1])
+	assert.Nil(t, err)
+	sink.writeReports(ctx, sink.collect(auditor.AuditEvent{}))
+
+	clusterReport = getReport(t, client, ClusterPolicyReportGroupVersionResource, "")
+	assert.Equal(t, PolicyReportSummary{}, clusterReport.Summary)
+	report = getReport(t, client, PolicyReportGroupVersionResource, "dev")
+	assert.Equal(t, PolicyReportSummary{Fail: 1}, report.Summary)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -10,12 +11,15 @@ import (
 
 	"github.com/fluxcd/pkg/runtime/events"
 	"github.com/urfave/cli/v2"
+	pacv2beta2 "github.com/weaveworks/policy-agent/api/v2beta2"
 	pacv2 "github.com/weaveworks/policy-agent/api/v2beta3"
 	"github.com/weaveworks/policy-agent/configuration"
 	"github.com/weaveworks/policy-agent/controllers"
 	"github.com/weaveworks/policy-agent/internal/admission"
 	"github.com/weaveworks/policy-agent/internal/auditor"
 	"github.com/weaveworks/policy-agent/internal/clients/kube"
+	filesystem_entities "github.com/weaveworks/policy-agent/internal/entities/filesystem"
+	git_entities "github.com/weaveworks/policy-agent/internal/entities/git"
 	"github.com/weaveworks/policy-agent/internal/entities/k8s"
 	"github.com/weaveworks/policy-agent/internal/mutation"
 	crd "github.com/weaveworks/policy-agent/internal/policies"
@@ -23,17 +27,23 @@ import (
 	"github.com/weaveworks/policy-agent/internal/sink/filesystem"
 	flux_notification "github.com/weaveworks/policy-agent/internal/sink/flux-notification"
 	k8s_event "github.com/weaveworks/policy-agent/internal/sink/k8s-event"
+	policy_report "github.com/weaveworks/policy-agent/internal/sink/policy-report"
 	"github.com/weaveworks/policy-agent/internal/terraform"
 	"github.com/weaveworks/policy-agent/pkg/log"
 	"github.com/weaveworks/policy-agent/pkg/logger"
 	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
 	"github.com/weaveworks/policy-agent/pkg/policy-core/validation"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 )
@@ -113,6 +123,11 @@ func main() {
 			return fmt.Errorf("failed to add policy crd to scheme: %w", err)
 		}
 
+		err = pacv2beta2.AddToScheme(scheme)
+		if err != nil {
+			return fmt.Errorf("failed to add policy set crd to scheme: %w", err)
+		}
+
 		lg := log.NewControllerLog(config.AccountID, config.ClusterID)
 
 		mgr, err := ctrl.NewManager(kubeConfig, ctrl.Options{
@@ -147,17 +162,114 @@ func main() {
 		if err != nil {
 			return fmt.Errorf("init client failed: %w", err)
 		}
-		entitiesSources, err := k8s.GetEntitiesSources(contextCli.Context, kubeClient)
+		kubeClient.SetListRateLimit(config.Audit.QPS, config.Audit.Burst)
+		newClusterContext := func(kubeClient *kube.KubeClient) (domain.ClusterContextSource, error) {
+			return initClusterContextCollector(contextCli.Context, mgr, kubeClient, contextCli.App.Version, config.ClusterContextInterval)
+		}
+		clusterContext, err := newClusterContext(kubeClient)
+		if err != nil {
+			return err
+		}
+		// policies are loaded from the files of the policies path instead of the policy resources when it is set
+		policiesFromFiles := config.Policies.Path != ""
+		var filesNamespaceResolver domain.NamespaceResolver = k8s.NewNamespaceResolver(kubeClient)
+		// the expired exclusions of the files are reported by the first filesystem policies source only as all of them load the same files
+		filesRecorder := mgr.GetEventRecorderFor(eventReportingController)
+		newPoliciesSource := func(provider, mode string) (domain.PoliciesSource, domain.NamespaceResolver, error) {
+			if policiesFromFiles {
+				policiesSource, err := initFilesystemPolicies(mgr, config.Policies, provider, mode, filesRecorder)
+				if err != nil {
+					return nil, nil, err
+				}
+				filesRecorder = nil
+				// the policy configs of the files are matched with the namespaces of the cluster
+				return crd.NewClusterPolicies(policiesSource, filesNamespaceResolver), filesNamespaceResolver, nil
+			}
+			policiesSource, err := crd.NewPoliciesWatcher(contextCli.Context, mgr, provider, mode)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to initialize CRD policies source: %w", err)
+			}
+			return policiesSource, policiesSource, nil
+		}
+
+		sourcesFilter, err := initSourcesFilter(config.Audit)
+		if err != nil {
+			return err
+		}
+		if config.Audit.MetadataPrefilter {
+			prefilterPolicies, _, err := newPoliciesSource(pacv2.PolicyKubernetesProvider, pacv2.PolicySetAuditMode)
+			if err != nil {
+				return err
+			}
+			sourcesFilter.MetadataFilter = crd.NewPoliciesMetadataFilter(prefilterPolicies)
+		}
+		var entitiesSources []domain.EntitiesSource
+		var deniedKinds []string
+		if config.Audit.ManifestsDir != "" && config.Audit.Git.Repository != "" {
+			return errors.New("audit manifestsDir and git can not be set together")
+		}
+		auditManifests := config.Audit.ManifestsDir != "" || config.Audit.Git.Repository != ""
+		if config.Audit.ManifestsDir != "" {
+			logger.Infow("auditing manifests directory instead of cluster entities", "path", config.Audit.ManifestsDir)
+			entitiesSources, err = filesystem_entities.GetEntitiesSources(config.Audit.ManifestsDir)
+		} else if config.Audit.Git.Repository != "" {
+			logger.Infow(
+				"auditing git repository manifests instead of cluster entities",
+				"repository", config.Audit.Git.Repository,
+				"ref", config.Audit.Git.Ref,
+				"path", config.Audit.Git.Path,
+			)
+			entitiesSources, err = git_entities.GetEntitiesSources(config.Audit.Git.Repository, config.Audit.Git.Ref, config.Audit.Git.Path)
+		} else {
+			entitiesSources, deniedKinds, err = k8s.DiscoverEntitiesSources(contextCli.Context, kubeClient, sourcesFilter)
+		}
 		if err != nil {
 			return fmt.Errorf("initializing entities sources failed: %w", err)
 		}
 
+		ownerResolver, err := initOwnerResolver(mgr, kubeConfig)
+		if err != nil {
+			return err
+		}
+		// scope targets are matched with the scope of the entity kinds known by the cluster
+		scopeResolver := k8s.NewScopeResolver(mgr.GetRESTMapper())
+
+		var policyReportSink *policy_report.PolicyReportSink
+		var auditStateTracker *auditor.AuditStateTracker
 		auditSinks := []domain.PolicyValidationSink{}
 		admissionSinks := []domain.PolicyValidationSink{}
 		terraformSinks := []domain.PolicyValidationSink{}
 
+		// addAuditSink adds the sink to the audit sinks, sinks with deltas are notified of the audit state changes instead
+		addAuditSink := func(sinks *[]domain.PolicyValidationSink, sink domain.PolicyValidationSink, deltas []string) error {
+			if len(deltas) == 0 {
+				*sinks = append(*sinks, sink)
+				return nil
+			}
+			if auditStateTracker == nil {
+				return errors.New("audit sinks deltas require audit state to be enabled")
+			}
+			violationDeltas := make([]auditor.ViolationDelta, 0, len(deltas))
+			for _, name := range deltas {
+				delta, err := auditor.ParseViolationDelta(name)
+				if err != nil {
+					return err
+				}
+				violationDeltas = append(violationDeltas, delta)
+			}
+			auditStateTracker.Subscribe(sink, violationDeltas...)
+			return nil
+		}
+
 		if config.Audit.Enabled {
 			auditSinksConfig := config.Audit.Sinks
+			if config.Audit.State.Enabled {
+				auditStateTracker, err = initAuditStateTracker(contextCli.Context, config.Audit.State, kubeClient)
+				if err != nil {
+					return err
+				}
+				auditSinks = append(auditSinks, auditStateTracker)
+			}
 			if auditSinksConfig.FilesystemSink != nil {
 				fileName := auditSinksConfig.FilesystemSink.FileName
 				fileSystemSink, err := initFileSystemSink(mgr, fileName)
@@ -165,7 +277,10 @@ func main() {
 					return err
 				}
 				defer fileSystemSink.Stop()
-				auditSinks = append(auditSinks, fileSystemSink)
+				err = addAuditSink(&auditSinks, fileSystemSink, auditSinksConfig.FilesystemSink.Deltas)
+				if err != nil {
+					return err
+				}
 			}
 			if auditSinksConfig.K8sEventsSink != nil && auditSinksConfig.K8sEventsSink.Enabled {
 				logger.Info("initializing kubernetes events audit sink ...")
@@ -174,7 +289,10 @@ func main() {
 					return err
 				}
 				defer k8sEventSink.Stop()
-				auditSinks = append(auditSinks, k8sEventSink)
+				err = addAuditSink(&auditSinks, k8sEventSink, auditSinksConfig.K8sEventsSink.Deltas)
+				if err != nil {
+					return err
+				}
 			}
 			if auditSinksConfig.FluxNotificationSink != nil {
 				fluxControllerAddress := auditSinksConfig.FluxNotificationSink.Address
@@ -184,7 +302,10 @@ func main() {
 					return err
 				}
 				defer fluxNotificationSink.Stop()
-				auditSinks = append(auditSinks, fluxNotificationSink)
+				err = addAuditSink(&auditSinks, fluxNotificationSink, auditSinksConfig.FluxNotificationSink.Deltas)
+				if err != nil {
+					return err
+				}
 			}
 			if auditSinksConfig.ElasticSink != nil {
 				elasticsearchSinkConfig := auditSinksConfig.ElasticSink
@@ -192,7 +313,19 @@ func main() {
 				if err != nil {
 					return err
 				}
-				auditSinks = append(auditSinks, elasticsearchSink)
+				err = addAuditSink(&auditSinks, elasticsearchSink, elasticsearchSinkConfig.Deltas)
+				if err != nil {
+					return err
+				}
+			}
+			if auditSinksConfig.PolicyReportSink != nil && auditSinksConfig.PolicyReportSink.Enabled {
+				logger.Info("initializing policy report audit sink ...")
+				policyReportSink, err = initPolicyReportSink(mgr, kubeClient, config.ClusterID)
+				if err != nil {
+					return err
+				}
+				defer policyReportSink.Stop()
+				auditSinks = append(auditSinks, policyReportSink)
 			}
 		}
 
@@ -277,39 +410,188 @@ func main() {
 			}
 		}
 
+		policyController := &controllers.PolicyController{
+			Client:    mgr.GetClient(),
+			Discovery: kubeClient.DiscoveryClient,
+			Recorder:  mgr.GetEventRecorderFor(eventReportingController),
+		}
+
 		if config.Audit.Enabled {
 			logger.Info("starting audit policies watcher")
 
-			policiesSource, err := crd.NewPoliciesWatcher(contextCli.Context, mgr, pacv2.PolicyKubernetesProvider)
-
+			policiesSource, namespaceResolver, err := newPoliciesSource(pacv2.PolicyKubernetesProvider, pacv2.PolicySetAuditMode)
 			if err != nil {
-				return fmt.Errorf("failed to initialize CRD policies source: %w", err)
+				return err
 			}
 
-			validator := validation.NewOPAValidator(
-				policiesSource,
-				config.Audit.WriteCompliance,
-				auditor.TypeAudit,
-				config.AccountID,
-				config.ClusterID,
-				false,
-				auditSinks...,
-			)
-			auditControllerInterval := time.Duration(config.Audit.Interval) * time.Hour
-			if config.Audit.Interval < 1 {
-				logger.Fatal("audit interval can not be less than 1 hour, current interval: ", auditControllerInterval)
+			// namespaceResolvers holds the namespace resolver of each audited cluster, filled before the manager starts
+			namespaceResolvers := map[string]domain.NamespaceResolver{config.ClusterID: namespaceResolver}
+			clusterContexts := map[string]domain.ClusterContextSource{config.ClusterID: clusterContext}
+			scopeResolvers := map[string]domain.ScopeResolver{config.ClusterID: scopeResolver}
+			// clusterSinks holds the sinks writing to each remote cluster, in addition to the audit sinks
+			clusterSinks := map[string][]domain.PolicyValidationSink{}
+			newAuditValidator := func(clusterID string, policiesSource domain.PoliciesSource) validation.Validator {
+				if clusterID != config.ClusterID {
+					// policy configs are matched with the namespaces of the audited cluster
+					policiesSource = crd.NewClusterPolicies(policiesSource, namespaceResolvers[clusterID])
+				}
+				sinks := append(append([]domain.PolicyValidationSink{}, auditSinks...), clusterSinks[clusterID]...)
+				validator := validation.NewOPAValidator(
+					policiesSource,
+					config.Audit.WriteCompliance,
+					auditor.TypeAudit,
+					config.AccountID,
+					clusterID,
+					false,
+					sinks...,
+				)
+				validator.SetNamespaceResolver(namespaceResolvers[clusterID])
+				validator.SetClusterContextSource(clusterContexts[clusterID])
+				validator.SetScopeResolver(scopeResolvers[clusterID])
+				validator.SetEvaluateOwners(config.Audit.EvaluateOwnedEntities)
+				return validator
+			}
+			validator := newAuditValidator(config.ClusterID, policiesSource)
+			auditSchedule, err := initAuditSchedule(config.Audit)
+			if err != nil {
+				return err
+			}
+			auditController := auditor.NewAuditController(validator, auditSchedule, entitiesSources...)
+			for _, override := range config.Audit.Overrides {
+				if len(override.Kinds) == 0 && len(override.Namespaces) == 0 {
+					return fmt.Errorf("audit schedule override %q must specify kinds or namespaces", override.Schedule)
+				}
+				overrideSchedule, err := auditor.ParseSchedule(override.Schedule)
+				if err != nil {
+					return err
+				}
+				auditController.AddScheduleOverride(overrideSchedule, auditor.AuditScope{
+					Kinds:      override.Kinds,
+					Namespaces: override.Namespaces,
+				})
+			}
+			auditController.SetClusterID(config.ClusterID)
+			auditController.SetJitter(config.Audit.Jitter)
+			auditController.SetConcurrency(config.Audit.Workers, config.Audit.PageSize)
+			auditController.SetHistorySize(config.Audit.HistorySize)
+			auditController.SetSkippedKinds(deniedKindsReasons(deniedKinds))
+			if err := mgr.AddMetricsExtraHandler("/audit/status", auditController.History()); err != nil {
+				return fmt.Errorf("failed to register audit status handler: %w", err)
+			}
+			if config.Audit.EvaluateOwnedEntities {
+				auditController.SetOwnerResolver(ownerResolver)
+			}
+			if auditStateTracker != nil {
+				auditController.RegisterAuditCompleteListener(auditStateTracker.OnAuditComplete)
+			}
+			if policyReportSink != nil {
+				auditController.RegisterAuditCompleteListener(policyReportSink.OnAuditComplete)
+			}
+			if !policiesFromFiles {
+				auditController.RegisterAuditResultListener(policyController.OnAuditResult)
+			}
+			// initClusterSinks writes the events and the policy reports of a remote cluster to the cluster itself
+			initClusterSinks := func(clusterID string, kubeClient *kube.KubeClient) error {
+				auditSinksConfig := config.Audit.Sinks
+				var sinks []domain.PolicyValidationSink
+				if auditSinksConfig.K8sEventsSink != nil && auditSinksConfig.K8sEventsSink.Enabled {
+					k8sEventSink, err := k8s_event.NewK8sEventSink(kubeClient.ClientSet, config.AccountID, clusterID, eventReportingController)
+					if err != nil {
+						return fmt.Errorf("failed to initialize kubernetes event sink of cluster %s: %w", clusterID, err)
+					}
+					if err := mgr.Add(k8sEventSink); err != nil {
+						return err
+					}
+					err = addAuditSink(&sinks, k8sEventSink, auditSinksConfig.K8sEventsSink.Deltas)
+					if err != nil {
+						return err
+					}
+				}
+				if auditSinksConfig.PolicyReportSink != nil && auditSinksConfig.PolicyReportSink.Enabled {
+					policyReportSink, err := initPolicyReportSink(mgr, kubeClient, clusterID)
+					if err != nil {
+						return err
+					}
+					sinks = append(sinks, policyReportSink)
+					auditController.RegisterAuditCompleteListener(policyReportSink.OnAuditComplete)
+				}
+				clusterSinks[clusterID] = sinks
+				return nil
+			}
+			clusterIDs := map[string]struct{}{config.ClusterID: {}}
+			for _, clusterConfig := range config.Clusters {
+				if _, ok := clusterIDs[clusterConfig.ID]; ok {
+					return fmt.Errorf("duplicate audit cluster id %q", clusterConfig.ID)
+				}
+				clusterIDs[clusterConfig.ID] = struct{}{}
+				var clusterPolicies domain.PoliciesSource = policiesSource
+				if clusterConfig.PolicySet != "" {
+					if policiesFromFiles {
+						return fmt.Errorf("audit cluster %q policy set can not be used with policies path", clusterConfig.ID)
+					}
+					clusterPolicies = crd.NewPolicySetFilter(policiesSource, mgr.GetClient(), clusterConfig.PolicySet)
+				}
+				clusterFilter := sourcesFilter
+				if clusterFilter.MetadataFilter != nil {
+					clusterFilter.MetadataFilter = crd.NewPoliciesMetadataFilter(clusterPolicies)
+				}
+				err := initAuditCluster(
+					contextCli.Context,
+					mgr,
+					auditController,
+					clusterConfig,
+					config.Audit,
+					clusterFilter,
+					namespaceResolvers,
+					clusterContexts,
+					scopeResolvers,
+					newClusterContext,
+					initClusterSinks,
+					func() validation.Validator {
+						return newAuditValidator(clusterConfig.ID, clusterPolicies)
+					},
+				)
+				if err != nil {
+					return err
+				}
 			}
-			auditController := auditor.NewAuditController(validator, auditControllerInterval, entitiesSources...)
 			mgr.Add(auditController)
 			auditController.Audit(auditor.AuditEventTypeInitial, nil)
+
+			if !auditManifests {
+				sourcesRefresher := k8s.NewSourcesRefresher(
+					kubeClient,
+					sourcesFilter,
+					config.Audit.Discovery.Interval,
+					config.Audit.Discovery.WatchCRDs,
+					entitiesSources,
+					deniedKinds,
+					func(sources []domain.EntitiesSource, deniedKinds []string) {
+						auditController.SetEntitiesSources(sources...)
+						auditController.SetSkippedKinds(deniedKindsReasons(deniedKinds))
+					},
+				)
+				mgr.Add(sourcesRefresher)
+			}
+
+			if !policiesFromFiles {
+				if err = (&controllers.AuditRunController{
+					Client:         mgr.GetClient(),
+					Auditor:        auditController,
+					PoliciesSource: policiesSource,
+					NewValidator:   newAuditValidator,
+				}).SetupWithManager(mgr); err != nil {
+					return fmt.Errorf("failed to create audit run controller: %w", err)
+				}
+			}
 		}
 
 		if config.Admission.Enabled {
 			logger.Info("starting admission policies watcher")
 
-			policiesSource, err := crd.NewPoliciesWatcher(contextCli.Context, mgr, pacv2.PolicyKubernetesProvider)
+			policiesSource, namespaceResolver, err := newPoliciesSource(pacv2.PolicyKubernetesProvider, pacv2.PolicySetAdmissionMode)
 			if err != nil {
-				return fmt.Errorf("failed to initialize CRD policies source: %w", err)
+				return err
 			}
 
 			validator := validation.NewOPAValidator(
@@ -321,10 +603,14 @@ func main() {
 				false,
 				admissionSinks...,
 			)
+			validator.SetNamespaceResolver(namespaceResolver)
+			validator.SetClusterContextSource(clusterContext)
+			validator.SetScopeResolver(scopeResolver)
 			admissionServer := admission.NewAdmissionHandler(
 				config.LogLevel,
 				validator,
 			)
+			admissionServer.SetOwnerResolver(ownerResolver)
 			logger.Info("starting admission server...")
 			err = admissionServer.Run(mgr)
 			if err != nil {
@@ -340,6 +626,9 @@ func main() {
 					config.ClusterID,
 					true,
 				)
+				validator.SetNamespaceResolver(namespaceResolver)
+				validator.SetClusterContextSource(clusterContext)
+				validator.SetScopeResolver(scopeResolver)
 				mutationServer := mutation.NewMutationHandler(validator)
 				logger.Info("starting mutation server...")
 				err = mutationServer.Run(mgr)
@@ -350,10 +639,9 @@ func main() {
 		}
 
 		if config.TFAdmission.Enabled {
-			policiesSource, err := crd.NewPoliciesWatcher(contextCli.Context, mgr, pacv2.PolicyTerraformProvider)
-
+			policiesSource, _, err := newPoliciesSource(pacv2.PolicyTerraformProvider, pacv2.PolicySetTFAdmissionMode)
 			if err != nil {
-				return fmt.Errorf("failed to initialize CRD policies source: %w", err)
+				return err
 			}
 
 			validator := validation.NewOPAValidator(
@@ -378,11 +666,28 @@ func main() {
 			}
 		}
 
-		if err = (&controllers.PolicyConfigController{
-			Client: mgr.GetClient(),
-		}).SetupWithManager(mgr); err != nil {
-			logger.Errorw("unable to create controller", "controller", "policyConfig", "err", err)
-			os.Exit(1)
+		// the policy resources controllers require the policy resource definitions
+		if !policiesFromFiles {
+			if err = (&controllers.PolicyConfigController{
+				Client: mgr.GetClient(),
+			}).SetupWithManager(mgr); err != nil {
+				logger.Errorw("unable to create controller", "controller", "policyConfig", "err", err)
+				os.Exit(1)
+			}
+
+			if err = policyController.SetupWithManager(mgr); err != nil {
+				logger.Errorw("unable to create controller", "controller", "policy", "err", err)
+				os.Exit(1)
+			}
+
+			namespacePolicyController := &controllers.NamespacePolicyController{
+				Client:   mgr.GetClient(),
+				Recorder: mgr.GetEventRecorderFor(eventReportingController),
+			}
+			if err = namespacePolicyController.SetupWithManager(mgr); err != nil {
+				logger.Errorw("unable to create controller", "controller", "namespacePolicy", "err", err)
+				os.Exit(1)
+			}
 		}
 
 		err = mgr.Start(ctrl.SetupSignalHandler())
@@ -398,6 +703,17 @@ func main() {
 	}
 }
 
+func initAuditSchedule(auditConfig configuration.AuditConfig) (auditor.Schedule, error) {
+	if auditConfig.Schedule != "" {
+		return auditor.ParseSchedule(auditConfig.Schedule)
+	}
+	auditControllerInterval := time.Duration(auditConfig.Interval) * time.Hour
+	if auditConfig.Interval < 1 {
+		return nil, fmt.Errorf("audit interval can not be less than 1 hour, current interval: %s, use audit schedule for shorter intervals", auditControllerInterval)
+	}
+	return auditor.NewIntervalSchedule(auditControllerInterval), nil
+}
+
 func initFileSystemSink(mgr manager.Manager, filename string) (*filesystem.FileSystemSink, error) {
 	filePath := filepath.Join("/logs", filename)
 	logger.Infow("initializing filesystem sink ...", "file", filePath)
@@ -447,6 +763,91 @@ func initK8sEventSink(mgr manager.Manager, config configuration.Config) (*k8s_ev
 	return sink, nil
 }
 
+// initClusterContextCollector collects the cluster context at startup and adds its periodic collection to the manager
+func initClusterContextCollector(
+	ctx context.Context,
+	mgr manager.Manager,
+	kubeClient *kube.KubeClient,
+	agentVersion string,
+	interval time.Duration,
+) (*k8s.ClusterContextCollector, error) {
+	collector := k8s.NewClusterContextCollector(kubeClient, agentVersion, interval)
+	if err := collector.Collect(ctx); err != nil {
+		logger.Warnw("failed to collect cluster context", "error", err)
+	}
+	if err := mgr.Add(collector); err != nil {
+		return nil, fmt.Errorf("failed to add cluster context collector: %w", err)
+	}
+	return collector, nil
+}
+
+func initFilesystemPolicies(mgr manager.Manager, config configuration.PoliciesConfig, provider, mode string, recorder record.EventRecorder) (*crd.FilesystemPolicies, error) {
+	logger.Infow("loading policies from files instead of policy resources", "path", config.Path, "provider", provider, "mode", mode)
+	policiesSource, err := crd.NewFilesystemPolicies(config.Path, provider, mode, config.ReloadInterval)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize filesystem policies source: %w", err)
+	}
+	policiesSource.SetRecorder(recorder)
+	if err := mgr.Add(policiesSource); err != nil {
+		return nil, fmt.Errorf("failed to add filesystem policies reloader: %w", err)
+	}
+	return policiesSource, nil
+}
+
+func initSourcesFilter(config configuration.AuditConfig) (k8s.SourcesFilter, error) {
+	filter := k8s.SourcesFilter{
+		IncludeKinds:      config.Include.Kinds,
+		ExcludeKinds:      config.Exclude.Kinds,
+		IncludeNamespaces: config.Include.Namespaces,
+		ExcludeNamespaces: config.Exclude.Namespaces,
+		MaxManifestSize:   config.MaxManifestSize,
+	}
+	var err error
+	filter.IncludeNamespaceSelector, err = labels.Parse(config.Include.NamespaceSelector)
+	if err != nil {
+		return filter, fmt.Errorf("invalid audit include namespace selector: %w", err)
+	}
+	filter.ExcludeNamespaceSelector, err = labels.Parse(config.Exclude.NamespaceSelector)
+	if err != nil {
+		return filter, fmt.Errorf("invalid audit exclude namespace selector: %w", err)
+	}
+	filter.LabelSelector, err = labels.Parse(config.LabelSelector)
+	if err != nil {
+		return filter, fmt.Errorf("invalid audit label selector: %w", err)
+	}
+	return filter, nil
+}
+
+func initAuditStateTracker(ctx context.Context, config configuration.AuditStateConfig, kubeClient *kube.KubeClient) (*auditor.AuditStateTracker, error) {
+	var store auditor.StateStore
+	if config.File != "" {
+		logger.Infow("initializing audit state", "file", config.File)
+		store = auditor.NewFileStateStore(config.File)
+	} else {
+		namespace := kubeClient.GetAgentNamespace()
+		logger.Infow("initializing audit state", "namespace", namespace, "configmap", config.ConfigMap)
+		store = auditor.NewConfigMapStateStore(kubeClient.ClientSet, namespace, config.ConfigMap)
+	}
+	tracker := auditor.NewAuditStateTracker(store, config.StillViolatingAfter)
+	err := tracker.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return tracker, nil
+}
+
+func initPolicyReportSink(mgr manager.Manager, kubeClient *kube.KubeClient, clusterID string) (*policy_report.PolicyReportSink, error) {
+	sink, err := policy_report.NewPolicyReportSink(kubeClient.DynamicClient, eventReportingController, clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize policy report sink: %w", err)
+	}
+
+	logger.Info("starting policy report sink ...")
+	mgr.Add(sink)
+
+	return sink, nil
+}
+
 func initElasticSearchSink(mgr manager.Manager, elasticsearchSinkConfig configuration.ElasticSink) (*elastic.ElasticSearchSink, error) {
 	if elasticsearchSinkConfig.InsertionMode != "insert" && elasticsearchSinkConfig.InsertionMode != "upsert" {
 		return nil, errors.New("failed to initialize elasticsearch sink, insertion mode should be one of two options: insert or upsert")
@@ -461,3 +862,118 @@ func initElasticSearchSink(mgr manager.Manager, elasticsearchSinkConfig configur
 
 	return sink, nil
 }
+
+// initOwnerResolver returns an owner resolver reading the owners metadata from informers of the cluster, the informers
+// are kept in their own cache so that owner kinds the agent can not watch do not block the manager cache sync
+func initOwnerResolver(mgr manager.Manager, kubeConfig *rest.Config) (*k8s.OwnerResolver, error) {
+	// the discovery is deferred to the first use so that unreachable clusters do not fail the agent start
+	mapper, err := apiutil.NewDynamicRESTMapper(kubeConfig, apiutil.WithLazyDiscovery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init rest mapper: %w", err)
+	}
+	ownersCache, err := cache.New(kubeConfig, cache.Options{Scheme: mgr.GetScheme(), Mapper: mapper})
+	if err != nil {
+		return nil, fmt.Errorf("failed to init owners cache: %w", err)
+	}
+	apiReader, err := client.New(kubeConfig, client.Options{Scheme: mgr.GetScheme(), Mapper: mapper})
+	if err != nil {
+		return nil, fmt.Errorf("failed to init owners client: %w", err)
+	}
+	if err := mgr.Add(ownersCache); err != nil {
+		return nil, fmt.Errorf("failed to add owners cache: %w", err)
+	}
+	return k8s.NewOwnerResolver(ownersCache, apiReader, mapper), nil
+}
+
+// initAuditCluster adds a remote cluster to the audit controller with its own entities sources and validator
+func initAuditCluster(
+	ctx context.Context,
+	mgr manager.Manager,
+	auditController *auditor.AuditorController,
+	clusterConfig configuration.ClusterConfig,
+	auditConfig configuration.AuditConfig,
+	sourcesFilter k8s.SourcesFilter,
+	namespaceResolvers map[string]domain.NamespaceResolver,
+	clusterContexts map[string]domain.ClusterContextSource,
+	scopeResolvers map[string]domain.ScopeResolver,
+	newClusterContext func(kubeClient *kube.KubeClient) (domain.ClusterContextSource, error),
+	initClusterSinks func(clusterID string, kubeClient *kube.KubeClient) error,
+	newValidator func() validation.Validator,
+) error {
+	if clusterConfig.ID == "" || clusterConfig.KubeConfigFile == "" {
+		return errors.New("audit clusters must specify id and kubeConfigFile")
+	}
+	logger.Infow("initializing audit cluster", "cluster", clusterConfig.ID, "context", clusterConfig.Context, "policy-set", clusterConfig.PolicySet)
+
+	kubeConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: clusterConfig.KubeConfigFile},
+		&clientcmd.ConfigOverrides{CurrentContext: clusterConfig.Context},
+	).ClientConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load Kubernetes config of cluster %s: %w", clusterConfig.ID, err)
+	}
+	kubeClient, err := kube.NewKubeClient(kubeConfig)
+	if err != nil {
+		return fmt.Errorf("init client of cluster %s failed: %w", clusterConfig.ID, err)
+	}
+	kubeClient.SetListRateLimit(auditConfig.QPS, auditConfig.Burst)
+
+	sourcesFilter.RemoteCluster = true
+	// a cluster that can not be reached is not audited until its discovery succeeds
+	entitiesSources, deniedKinds, discoveryErr := k8s.DiscoverEntitiesSources(ctx, kubeClient, sourcesFilter)
+	if discoveryErr != nil {
+		logger.Errorw("initializing entities sources of audit cluster failed, retrying", "cluster", clusterConfig.ID, "error", discoveryErr)
+	}
+
+	namespaceResolvers[clusterConfig.ID] = k8s.NewNamespaceResolver(kubeClient)
+	// the discovery is deferred to the first use so that unreachable clusters do not fail the agent start
+	mapper, err := apiutil.NewDynamicRESTMapper(kubeConfig, apiutil.WithLazyDiscovery)
+	if err != nil {
+		return fmt.Errorf("failed to init rest mapper of cluster %s: %w", clusterConfig.ID, err)
+	}
+	scopeResolvers[clusterConfig.ID] = k8s.NewScopeResolver(mapper)
+	clusterContexts[clusterConfig.ID], err = newClusterContext(kubeClient)
+	if err != nil {
+		return err
+	}
+	if err := initClusterSinks(clusterConfig.ID, kubeClient); err != nil {
+		return err
+	}
+	cluster := auditController.AddCluster(clusterConfig.ID, newValidator(), entitiesSources...)
+	cluster.SetSkippedKinds(deniedKindsReasons(deniedKinds))
+	cluster.SetUnavailable(discoveryErr)
+	if auditConfig.EvaluateOwnedEntities {
+		ownerResolver, err := initOwnerResolver(mgr, kubeConfig)
+		if err != nil {
+			return fmt.Errorf("init owner resolver of cluster %s failed: %w", clusterConfig.ID, err)
+		}
+		cluster.SetOwnerResolver(ownerResolver)
+	}
+
+	sourcesRefresher := k8s.NewSourcesRefresher(
+		kubeClient,
+		sourcesFilter,
+		auditConfig.Discovery.Interval,
+		auditConfig.Discovery.WatchCRDs,
+		entitiesSources,
+		deniedKinds,
+		func(sources []domain.EntitiesSource, deniedKinds []string) {
+			cluster.SetEntitiesSources(sources...)
+			cluster.SetSkippedKinds(deniedKindsReasons(deniedKinds))
+			cluster.SetUnavailable(nil)
+		},
+	)
+	if discoveryErr != nil {
+		sourcesRefresher.SetDiscoveryFailed()
+	}
+	return mgr.Add(sourcesRefresher)
+}
+
+// deniedKindsReasons returns the kinds skipped by the audit due to missing permissions
+func deniedKindsReasons(deniedKinds []string) map[string]string {
+	skippedKinds := make(map[string]string, len(deniedKinds))
+	for _, kind := range deniedKinds {
+		skippedKinds[kind] = auditor.SkipReasonRBACDenied
+	}
+	return skippedKinds
+}
@@ -48,11 +48,26 @@ func Parse(content, ruleQuery string) (Policy, error) {
 	return policy, nil
 }
 
+// Compile compiles the policy module and returns the errors reported before evaluation such as unsafe variables
+func (p Policy) Compile() error {
+	compiler := ast.NewCompiler()
+	compiler.Compile(map[string]*ast.Module{p.pkg: p.module})
+	if compiler.Failed() {
+		return compiler.Errors
+	}
+	return nil
+}
+
+// Rule returns the reference of the query rule of the policy package
+func (p Policy) Rule(query string) string {
+	return fmt.Sprintf("data.%s.%s", p.pkg, query)
+}
+
 // Eval validates data against given policy
 // returns error if there're any violations found
 func (p Policy) Eval(data interface{}, query string) error {
 	rego := rego.New(
-		rego.Query(fmt.Sprintf("data.%s.%s", p.pkg, query)),
+		rego.Query(p.Rule(query)),
 		rego.ParsedModule(p.module),
 		rego.Input(data),
 	)
@@ -85,6 +85,53 @@ type testCaseEval struct {
 	hasViolation bool
 }
 
+func TestCompile(t *testing.T) {
+	cases := []testCaseParsePolicy{
+		{
+			name: "valid policy",
+			content: `
+			package weave.core
+			violation[issue] {
+				issue = input.review.name
+			}`,
+		},
+		{
+			name: "unsafe variable",
+			content: `
+			package weave.core
+			violation[issue] {
+				issue == "test"
+			}`,
+			hasError: true,
+		},
+		{
+			name: "undefined function",
+			content: `
+			package weave.core
+			violation[issue] {
+				issue = missing(input.review.name)
+			}`,
+			hasError: true,
+		},
+	}
+
+	for _, c := range cases {
+		policy, err := Parse(c.content, "violation")
+		if err != nil {
+			t.Fatalf("[%s]: failed to parse policy: %v", c.name, err)
+		}
+		if rule := policy.Rule("violation"); rule != "data.weave.core.violation" {
+			t.Errorf("[%s]: unexpected rule %s", c.name, rule)
+		}
+		err = policy.Compile()
+		if c.hasError && err == nil {
+			t.Errorf("[%s]: compiled but should have failed", c.name)
+		} else if !c.hasError && err != nil {
+			t.Errorf("[%s]: %v", c.name, err)
+		}
+	}
+}
+
 func TestEval(t *testing.T) {
 	cases := []testCaseEval{
 		{
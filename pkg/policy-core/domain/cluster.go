@@ -0,0 +1,30 @@
+package domain
+
+// ClusterContext describes the cluster of the validated entities
+type ClusterContext struct {
+	// Version is the kubernetes version of the cluster such as v1.27.3
+	Version string `json:"version"`
+	Major   int    `json:"major"`
+	Minor   int    `json:"minor"`
+	// Provider is the cloud provider of the cluster nodes such as aws or gce
+	Provider     string `json:"provider"`
+	NodeCount    int    `json:"node_count"`
+	AgentVersion string `json:"agent_version"`
+}
+
+// ValidationMetadata is the metadata of the kubernetes validation results
+type ValidationMetadata struct {
+	Cluster *ClusterContext `json:"cluster,omitempty"`
+}
+
+// ToMap returns the cluster context as the input.cluster of the policies
+func (c ClusterContext) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"version":       c.Version,
+		"major":         c.Major,
+		"minor":         c.Minor,
+		"provider":      c.Provider,
+		"node_count":    c.NodeCount,
+		"agent_version": c.AgentVersion,
+	}
+}
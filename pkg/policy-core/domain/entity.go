@@ -18,8 +18,33 @@ type Entity struct {
 	Manifest        map[string]interface{} `json:"manifest"`
 	ResourceVersion string                 `json:"resource_version"`
 	Labels          map[string]string      `json:"-"`
-	GitCommit       string                 `json:"-"`
+	GitCommit       string                 `json:"git_commit,omitempty"`
+	File            string                 `json:"file,omitempty"`
+	Line            int                    `json:"line,omitempty"`
 	HasParent       bool                   `json:"has_parent"`
+	Owner           *EntityOwner           `json:"owner,omitempty"`
+}
+
+// EntityOwner is the top level controller of an entity, e.g. the deployment owning a pod through its replicaset
+type EntityOwner struct {
+	ID         string `json:"id"`
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	Namespace  string `json:"namespace"`
+	// Controllers are the api version qualified kinds of the owners between the entity and the top level owner, e.g. apps/v1/ReplicaSet
+	Controllers []string `json:"controllers,omitempty"`
+}
+
+// ObjectRef returns the kubernetes object reference of the owner
+func (o *EntityOwner) ObjectRef() *v1.ObjectReference {
+	return &v1.ObjectReference{
+		APIVersion: o.APIVersion,
+		Kind:       o.Kind,
+		UID:        types.UID(o.ID),
+		Name:       o.Name,
+		Namespace:  o.Namespace,
+	}
 }
 
 // ObjectRef returns the kubernetes object reference of the entity
@@ -14,3 +14,27 @@ type PolicyValidationSink interface {
 	// Write saves the results
 	Write(ctx context.Context, PolicyValidations []PolicyValidation) error
 }
+
+// OwnerResolver finds the top level owner of entities that have owner references
+type OwnerResolver interface {
+	// Resolve returns the top level owner of the entity or nil if the entity has no owner
+	Resolve(ctx context.Context, entity Entity) (*EntityOwner, error)
+}
+
+// NamespaceResolver gets the namespaces of entities
+type NamespaceResolver interface {
+	// GetNamespace returns the namespace object or nil if the namespace does not exist
+	GetNamespace(ctx context.Context, name string) (map[string]interface{}, error)
+}
+
+// ScopeResolver gets the scope of the kinds of entities
+type ScopeResolver interface {
+	// IsNamespaced checks if the entities of the kind of the api version are namespaced
+	IsNamespaced(apiVersion, kind string) (bool, error)
+}
+
+// ClusterContextSource gets the context of the cluster of the validated entities
+type ClusterContextSource interface {
+	// GetClusterContext returns the latest collected cluster context or nil if it was not collected yet
+	GetClusterContext() *ClusterContext
+}
@@ -1,14 +1,39 @@
 package domain
 
 import (
+	"context"
+	"regexp"
+	"time"
+
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// PolicyTargetsClusterScope targets the cluster scoped entities only
+	PolicyTargetsClusterScope = "Cluster"
+	// PolicyTargetsNamespacedScope targets the namespaced entities only
+	PolicyTargetsNamespacedScope = "Namespaced"
 )
 
 // PolicyTargets is used to match entities with the required fields specified by the policy
 type PolicyTargets struct {
-	Kinds      []string            `json:"kinds"`
-	Labels     []map[string]string `json:"labels"`
-	Namespaces []string            `json:"namespaces"`
+	Kinds           []string            `json:"kinds"`
+	Labels          []map[string]string `json:"labels"`
+	Namespaces      []string            `json:"namespaces"`
+	NamespaceLabels []map[string]string `json:"namespace_labels,omitempty"`
+	// LabelSelector is matched against the entity labels in addition to the labels
+	LabelSelector *metav1.LabelSelector `json:"label_selector,omitempty"`
+	// ParsedLabelSelector is the label selector parsed when the policy is loaded, the label selector is parsed for each
+	// entity when it is not set
+	ParsedLabelSelector labels.Selector `json:"-"`
+	// APIGroups are the api groups of the entity, "" is the core group and "*" any group
+	APIGroups []string `json:"api_groups,omitempty"`
+	// Names are glob patterns of the entity name
+	Names []string `json:"names,omitempty"`
+	// Scope is either Cluster or Namespaced, empty or "*" matches both
+	Scope string `json:"scope,omitempty"`
 }
 
 // PolicyParameters defines a needed input in a policy
@@ -27,9 +52,24 @@ type PolicyStandard struct {
 
 // PolicyExclusions are the structure which resources should not be evaluated against the policy
 type PolicyExclusions struct {
-	Namespaces []string          `json:"namespaces"`
-	Resources  []string          `json:"resources"`
-	Labels     map[string]string `json:"labels"`
+	Namespaces []string               `json:"namespaces"`
+	Resources  []string               `json:"resources"`
+	Labels     map[string]string      `json:"labels"`
+	Entries    []PolicyExclusionEntry `json:"entries,omitempty"`
+}
+
+// PolicyExclusionEntry excludes the entities matching its kind, namespace and name patterns until it expires,
+// an empty pattern matches any value
+type PolicyExclusionEntry struct {
+	Kind      string     `json:"kind,omitempty"`
+	Namespace string     `json:"namespace,omitempty"`
+	Name      string     `json:"name,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Expired checks if the exclusion entry expired at the given time
+func (e PolicyExclusionEntry) Expired(now time.Time) bool {
+	return e.ExpiresAt != nil && !now.Before(*e.ExpiresAt)
 }
 
 // Policy represents a policy
@@ -50,6 +90,18 @@ type Policy struct {
 	GitCommit   string             `json:"git_commit,omitempty"`
 	Mutate      bool               `json:"mutate"`
 	Exclude     PolicyExclusions   `json:"exclude"`
+	// Sandboxed policies are written by tenants, they are evaluated without the network builtins and with a deadline
+	Sandboxed bool `json:"-"`
+	// ParsedPatterns are the regular expressions of the target names and exclusions parsed when the policy is loaded by
+	// pattern, the regular expressions are compiled for each entity when not set
+	ParsedPatterns map[string]*regexp.Regexp `json:"-"`
+	// Evaluator is the sandboxed policy compiled when the policy is loaded, the code is compiled for each entity when nil
+	Evaluator PolicyEvaluator `json:"-"`
+}
+
+// PolicyEvaluator evaluates a prepared policy against the input and returns its violations as an error
+type PolicyEvaluator interface {
+	Eval(ctx context.Context, input interface{}) error
 }
 
 // ObjectRef returns the kubernetes object reference of the policy
@@ -143,6 +143,30 @@ func NewK8sEventFromPolicyValidation(result PolicyValidation) (*v1.Event, error)
 		"enforce":         fmt.Sprint(result.Policy.Enforce),
 	}
 
+	if result.Entity.Owner != nil {
+		owner, err := json.Marshal(result.Entity.Owner)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse policy validation entity owner: %w", err)
+		}
+		annotations["entity_owner"] = string(owner)
+	}
+
+	if result.Entity.GitCommit != "" {
+		annotations["entity_git_commit"] = result.Entity.GitCommit
+	}
+	if result.Entity.File != "" {
+		annotations["entity_file"] = result.Entity.File
+		annotations["entity_line"] = strconv.Itoa(result.Entity.Line)
+	}
+
+	if metadata, ok := result.Metadata.(ValidationMetadata); ok && metadata.Cluster != nil {
+		cluster, err := json.Marshal(metadata.Cluster)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse policy validation cluster context: %w", err)
+		}
+		annotations["cluster"] = string(cluster)
+	}
+
 	namespace := result.Entity.Namespace
 	if namespace == "" {
 		namespace = metav1.NamespaceDefault
@@ -222,8 +246,16 @@ func NewPolicyValidationFRomK8sEvent(event *v1.Event) (PolicyValidation, error)
 			Name:            event.InvolvedObject.Name,
 			Namespace:       event.InvolvedObject.Namespace,
 			ResourceVersion: event.InvolvedObject.ResourceVersion,
+			GitCommit:       annotations["entity_git_commit"],
+			File:            annotations["entity_file"],
 		},
 	}
+	if line, ok := annotations["entity_line"]; ok {
+		policyValidation.Entity.Line, err = strconv.Atoi(line)
+		if err != nil {
+			return policyValidation, fmt.Errorf("failed to get entity line from event: %w", err)
+		}
+	}
 	err = json.Unmarshal([]byte(annotations["standards"]), &policyValidation.Policy.Standards)
 	if err != nil {
 		return policyValidation, fmt.Errorf("failed to get standards from event: %w", err)
@@ -236,6 +268,20 @@ func NewPolicyValidationFRomK8sEvent(event *v1.Event) (PolicyValidation, error)
 	if err != nil {
 		return policyValidation, fmt.Errorf("failed to get occurrences from event: %w", err)
 	}
+	if _, ok := annotations["entity_owner"]; ok {
+		err = json.Unmarshal([]byte(annotations["entity_owner"]), &policyValidation.Entity.Owner)
+		if err != nil {
+			return policyValidation, fmt.Errorf("failed to get entity owner from event: %w", err)
+		}
+	}
+	if _, ok := annotations["cluster"]; ok {
+		var cluster ClusterContext
+		err = json.Unmarshal([]byte(annotations["cluster"]), &cluster)
+		if err != nil {
+			return policyValidation, fmt.Errorf("failed to get cluster context from event: %w", err)
+		}
+		policyValidation.Metadata = ValidationMetadata{Cluster: &cluster}
+	}
 	if _, ok := annotations["parameters"]; ok {
 		err = json.Unmarshal([]byte(annotations["parameters"]), &policyValidation.Policy.Parameters)
 		if err != nil {
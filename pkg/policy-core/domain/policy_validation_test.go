@@ -243,3 +243,100 @@ func TestEventToPolicy(t *testing.T) {
 		PolicyValidationTriggerLabel: policyValidation.Trigger,
 	})
 }
+
+// newTestPolicyValidation returns a violation of a deployment
+func newTestPolicyValidation() PolicyValidation {
+	return PolicyValidation{
+		Policy: Policy{
+			ID: uuid.NewV4().String(),
+		},
+		Entity: Entity{
+			ID:         uuid.NewV4().String(),
+			APIVersion: "apps/v1",
+			Kind:       "Deployment",
+			Name:       "nginx",
+			Namespace:  "default",
+			Manifest:   map[string]interface{}{},
+		},
+		Status: PolicyValidationStatusViolating,
+	}
+}
+
+func TestPolicyValidationEventAnnotations(t *testing.T) {
+	owned := newTestPolicyValidation()
+	owned.Entity.APIVersion = "v1"
+	owned.Entity.Kind = "Pod"
+	owned.Entity.Name = "nginx-5d59d67564-kbl7b"
+	owned.Entity.HasParent = true
+	owned.Entity.Owner = &EntityOwner{
+		ID:         uuid.NewV4().String(),
+		APIVersion: "apps/v1",
+		Kind:       "Deployment",
+		Name:       "nginx",
+		Namespace:  "default",
+	}
+	gitSource := newTestPolicyValidation()
+	gitSource.Entity.GitCommit = "3f786850e387550fdab836ed7e6dc881de23001b"
+	gitSource.Entity.File = "apps/nginx.yaml"
+	gitSource.Entity.Line = 12
+	cluster := newTestPolicyValidation()
+	cluster.Metadata = ValidationMetadata{
+		Cluster: &ClusterContext{
+			Version:      "v1.27.3",
+			Major:        1,
+			Minor:        27,
+			Provider:     "aws",
+			NodeCount:    3,
+			AgentVersion: "1.1.0",
+		},
+	}
+
+	cases := []struct {
+		name        string
+		result      PolicyValidation
+		annotations map[string]string
+		// absent are the annotations left out of the event
+		absent []string
+	}{
+		{
+			name:   "entity owner",
+			result: owned,
+			absent: []string{"entity_git_commit", "cluster"},
+		},
+		{
+			name:   "entity git source",
+			result: gitSource,
+			annotations: map[string]string{
+				"entity_git_commit": gitSource.Entity.GitCommit,
+				"entity_line":       "12",
+			},
+			absent: []string{"entity_owner", "cluster"},
+		},
+		{
+			name:   "cluster context",
+			result: cluster,
+			absent: []string{"entity_owner", "entity_git_commit"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			event, err := NewK8sEventFromPolicyValidation(c.result)
+			assert.Nil(t, err)
+			for key, value := range c.annotations {
+				assert.Equal(t, value, event.Annotations[key])
+			}
+			for _, key := range c.absent {
+				assert.NotContains(t, event.Annotations, key)
+			}
+
+			policyValidation, err := NewPolicyValidationFRomK8sEvent(event)
+			assert.Nil(t, err)
+			assert.Equal(t, c.result.Entity.Owner, policyValidation.Entity.Owner)
+			assert.Equal(t, c.result.Entity.GitCommit, policyValidation.Entity.GitCommit)
+			assert.Equal(t, c.result.Entity.File, policyValidation.Entity.File)
+			assert.Equal(t, c.result.Entity.Line, policyValidation.Entity.Line)
+			assert.Equal(t, c.result.Metadata, policyValidation.Metadata)
+		})
+	}
+}
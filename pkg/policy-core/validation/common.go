@@ -2,33 +2,39 @@ package validation
 
 import (
 	"context"
-	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	k8slabels "k8s.io/apimachinery/pkg/labels"
 )
 
-func matchEntity(entity domain.Entity, policy domain.Policy) bool {
-	var matchKind bool
-	var matchNamespace bool
-	var matchLabel bool
+// RegexPatternPrefix marks the exclusion patterns that are regular expressions instead of globs
+const RegexPatternPrefix = "regex:"
 
-	if len(policy.Targets.Kinds) == 0 {
-		matchKind = true
-	} else {
-		resourceKind := entity.Kind
-		for _, kind := range policy.Targets.Kinds {
-			if resourceKind == kind {
-				matchKind = true
-				break
-			}
-		}
+// MatchTargets checks if the entity matches the policy targets, namespace label targets need the entity namespace object,
+// entities without namespace are matched as cluster scoped
+func MatchTargets(entity domain.Entity, namespace map[string]interface{}, policy domain.Policy) bool {
+	return matchTargets(entity, namespace, entity.Namespace != "", policy)
+}
+
+// matchTargets checks if the entity matches the policy targets with the scope of the entity kind
+func matchTargets(entity domain.Entity, namespace map[string]interface{}, namespaced bool, policy domain.Policy) bool {
+	targets := policy.Targets
+	if !MatchKinds(targets.Kinds, entity.APIVersion, entity.Kind) || !matchAPIGroups(targets.APIGroups, entity.APIVersion) {
+		return false
 	}
 
-	if len(policy.Targets.Namespaces) == 0 {
+	var matchNamespace bool
+	if len(targets.Namespaces) == 0 {
 		matchNamespace = true
 	} else {
 		resourceNamespace := entity.Namespace
-		for _, namespace := range policy.Targets.Namespaces {
+		for _, namespace := range targets.Namespaces {
 			if resourceNamespace == namespace {
 				matchNamespace = true
 				break
@@ -36,39 +42,153 @@ func matchEntity(entity domain.Entity, policy domain.Policy) bool {
 		}
 	}
 
-	if len(policy.Targets.Labels) == 0 {
-		matchLabel = true
-	} else {
-	outer:
-		for _, obj := range policy.Targets.Labels {
-			for key, val := range obj {
-				entityVal, ok := entity.Labels[key]
-				if ok {
-					if val != "*" && val != entityVal {
-						continue
-					}
-					matchLabel = true
-					break outer
+	matchLabel := matchLabels(entity.Labels, targets.Labels) && matchLabelSelector(entity.Labels, targets)
+
+	matchNamespaceLabel := true
+	if len(targets.NamespaceLabels) != 0 {
+		namespaceObject := unstructured.Unstructured{Object: namespace}
+		matchNamespaceLabel = namespace != nil && matchLabels(namespaceObject.GetLabels(), targets.NamespaceLabels)
+	}
+
+	return matchNamespace && matchLabel && matchNamespaceLabel &&
+		matchScope(targets.Scope, namespaced) && matchNames(policy.ParsedPatterns, targets.Names, entity.Name)
+}
+
+// evaluatedByOwner checks if the policy targets the kind of an owner of the entity, the policy is then evaluated against
+// the owner and its violations are reported against the owner once instead of once for each owned entity
+func evaluatedByOwner(entity domain.Entity, policy domain.Policy) bool {
+	owner := entity.Owner
+	if owner == nil {
+		return false
+	}
+	if MatchKinds(policy.Targets.Kinds, owner.APIVersion, owner.Kind) {
+		return true
+	}
+	for _, controller := range owner.Controllers {
+		i := strings.LastIndex(controller, "/")
+		if i > 0 && MatchKinds(policy.Targets.Kinds, controller[:i], controller[i+1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchKinds checks if the kind is one of the target kinds, a target kind is either a kind or a kind qualified
+// by its api version such as apps/v1/Deployment, no target kinds match all kinds
+func MatchKinds(kinds []string, apiVersion, kind string) bool {
+	if len(kinds) == 0 {
+		return true
+	}
+	for _, target := range kinds {
+		if target == kind || target == apiVersion+"/"+kind {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAPIGroups checks if the group of the api version is one of the target groups, "" is the core group
+func matchAPIGroups(groups []string, apiVersion string) bool {
+	if len(groups) == 0 {
+		return true
+	}
+	group := ""
+	if i := strings.LastIndex(apiVersion, "/"); i >= 0 {
+		group = apiVersion[:i]
+	}
+	for _, target := range groups {
+		if target == "*" || target == group {
+			return true
+		}
+	}
+	return false
+}
+
+// matchLabelSelector checks if the labels match the kubernetes label selector of the targets, invalid selectors match nothing
+func matchLabelSelector(labels map[string]string, targets domain.PolicyTargets) bool {
+	if targets.LabelSelector == nil {
+		return true
+	}
+	labelSelector := targets.ParsedLabelSelector
+	if labelSelector == nil {
+		labelSelector = ParseLabelSelector(targets.LabelSelector)
+	}
+	return labelSelector.Matches(k8slabels.Set(labels))
+}
+
+// ParseLabelSelector returns the selector of the policy targets label selector, invalid selectors match nothing
+func ParseLabelSelector(selector *metav1.LabelSelector) k8slabels.Selector {
+	labelSelector, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return k8slabels.Nothing()
+	}
+	return labelSelector
+}
+
+// matchScope checks if the entity is cluster scoped or namespaced as required by the scope
+func matchScope(scope string, namespaced bool) bool {
+	switch scope {
+	case domain.PolicyTargetsClusterScope:
+		return !namespaced
+	case domain.PolicyTargetsNamespacedScope:
+		return namespaced
+	}
+	return true
+}
+
+// matchNames checks if the name matches any of the glob or regular expression patterns
+func matchNames(parsed map[string]*regexp.Regexp, patterns []string, name string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if matchPattern(parsed, pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchLabels checks if the labels have any of the targets labels, * matches any value of the label
+func matchLabels(labels map[string]string, targets []map[string]string) bool {
+	if len(targets) == 0 {
+		return true
+	}
+	for _, obj := range targets {
+		for key, val := range obj {
+			labelVal, ok := labels[key]
+			if ok {
+				if val != "*" && val != labelVal {
+					continue
 				}
+				return true
 			}
 		}
 	}
-
-	return matchKind && matchNamespace && matchLabel
+	return false
 }
 
-// isExcluded evaluates the policy exclusion against the requested entity
-func isExcluded(entity domain.Entity, policy domain.Policy) bool {
-	resourceNamespace := entity.Namespace
+// isExcluded evaluates the policy exclusion against the requested entity, expired exclusion entries are ignored.
+// Namespace patterns match only namespaced entities, cluster scoped entities are excluded by resources with an empty
+// namespace such as Namespace//kube-system or by entries without namespace
+func isExcluded(entity domain.Entity, policy domain.Policy, now time.Time) bool {
 	for _, namespace := range policy.Exclude.Namespaces {
-		if resourceNamespace == namespace {
+		if matchNamespacePattern(policy.ParsedPatterns, namespace, entity.Namespace) {
 			return true
 		}
 	}
 
-	resourceName := fmt.Sprintf("%s/%s", entity.Namespace, entity.Name)
 	for _, resource := range policy.Exclude.Resources {
-		if resourceName == resource {
+		kind, namespace, name, ok := ParseExcludedResource(resource)
+		if !ok {
+			continue
+		}
+		matchNamespace := entity.Namespace == ""
+		if namespace != "" {
+			matchNamespace = matchNamespacePattern(policy.ParsedPatterns, namespace, entity.Namespace)
+		}
+		if (kind == "" || matchPattern(policy.ParsedPatterns, kind, entity.Kind)) && matchNamespace &&
+			matchPattern(policy.ParsedPatterns, name, entity.Name) {
 			return true
 		}
 	}
@@ -83,9 +203,109 @@ func isExcluded(entity domain.Entity, policy domain.Policy) bool {
 		}
 	}
 
+	for _, entry := range policy.Exclude.Entries {
+		if entry.Expired(now) {
+			continue
+		}
+		if (entry.Kind == "" || matchPattern(policy.ParsedPatterns, entry.Kind, entity.Kind)) &&
+			(entry.Namespace == "" || matchNamespacePattern(policy.ParsedPatterns, entry.Namespace, entity.Namespace)) &&
+			(entry.Name == "" || matchPattern(policy.ParsedPatterns, entry.Name, entity.Name)) {
+			return true
+		}
+	}
+
 	return false
 }
 
+// matchNamespacePattern checks if the namespace of a namespaced entity matches the pattern, cluster scoped entities
+// have no namespace and match no namespace pattern
+func matchNamespacePattern(parsed map[string]*regexp.Regexp, pattern, namespace string) bool {
+	return namespace != "" && matchPattern(parsed, pattern, namespace)
+}
+
+// ParseExcludedResource splits an excluded resource, namespace/name or kind/namespace/name, into its patterns
+func ParseExcludedResource(resource string) (kind, namespace, name string, ok bool) {
+	parts := strings.Split(resource, "/")
+	switch len(parts) {
+	case 2:
+		return "", parts[0], parts[1], true
+	case 3:
+		return parts[0], parts[1], parts[2], true
+	}
+	return "", "", "", false
+}
+
+// MatchPattern checks if the value matches the pattern, a glob pattern or a regular expression prefixed with regex:,
+// invalid patterns match nothing
+func MatchPattern(pattern, value string) bool {
+	return matchPattern(nil, pattern, value)
+}
+
+// matchPattern matches the value with the regular expressions parsed when the policy is loaded, the regular expressions
+// that were not parsed are compiled for each match
+func matchPattern(parsed map[string]*regexp.Regexp, pattern, value string) bool {
+	if expr, ok := strings.CutPrefix(pattern, RegexPatternPrefix); ok {
+		re, ok := parsed[pattern]
+		if !ok {
+			re = compilePattern(expr)
+		}
+		return re != nil && re.MatchString(value)
+	}
+	ok, _ := path.Match(pattern, value)
+	return ok
+}
+
+// compilePattern compiles the regular expression matching whole values, nil is returned for invalid expressions
+func compilePattern(expr string) *regexp.Regexp {
+	re, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return nil
+	}
+	return re
+}
+
+// ParsePatterns returns the regular expressions of the policy target names and exclusions by pattern, invalid
+// expressions are kept as nil and match nothing
+func ParsePatterns(policy domain.Policy) map[string]*regexp.Regexp {
+	patterns := append([]string{}, policy.Targets.Names...)
+	patterns = append(patterns, policy.Exclude.Namespaces...)
+	for _, resource := range policy.Exclude.Resources {
+		kind, namespace, name, ok := ParseExcludedResource(resource)
+		if ok {
+			patterns = append(patterns, kind, namespace, name)
+		}
+	}
+	for _, entry := range policy.Exclude.Entries {
+		patterns = append(patterns, entry.Kind, entry.Namespace, entry.Name)
+	}
+
+	var parsed map[string]*regexp.Regexp
+	for _, pattern := range patterns {
+		expr, ok := strings.CutPrefix(pattern, RegexPatternPrefix)
+		if !ok {
+			continue
+		}
+		if _, ok := parsed[pattern]; ok {
+			continue
+		}
+		if parsed == nil {
+			parsed = make(map[string]*regexp.Regexp)
+		}
+		parsed[pattern] = compilePattern(expr)
+	}
+	return parsed
+}
+
+// ValidatePattern checks the glob pattern or regular expression is well formed
+func ValidatePattern(pattern string) error {
+	if expr, ok := strings.CutPrefix(pattern, RegexPatternPrefix); ok {
+		_, err := regexp.Compile("^(?:" + expr + ")$")
+		return err
+	}
+	_, err := path.Match(pattern, "")
+	return err
+}
+
 func writeToSinks(
 	ctx context.Context,
 	resultsSinks []domain.PolicyValidationSink,
@@ -0,0 +1,373 @@
+package validation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8slabels "k8s.io/apimachinery/pkg/labels"
+)
+
+func TestMatchTargets(t *testing.T) {
+	deployment := domain.Entity{
+		APIVersion: "apps/v1",
+		Kind:       "Deployment",
+		Name:       "frontend-api",
+		Namespace:  "prod",
+		Labels:     map[string]string{"app": "frontend", "tier": "web"},
+	}
+	namespace := domain.Entity{
+		APIVersion: "v1",
+		Kind:       "Namespace",
+		Name:       "prod",
+	}
+
+	tests := []struct {
+		name    string
+		entity  domain.Entity
+		targets domain.PolicyTargets
+		match   bool
+	}{
+		{
+			name:   "no targets",
+			entity: deployment,
+			match:  true,
+		},
+		{
+			name:    "kind",
+			entity:  deployment,
+			targets: domain.PolicyTargets{Kinds: []string{"Deployment"}},
+			match:   true,
+		},
+		{
+			name:    "kind qualified by api version",
+			entity:  deployment,
+			targets: domain.PolicyTargets{Kinds: []string{"apps/v1/Deployment"}},
+			match:   true,
+		},
+		{
+			name:    "kind qualified by other api version",
+			entity:  deployment,
+			targets: domain.PolicyTargets{Kinds: []string{"apps/v1beta1/Deployment"}},
+		},
+		{
+			name:    "api group",
+			entity:  deployment,
+			targets: domain.PolicyTargets{APIGroups: []string{"apps"}},
+			match:   true,
+		},
+		{
+			name:    "core api group",
+			entity:  namespace,
+			targets: domain.PolicyTargets{APIGroups: []string{""}},
+			match:   true,
+		},
+		{
+			name:    "other api group",
+			entity:  deployment,
+			targets: domain.PolicyTargets{APIGroups: []string{"", "batch"}},
+		},
+		{
+			name:    "any api group",
+			entity:  deployment,
+			targets: domain.PolicyTargets{APIGroups: []string{"*"}},
+			match:   true,
+		},
+		{
+			name:   "label selector expressions",
+			entity: deployment,
+			targets: domain.PolicyTargets{LabelSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": "frontend"},
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: "tier", Operator: metav1.LabelSelectorOpIn, Values: []string{"web", "api"}},
+					{Key: "legacy", Operator: metav1.LabelSelectorOpDoesNotExist},
+				},
+			}},
+			match: true,
+		},
+		{
+			name:   "label selector not matching",
+			entity: deployment,
+			targets: domain.PolicyTargets{LabelSelector: &metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: "tier", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"web"}},
+				},
+			}},
+		},
+		{
+			name:   "label selector and labels",
+			entity: deployment,
+			targets: domain.PolicyTargets{
+				Labels:        []map[string]string{{"app": "backend"}},
+				LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "web"}},
+			},
+		},
+		{
+			name:   "invalid label selector",
+			entity: deployment,
+			targets: domain.PolicyTargets{LabelSelector: &metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "tier", Operator: "Contains"}},
+			}},
+		},
+		{
+			name:   "parsed label selector is used instead of the label selector",
+			entity: deployment,
+			targets: domain.PolicyTargets{
+				LabelSelector:       &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "web"}},
+				ParsedLabelSelector: k8slabels.Nothing(),
+			},
+		},
+		{
+			name:    "name glob",
+			entity:  deployment,
+			targets: domain.PolicyTargets{Names: []string{"backend-*", "frontend-*"}},
+			match:   true,
+		},
+		{
+			name:    "name regex",
+			entity:  deployment,
+			targets: domain.PolicyTargets{Names: []string{"regex:(backend|frontend)-.+"}},
+			match:   true,
+		},
+		{
+			name:    "name glob not matching",
+			entity:  deployment,
+			targets: domain.PolicyTargets{Names: []string{"*-worker"}},
+		},
+		{
+			name:    "namespaced scope",
+			entity:  deployment,
+			targets: domain.PolicyTargets{Scope: domain.PolicyTargetsNamespacedScope},
+			match:   true,
+		},
+		{
+			name:    "cluster scope",
+			entity:  deployment,
+			targets: domain.PolicyTargets{Scope: domain.PolicyTargetsClusterScope},
+		},
+		{
+			name:    "cluster scoped entity",
+			entity:  namespace,
+			targets: domain.PolicyTargets{Scope: domain.PolicyTargetsClusterScope, Names: []string{"prod"}},
+			match:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.match, MatchTargets(tt.entity, nil, domain.Policy{Targets: tt.targets}))
+		})
+	}
+}
+
+func TestIsExcluded(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+	deployment := domain.Entity{
+		Kind:      "Deployment",
+		Name:      "frontend-api",
+		Namespace: "team-a-prod",
+		Labels:    map[string]string{"app": "frontend"},
+	}
+	namespace := domain.Entity{
+		Kind: "Namespace",
+		Name: "team-a-prod",
+	}
+
+	tests := []struct {
+		name     string
+		entity   domain.Entity
+		exclude  domain.PolicyExclusions
+		excluded bool
+	}{
+		{
+			name:   "no exclusions",
+			entity: deployment,
+		},
+		{
+			name:     "namespace",
+			entity:   deployment,
+			exclude:  domain.PolicyExclusions{Namespaces: []string{"team-a-prod"}},
+			excluded: true,
+		},
+		{
+			name:     "namespace glob",
+			entity:   deployment,
+			exclude:  domain.PolicyExclusions{Namespaces: []string{"team-*"}},
+			excluded: true,
+		},
+		{
+			name:     "namespace regex",
+			entity:   deployment,
+			exclude:  domain.PolicyExclusions{Namespaces: []string{"regex:team-[a-z]+-(prod|staging)"}},
+			excluded: true,
+		},
+		{
+			name:    "namespace regex is anchored",
+			entity:  deployment,
+			exclude: domain.PolicyExclusions{Namespaces: []string{"regex:team-a"}},
+		},
+		{
+			name:    "cluster scoped entity and namespace glob",
+			entity:  namespace,
+			exclude: domain.PolicyExclusions{Namespaces: []string{"*"}},
+		},
+		{
+			name:     "resource",
+			entity:   deployment,
+			exclude:  domain.PolicyExclusions{Resources: []string{"team-a-prod/frontend-api"}},
+			excluded: true,
+		},
+		{
+			name:     "resource name glob",
+			entity:   deployment,
+			exclude:  domain.PolicyExclusions{Resources: []string{"team-a-prod/frontend-*"}},
+			excluded: true,
+		},
+		{
+			name:     "kind qualified resource",
+			entity:   deployment,
+			exclude:  domain.PolicyExclusions{Resources: []string{"Deployment/*/frontend-api"}},
+			excluded: true,
+		},
+		{
+			name:    "resource of other kind",
+			entity:  deployment,
+			exclude: domain.PolicyExclusions{Resources: []string{"StatefulSet/*/frontend-api"}},
+		},
+		{
+			name:     "cluster scoped resource",
+			entity:   namespace,
+			exclude:  domain.PolicyExclusions{Resources: []string{"Namespace//team-*"}},
+			excluded: true,
+		},
+		{
+			name:    "cluster scoped entity and resource namespace glob",
+			entity:  namespace,
+			exclude: domain.PolicyExclusions{Resources: []string{"Namespace/*/team-*"}},
+		},
+		{
+			name:    "namespaced entity and cluster scoped resource",
+			entity:  deployment,
+			exclude: domain.PolicyExclusions{Resources: []string{"Deployment//frontend-api"}},
+		},
+		{
+			name:     "entry",
+			entity:   deployment,
+			exclude:  domain.PolicyExclusions{Entries: []domain.PolicyExclusionEntry{{Kind: "Deployment", Name: "frontend-*", ExpiresAt: &future}}},
+			excluded: true,
+		},
+		{
+			name:    "expired entry",
+			entity:  deployment,
+			exclude: domain.PolicyExclusions{Entries: []domain.PolicyExclusionEntry{{Kind: "Deployment", Name: "frontend-*", ExpiresAt: &past}}},
+		},
+		{
+			name:     "cluster scoped entity and entry without namespace",
+			entity:   namespace,
+			exclude:  domain.PolicyExclusions{Entries: []domain.PolicyExclusionEntry{{Kind: "Namespace", Name: "team-*"}}},
+			excluded: true,
+		},
+		{
+			name:    "cluster scoped entity and entry namespace glob",
+			entity:  namespace,
+			exclude: domain.PolicyExclusions{Entries: []domain.PolicyExclusionEntry{{Namespace: "*", Name: "team-*"}}},
+		},
+		{
+			name:    "entry of other namespace",
+			entity:  deployment,
+			exclude: domain.PolicyExclusions{Entries: []domain.PolicyExclusionEntry{{Namespace: "regex:team-b-.*"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := domain.Policy{Exclude: tt.exclude}
+			require.Equal(t, tt.excluded, isExcluded(tt.entity, policy, now))
+			policy.ParsedPatterns = ParsePatterns(policy)
+			require.Equal(t, tt.excluded, isExcluded(tt.entity, policy, now), "with parsed patterns")
+		})
+	}
+}
+
+func TestParsePatterns(t *testing.T) {
+	policy := domain.Policy{
+		Targets: domain.PolicyTargets{Names: []string{"backend-*", "regex:(backend|frontend)-.+"}},
+		Exclude: domain.PolicyExclusions{
+			Namespaces: []string{"regex:team-[a-z]+"},
+			Resources:  []string{"regex:Deploy.*/kube-system/regex:(core", "kube-system/coredns"},
+			Entries:    []domain.PolicyExclusionEntry{{Namespace: "regex:team-[a-z]+"}},
+		},
+	}
+	parsed := ParsePatterns(policy)
+	require.Len(t, parsed, 4)
+	require.True(t, parsed["regex:(backend|frontend)-.+"].MatchString("backend-api"))
+	require.True(t, parsed["regex:Deploy.*"].MatchString("Deployment"))
+	// invalid regular expressions match nothing
+	require.Contains(t, parsed, "regex:(core")
+	require.Nil(t, parsed["regex:(core"])
+	require.False(t, matchPattern(parsed, "regex:(core", "(core"))
+
+	require.Nil(t, ParsePatterns(domain.Policy{Targets: domain.PolicyTargets{Names: []string{"backend-*"}}}))
+}
+
+func TestEvaluatedByOwner(t *testing.T) {
+	pod := domain.Entity{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Name:       "nginx-5d8f-x2k",
+		Namespace:  "default",
+		Owner: &domain.EntityOwner{
+			APIVersion:  "apps/v1",
+			Kind:        "Deployment",
+			Name:        "nginx",
+			Namespace:   "default",
+			Controllers: []string{"apps/v1/ReplicaSet"},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		entity    domain.Entity
+		kinds     []string
+		evaluated bool
+	}{
+		{
+			name:   "entity without owner",
+			entity: domain.Entity{Kind: "Pod"},
+			kinds:  []string{"Pod", "Deployment"},
+		},
+		{
+			name:   "policy of entity kind only",
+			entity: pod,
+			kinds:  []string{"Pod"},
+		},
+		{
+			name:      "policy of owner kind",
+			entity:    pod,
+			kinds:     []string{"Pod", "Deployment"},
+			evaluated: true,
+		},
+		{
+			name:      "policy of intermediate controller kind",
+			entity:    pod,
+			kinds:     []string{"Pod", "apps/v1/ReplicaSet"},
+			evaluated: true,
+		},
+		{
+			name:      "policy of all kinds",
+			entity:    pod,
+			evaluated: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := domain.Policy{Targets: domain.PolicyTargets{Kinds: tt.kinds}}
+			require.Equal(t, tt.evaluated, evaluatedByOwner(tt.entity, policy))
+		})
+	}
+}
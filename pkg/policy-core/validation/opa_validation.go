@@ -2,6 +2,7 @@ package validation
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
@@ -13,6 +14,10 @@ import (
 	opa "github.com/weaveworks/policy-agent/pkg/opa-core"
 	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
 	"github.com/weaveworks/policy-agent/pkg/uuid-go"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 const (
@@ -28,6 +33,14 @@ type OpaValidator struct {
 	accountID       string
 	clusterID       string
 	mutate          bool
+	// namespaceResolver gets the namespaces of the entities, namespace label targets match no entity without it
+	namespaceResolver domain.NamespaceResolver
+	// clusterContextSource gets the context of the cluster attached to the results and exposed to the policies
+	clusterContextSource domain.ClusterContextSource
+	// scopeResolver gets the scope of the entity kinds, the entities without namespace are cluster scoped without it
+	scopeResolver domain.ScopeResolver
+	// evaluateOwners skips the policies that target the owner of an owned entity, they are evaluated against the owner
+	evaluateOwners bool
 }
 
 // NewOPAValidator returns an opa validator to validate entities
@@ -51,6 +64,27 @@ func NewOPAValidator(
 	}
 }
 
+// SetNamespaceResolver exposes the namespace of the entities to the policies and enables namespace label targets
+func (v *OpaValidator) SetNamespaceResolver(namespaceResolver domain.NamespaceResolver) {
+	v.namespaceResolver = namespaceResolver
+}
+
+// SetScopeResolver matches the scope targets with the scope of the entity kind instead of the entity namespace
+func (v *OpaValidator) SetScopeResolver(scopeResolver domain.ScopeResolver) {
+	v.scopeResolver = scopeResolver
+}
+
+// SetClusterContextSource attaches the cluster context to the results metadata and exposes it to the policies under input.cluster
+func (v *OpaValidator) SetClusterContextSource(clusterContextSource domain.ClusterContextSource) {
+	v.clusterContextSource = clusterContextSource
+}
+
+// SetEvaluateOwners skips the policies that target the kind of the owner of an owned entity, so that their violations
+// are reported once against the owner instead of once for each owned entity
+func (v *OpaValidator) SetEvaluateOwners(evaluateOwners bool) {
+	v.evaluateOwners = evaluateOwners
+}
+
 // Validate validate policies using opa library, implements validation.Validator
 func (v *OpaValidator) Validate(ctx context.Context, entity domain.Entity, trigger string) (*domain.PolicyValidationSummary, error) {
 	policies, err := v.policiesSource.GetAll(ctx)
@@ -58,6 +92,28 @@ func (v *OpaValidator) Validate(ctx context.Context, entity domain.Entity, trigg
 		return nil, fmt.Errorf("failed to get policies from source: %w", err)
 	}
 
+	var namespace map[string]interface{}
+	if v.namespaceResolver != nil && entity.Namespace != "" {
+		namespace, err = v.namespaceResolver.GetNamespace(ctx, entity.Namespace)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get entity namespace: %w", err)
+		}
+	}
+
+	input := map[string]interface{}{}
+	if namespace != nil {
+		input["namespace"] = namespace
+	}
+	var metadata interface{}
+	if v.clusterContextSource != nil {
+		if cluster := v.clusterContextSource.GetClusterContext(); cluster != nil {
+			input["cluster"] = cluster.ToMap()
+			metadata = domain.ValidationMetadata{Cluster: cluster}
+		}
+	}
+
+	namespaced := v.isNamespaced(entity, policies)
+
 	config, err := v.policiesSource.GetPolicyConfig(ctx, entity)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get policy config from source: %w", err)
@@ -81,17 +137,22 @@ func (v *OpaValidator) Validate(ctx context.Context, entity domain.Entity, trigg
 			}()
 
 			policy := policies[index]
-			if !matchEntity(entity, policy) {
+			if !matchTargets(entity, namespace, namespaced, policy) {
 				return
 			}
-			if isExcluded(entity, policy) {
+			if isExcluded(entity, policy, time.Now()) || (v.evaluateOwners && evaluatedByOwner(entity, policy)) {
 				return
 			}
 
-			opaPolicy, err := opa.Parse(policy.Code, PolicyQuery)
-			if err != nil {
-				errsChan <- fmt.Errorf("failed to parse policy %s: %w", policy.ID, err)
-				return
+			// prepared sandboxed policies are already compiled
+			var opaPolicy opa.Policy
+			if policy.Evaluator == nil {
+				var err error
+				opaPolicy, err = opa.Parse(policy.Code, PolicyQuery)
+				if err != nil {
+					errsChan <- fmt.Errorf("failed to parse policy %s: %w", policy.ID, err)
+					return
+				}
 			}
 
 			parameters := map[string]interface{}{}
@@ -120,7 +181,14 @@ func (v *OpaValidator) Validate(ctx context.Context, entity domain.Entity, trigg
 			}
 
 			var opaErr opa.OPAError
-			err = opaPolicy.EvalGateKeeperCompliant(entity.Manifest, parameters, PolicyQuery)
+			policyInput, err := gateKeeperInput(entity.Manifest, parameters, input)
+			if err == nil {
+				if policy.Sandboxed {
+					err = evalSandboxed(ctx, policy, policyInput)
+				} else {
+					err = opaPolicy.Eval(policyInput, PolicyQuery)
+				}
+			}
 			if err != nil {
 				if errors.As(err, &opaErr) {
 					dmsg := fmt.Sprintf(
@@ -160,6 +228,7 @@ func (v *OpaValidator) Validate(ctx context.Context, entity domain.Entity, trigg
 						Status:      domain.PolicyValidationStatusViolating,
 						Occurrences: occurrences,
 						Enforced:    policy.Enforce,
+						Metadata:    metadata,
 					}
 					violationsChan <- result
 
@@ -182,6 +251,7 @@ func (v *OpaValidator) Validate(ctx context.Context, entity domain.Entity, trigg
 					CreatedAt: time.Now(),
 					Status:    domain.PolicyValidationStatusCompliant,
 					Enforced:  policy.Enforce,
+					Metadata:  metadata,
 				}
 				compliancesChan <- result
 			}
@@ -271,6 +341,52 @@ func (v *OpaValidator) Validate(ctx context.Context, entity domain.Entity, trigg
 	return &PolicyValidationSummary, nil
 }
 
+// isNamespaced checks if the entity is namespaced, the scope resolver is used only when a policy targets a scope.
+// Entities with a namespace are considered namespaced when the scope of their kind can not be resolved
+func (v *OpaValidator) isNamespaced(entity domain.Entity, policies []domain.Policy) bool {
+	if v.scopeResolver == nil {
+		return entity.Namespace != ""
+	}
+	for i := range policies {
+		if scope := policies[i].Targets.Scope; scope != "" && scope != "*" {
+			namespaced, err := v.scopeResolver.IsNamespaced(entity.APIVersion, entity.Kind)
+			if err != nil {
+				logger.Warnw("failed to get entity scope, using the entity namespace", "kind", entity.Kind, "apiVersion", entity.APIVersion, "error", err)
+				return entity.Namespace != ""
+			}
+			return namespaced
+		}
+	}
+	return entity.Namespace != ""
+}
+
+// gateKeeperInput returns the policy input with the same gatekeeper compliant review as
+// opa.Policy.EvalGateKeeperCompliant, the fields of extraInput such as the namespace and cluster of the entity are
+// added to the input next to the review
+func gateKeeperInput(manifest, parameters, extraInput map[string]interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+	obj := unstructured.Unstructured{Object: manifest}
+	gvk := obj.GroupVersionKind()
+	input := make(map[string]interface{}, len(extraInput)+2)
+	for key, value := range extraInput {
+		input[key] = value
+	}
+	input["review"] = admissionv1.AdmissionRequest{
+		Name: obj.GetName(),
+		Kind: metav1.GroupVersionKind{
+			Kind:    gvk.Kind,
+			Version: gvk.Version,
+			Group:   gvk.Group,
+		},
+		Object: runtime.RawExtension{Raw: data},
+	}
+	input["parameters"] = parameters
+	return input, nil
+}
+
 func parseOccurrence(msg string, in interface{}) domain.Occurrence {
 	occurrence := domain.Occurrence{Message: msg}
 	if v, ok := in.(map[string]interface{}); ok {
@@ -807,3 +807,298 @@ func TestOpaValidator_Validate(t *testing.T) {
 		})
 	}
 }
+
+// newTestValidator returns a validator of the policies without policy configs and sinks
+func newTestValidator(t *testing.T, policies ...domain.Policy) *OpaValidator {
+	ctrl := gomock.NewController(t)
+	policiesSource := mock.NewMockPoliciesSource(ctrl)
+	policiesSource.EXPECT().GetAll(gomock.Any()).Return(policies, nil).AnyTimes()
+	policiesSource.EXPECT().GetPolicyConfig(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+	return NewOPAValidator(policiesSource, false, "unit-test", "", "", false)
+}
+
+type namespaceResolverFunc func(ctx context.Context, name string) (map[string]interface{}, error)
+
+func (f namespaceResolverFunc) GetNamespace(ctx context.Context, name string) (map[string]interface{}, error) {
+	return f(ctx, name)
+}
+
+func TestOpaValidator_ValidateNamespace(t *testing.T) {
+	assert := require.New(t)
+	entity, err := getEntityFromStringSpec(testdata.Entity)
+	assert.Nil(err)
+
+	missingOwner := testdata.Policies["missingOwner"]
+	missingOwner.Targets = domain.PolicyTargets{NamespaceLabels: []map[string]string{{"env": "prod"}}}
+	imageTag := testdata.Policies["imageTag"]
+	imageTag.Targets = domain.PolicyTargets{NamespaceLabels: []map[string]string{{"env": "dev"}}}
+	prodNamespace := testdata.Policies["prodNamespace"]
+
+	tests := []struct {
+		name              string
+		namespaceResolver domain.NamespaceResolver
+		wantViolations    []string
+		wantErr           bool
+	}{
+		{
+			name: "namespace labels targets and namespace input",
+			namespaceResolver: namespaceResolverFunc(func(_ context.Context, name string) (map[string]interface{}, error) {
+				return map[string]interface{}{
+					"apiVersion": "v1",
+					"kind":       "Namespace",
+					"metadata": map[string]interface{}{
+						"name":   name,
+						"labels": map[string]interface{}{"env": "prod"},
+					},
+				}, nil
+			}),
+			wantViolations: []string{missingOwner.ID, prodNamespace.ID},
+		},
+		{
+			name: "namespace not found",
+			namespaceResolver: namespaceResolverFunc(func(context.Context, string) (map[string]interface{}, error) {
+				return nil, nil
+			}),
+		},
+		{
+			name: "no namespace resolver",
+		},
+		{
+			name: "error getting namespace",
+			namespaceResolver: namespaceResolverFunc(func(context.Context, string) (map[string]interface{}, error) {
+				return nil, fmt.Errorf("not available")
+			}),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newTestValidator(t, missingOwner, imageTag, prodNamespace)
+			if tt.namespaceResolver != nil {
+				v.SetNamespaceResolver(tt.namespaceResolver)
+			}
+			got, err := v.Validate(context.Background(), entity, "unit-test")
+			if tt.wantErr {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+
+			var violations []string
+			for _, violation := range got.Violations {
+				violations = append(violations, violation.Policy.ID)
+			}
+			assert.ElementsMatch(tt.wantViolations, violations)
+		})
+	}
+}
+
+type clusterContextFunc func() *domain.ClusterContext
+
+func (f clusterContextFunc) GetClusterContext() *domain.ClusterContext {
+	return f()
+}
+
+func TestOpaValidator_ValidateClusterContext(t *testing.T) {
+	assert := require.New(t)
+	entity, err := getEntityFromStringSpec(testdata.Entity)
+	assert.Nil(err)
+
+	oldVersion := testdata.Policies["oldClusterVersion"]
+	cluster := &domain.ClusterContext{Version: "v1.24.3", Major: 1, Minor: 24, Provider: "aws", NodeCount: 3, AgentVersion: "1.1.0"}
+
+	tests := []struct {
+		name           string
+		clusterContext domain.ClusterContextSource
+		wantViolation  bool
+	}{
+		{
+			name:           "cluster context input and metadata",
+			clusterContext: clusterContextFunc(func() *domain.ClusterContext { return cluster }),
+			wantViolation:  true,
+		},
+		{
+			name:           "cluster context not collected yet",
+			clusterContext: clusterContextFunc(func() *domain.ClusterContext { return nil }),
+		},
+		{
+			name: "no cluster context source",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newTestValidator(t, oldVersion)
+			if tt.clusterContext != nil {
+				v.SetClusterContextSource(tt.clusterContext)
+			}
+			got, err := v.Validate(context.Background(), entity, "unit-test")
+			assert.NoError(err)
+
+			if !tt.wantViolation {
+				assert.Empty(got.Violations)
+				assert.Len(got.Compliances, 1)
+				assert.Nil(got.Compliances[0].Metadata)
+				return
+			}
+			assert.Len(got.Violations, 1)
+			assert.Equal("cluster version v1.24.3 is deprecated", got.Violations[0].Occurrences[0].Message)
+			assert.Equal(domain.ValidationMetadata{Cluster: cluster}, got.Violations[0].Metadata)
+		})
+	}
+}
+
+func TestOpaValidator_ValidateSandboxed(t *testing.T) {
+	assert := require.New(t)
+	entity, err := getEntityFromStringSpec(testdata.Entity)
+	assert.Nil(err)
+
+	missingOwner := testdata.Policies["missingOwner"]
+	missingOwner.Sandboxed = true
+	httpSend := domain.Policy{
+		ID:        "tenant.http-send",
+		Name:      "Tenant http send",
+		Sandboxed: true,
+		Code: `package tenant.http_send
+
+violation[result] {
+  response := http.send({"method": "get", "url": "http://example.com"})
+  result = {"msg": sprintf("%v", [response.status_code])}
+}`,
+	}
+
+	got, err := newTestValidator(t, missingOwner).Validate(context.Background(), entity, "unit-test")
+	assert.NoError(err)
+	assert.Len(got.Violations, 1)
+	assert.Equal(missingOwner.ID, got.Violations[0].Policy.ID)
+
+	_, err = newTestValidator(t, httpSend).Validate(context.Background(), entity, "unit-test")
+	assert.ErrorContains(err, "http.send")
+
+	// prepared policies are not compiled again
+	prepared := missingOwner
+	prepared.Evaluator, err = PrepareSandboxed(context.Background(), missingOwner.Code)
+	assert.NoError(err)
+	prepared.Code = ""
+	got, err = newTestValidator(t, prepared).Validate(context.Background(), entity, "unit-test")
+	assert.NoError(err)
+	assert.Len(got.Violations, 1)
+
+	// rules with a null value report no violation
+	nullRule := domain.Policy{
+		ID:        "tenant.null",
+		Name:      "Tenant null",
+		Sandboxed: true,
+		Code:      "package tenant.null_rule\n\nviolation := null",
+	}
+	got, err = newTestValidator(t, nullRule).Validate(context.Background(), entity, "unit-test")
+	assert.NoError(err)
+	assert.Empty(got.Violations)
+}
+
+func TestCompileSandboxed(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    string
+		wantErr string
+	}{
+		{
+			name: "builtins without network access",
+			code: "package tenant\nviolation[result] { result = {\"msg\": sprintf(\"%v\", [time.now_ns()])} }",
+		},
+		{
+			name:    "http send",
+			code:    "package tenant\nviolation[result] { result = http.send({\"method\": \"get\", \"url\": \"http://example.com\"}) }",
+			wantErr: "http.send",
+		},
+		{
+			name:    "net builtins",
+			code:    "package tenant\nviolation[result] { result = net.lookup_ip_addr(\"example.com\") }",
+			wantErr: "net.lookup_ip_addr",
+		},
+		{
+			name:    "missing violation rule",
+			code:    "package tenant\nallow { true }",
+			wantErr: "rule `violation` is not found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CompileSandboxed(tt.code)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+type scopeResolverFunc func(apiVersion, kind string) (bool, error)
+
+func (f scopeResolverFunc) IsNamespaced(apiVersion, kind string) (bool, error) {
+	return f(apiVersion, kind)
+}
+
+func TestOpaValidator_ValidateScope(t *testing.T) {
+	assert := require.New(t)
+	// a namespaced deployment manifest without namespace, as found in files
+	entity, err := getEntityFromStringSpec(testdata.Entity)
+	assert.Nil(err)
+	entity.Namespace = ""
+
+	namespacedPolicy := testdata.Policies["missingOwner"]
+	namespacedPolicy.Targets = domain.PolicyTargets{Scope: domain.PolicyTargetsNamespacedScope}
+
+	tests := []struct {
+		name          string
+		namespace     string
+		scopeResolver domain.ScopeResolver
+		wantViolation bool
+	}{
+		{
+			name: "scope of the kind",
+			scopeResolver: scopeResolverFunc(func(apiVersion, kind string) (bool, error) {
+				return apiVersion == "apps/v1" && kind == "Deployment", nil
+			}),
+			wantViolation: true,
+		},
+		{
+			name: "entity without namespace is cluster scoped without scope resolver",
+		},
+		{
+			name: "entity without namespace is cluster scoped when the scope is not resolved",
+			scopeResolver: scopeResolverFunc(func(string, string) (bool, error) {
+				return false, fmt.Errorf("no matches for kind")
+			}),
+		},
+		{
+			name:      "entity with namespace is namespaced when the scope is not resolved",
+			namespace: "default",
+			scopeResolver: scopeResolverFunc(func(string, string) (bool, error) {
+				return false, fmt.Errorf("no matches for kind")
+			}),
+			wantViolation: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newTestValidator(t, namespacedPolicy)
+			if tt.scopeResolver != nil {
+				v.SetScopeResolver(tt.scopeResolver)
+			}
+			entity := entity
+			entity.Namespace = tt.namespace
+			got, err := v.Validate(context.Background(), entity, "unit-test")
+			assert.NoError(err)
+			if tt.wantViolation {
+				assert.Len(got.Violations, 1)
+			} else {
+				assert.Empty(got.Violations)
+				assert.Empty(got.Compliances)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package validation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+	opa "github.com/weaveworks/policy-agent/pkg/opa-core"
+	"github.com/weaveworks/policy-agent/pkg/policy-core/domain"
+)
+
+// sandboxEvalTimeout bounds the evaluation of a sandboxed policy against an entity
+const sandboxEvalTimeout = 5 * time.Second
+
+// sandboxCapabilities are the capabilities of sandboxed policies, the builtins reaching the network are removed
+var sandboxCapabilities = newSandboxCapabilities()
+
+func newSandboxCapabilities() *ast.Capabilities {
+	capabilities := ast.CapabilitiesForThisVersion()
+	builtins := make([]*ast.Builtin, 0, len(capabilities.Builtins))
+	for _, builtin := range capabilities.Builtins {
+		if builtin.Name == "http.send" || strings.HasPrefix(builtin.Name, "net.") {
+			continue
+		}
+		builtins = append(builtins, builtin)
+	}
+	capabilities.Builtins = builtins
+	capabilities.AllowNet = []string{}
+	return capabilities
+}
+
+// CompileSandboxed checks the code of a sandboxed policy defines the violation rule and compiles without the network builtins
+func CompileSandboxed(code string) error {
+	_, _, err := compileSandboxed(code)
+	return err
+}
+
+// compileSandboxed returns the compiler of the sandboxed policy code and the reference of its violation rule
+func compileSandboxed(code string) (*ast.Compiler, string, error) {
+	if _, err := opa.Parse(code, PolicyQuery); err != nil {
+		return nil, "", err
+	}
+	module, err := ast.ParseModuleWithOpts("", code, ast.ParserOptions{Capabilities: sandboxCapabilities})
+	if err != nil {
+		return nil, "", err
+	}
+	compiler := ast.NewCompiler().WithCapabilities(sandboxCapabilities)
+	compiler.Compile(map[string]*ast.Module{"policy": module})
+	if compiler.Failed() {
+		return nil, "", compiler.Errors
+	}
+	return compiler, module.Package.Path.String() + "." + PolicyQuery, nil
+}
+
+// sandboxedPolicy is the prepared violation query of a sandboxed policy
+type sandboxedPolicy struct {
+	query rego.PreparedEvalQuery
+}
+
+// PrepareSandboxed compiles the code of a sandboxed policy once so that it can be evaluated against many entities,
+// set it as the evaluator of the policy
+func PrepareSandboxed(ctx context.Context, code string) (domain.PolicyEvaluator, error) {
+	compiler, rule, err := compileSandboxed(code)
+	if err != nil {
+		return nil, err
+	}
+	query, err := rego.New(
+		rego.Query(rule),
+		rego.Compiler(compiler),
+	).PrepareForEval(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare sandboxed policy: %w", err)
+	}
+	return &sandboxedPolicy{query: query}, nil
+}
+
+// Eval validates the input against the policy, the evaluation is cancelled after sandboxEvalTimeout.
+// Violations are reported with the same error as opa.Policy.Eval
+func (p *sandboxedPolicy) Eval(ctx context.Context, input interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, sandboxEvalTimeout)
+	defer cancel()
+	rs, err := p.query.Eval(ctx, rego.EvalInput(input))
+	if err != nil {
+		return fmt.Errorf("failed to evaluate sandboxed policy: %w", err)
+	}
+	for _, r := range rs {
+		for _, expr := range r.Expressions {
+			switch value := expr.Value.(type) {
+			case []interface{}:
+				if len(value) > 0 {
+					return opa.NoValidError{Details: value}
+				}
+			case map[string]interface{}, string:
+				return opa.NoValidError{Details: value}
+			}
+		}
+	}
+	return nil
+}
+
+// evalSandboxed validates the input against the sandboxed policy with its evaluator, the code is compiled when the
+// policy was not prepared
+func evalSandboxed(ctx context.Context, policy domain.Policy, input interface{}) error {
+	evaluator := policy.Evaluator
+	if evaluator == nil {
+		var err error
+		evaluator, err = PrepareSandboxed(ctx, policy.Code)
+		if err != nil {
+			return err
+		}
+	}
+	return evaluator.Eval(ctx, input)
+}
@@ -792,5 +792,26 @@ var (
 				},
 			},
 		},
+		"prodNamespace": {
+			ID:   "weave.policies.prod-namespace",
+			Name: "Production namespace",
+			Code: `package weave.advisor.prod_namespace
+
+violation[result] {
+  input.namespace.metadata.labels.env == "prod"
+  result = {"msg": sprintf("namespace %s is a production namespace", [input.namespace.metadata.name])}
+}`,
+		},
+		"oldClusterVersion": {
+			ID:   "weave.policies.old-version",
+			Name: "Old kubernetes version",
+			Code: `package weave.advisor.old_version
+
+violation[result] {
+  input.cluster.major == 1
+  input.cluster.minor < 25
+  result = {"msg": sprintf("cluster version %s is deprecated", [input.cluster.version])}
+}`,
+		},
 	}
 )